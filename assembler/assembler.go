@@ -0,0 +1,206 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//max number of instructions of the hack ROM
+const romSize = 32768
+
+//first address of variables
+const variableBase = 16
+
+var predefinedSymbols = map[string]uint16{
+	"SP": 0, "LCL": 1, "ARG": 2, "THIS": 3, "THAT": 4,
+	"SCREEN": 16384, "KBD": 24576,
+}
+
+func init() {
+	for i := 0; i < 16; i++ {
+		predefinedSymbols[fmt.Sprintf("R%d", i)] = uint16(i)
+	}
+}
+
+var compCodes = map[string]uint16{
+	"0": 0x2a, "1": 0x3f, "-1": 0x3a, "D": 0x0c, "A": 0x30, "!D": 0x0d, "!A": 0x31, "-D": 0x0f, "-A": 0x33,
+	"D+1": 0x1f, "A+1": 0x37, "D-1": 0x0e, "A-1": 0x32, "D+A": 0x02, "D-A": 0x13, "A-D": 0x07, "D&A": 0x00, "D|A": 0x15,
+}
+
+//commutative forms accepted as well, e.g. A+D for D+A
+var commutedComps = map[string]string{"A+D": "D+A", "A&D": "D&A", "A|D": "D|A", "1+D": "D+1", "1+A": "A+1"}
+
+var jumpCodes = map[string]uint16{
+	"": 0, "JGT": 1, "JEQ": 2, "JGE": 3, "JLT": 4, "JNE": 5, "JLE": 6, "JMP": 7,
+}
+
+var symbolReg = regexp.MustCompile(`^[a-zA-Z_.$:][\w.$:]*$`)
+
+type instruction struct {
+	text string
+	line int //line number in the asm file
+}
+
+//Assemble translates hack assembly to machine code, labels are resolved in the first pass and
+//variables are allocated from RAM[16] in the second pass
+func Assemble(rd io.Reader) ([]uint16, error) {
+	symbols := map[string]uint16{}
+	for k, v := range predefinedSymbols {
+		symbols[k] = v
+	}
+
+	//first pass, collect instructions and labels
+	var instructions []instruction
+	scanner := bufio.NewScanner(rd)
+	var lineCount int
+	for scanner.Scan() {
+		lineCount++
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.Join(strings.Fields(line), "")
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "(") {
+			label := strings.TrimSuffix(strings.TrimPrefix(line, "("), ")")
+			if !strings.HasSuffix(line, ")") || !symbolReg.MatchString(label) {
+				return nil, fmt.Errorf("line %d: invalid label:%s", lineCount, line)
+			}
+			if _, ok := symbols[label]; ok {
+				return nil, fmt.Errorf("line %d: duplicated label:%s", lineCount, label)
+			}
+			symbols[label] = uint16(len(instructions))
+			continue
+		}
+		instructions = append(instructions, instruction{text: line, line: lineCount})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(instructions) > romSize {
+		return nil, fmt.Errorf("program of %d instructions doesn't fit in the ROM of %d", len(instructions), romSize)
+	}
+
+	//second pass, translate instructions
+	code := make([]uint16, 0, len(instructions))
+	nextVariable := uint16(variableBase)
+	for _, inst := range instructions {
+		var c uint16
+		var err error
+		if strings.HasPrefix(inst.text, "@") {
+			c, err = aInstruction(inst.text[1:], symbols, &nextVariable)
+		} else {
+			c, err = cInstruction(inst.text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", inst.line, err.Error())
+		}
+		code = append(code, c)
+	}
+	return code, nil
+}
+
+func aInstruction(value string, symbols map[string]uint16, nextVariable *uint16) (uint16, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 || n > 32767 {
+			return 0, fmt.Errorf("constant out of range:%s", value)
+		}
+		return uint16(n), nil
+	}
+	if !symbolReg.MatchString(value) {
+		return 0, fmt.Errorf("invalid symbol:%s", value)
+	}
+	if address, ok := symbols[value]; ok {
+		return address, nil
+	}
+	symbols[value] = *nextVariable
+	*nextVariable++
+	return symbols[value], nil
+}
+
+//dest=comp;jump
+func cInstruction(text string) (uint16, error) {
+	dest, comp, jump := "", text, ""
+	if i := strings.Index(comp, "="); i >= 0 {
+		dest, comp = comp[:i], comp[i+1:]
+	}
+	if i := strings.Index(comp, ";"); i >= 0 {
+		comp, jump = comp[:i], comp[i+1:]
+	}
+
+	var a uint16
+	if strings.Contains(comp, "M") {
+		if strings.Contains(comp, "A") {
+			return 0, fmt.Errorf("invalid comp:%s", comp)
+		}
+		a = 1
+		comp = strings.Replace(comp, "M", "A", -1)
+	}
+	if c, ok := commutedComps[comp]; ok {
+		comp = c
+	}
+	c, ok := compCodes[comp]
+	if !ok {
+		return 0, fmt.Errorf("invalid comp:%s", text)
+	}
+
+	var d uint16
+	for _, r := range dest {
+		var bit uint16
+		switch r {
+		case 'A':
+			bit = 4
+		case 'D':
+			bit = 2
+		case 'M':
+			bit = 1
+		default:
+			return 0, fmt.Errorf("invalid dest:%s", dest)
+		}
+		if d&bit != 0 {
+			return 0, fmt.Errorf("invalid dest:%s", dest)
+		}
+		d |= bit
+	}
+
+	j, ok := jumpCodes[jump]
+	if !ok {
+		return 0, fmt.Errorf("invalid jump:%s", jump)
+	}
+	return 0xe000 | a<<12 | c<<6 | d<<3 | j, nil
+}
+
+//Format writes the machine code as text, one 16 bits binary instruction each line
+func Format(code []uint16) string {
+	var sb strings.Builder
+	for _, c := range code {
+		sb.WriteString(fmt.Sprintf("%016b\n", c))
+	}
+	return sb.String()
+}
+
+//AssembleFile writes the hack file of an asm file, the output defaults to <file>.hack
+func AssembleFile(path string, output string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	code, err := Assemble(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if len(output) == 0 {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + ".hack"
+	}
+	return ioutil.WriteFile(output, []byte(Format(code)), 0644)
+}
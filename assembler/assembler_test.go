@@ -0,0 +1,106 @@
+package assembler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/vmtranslator"
+)
+
+func TestAssemble_Add(t *testing.T) {
+	code, err := Assemble(strings.NewReader(`// Computes R0 = 2 + 3
+@2
+D=A
+@3
+D=D+A
+@0
+M=D`))
+	assert.Nil(t, err)
+	assert.Equal(t, `0000000000000010
+1110110000010000
+0000000000000011
+1110000010010000
+0000000000000000
+1110001100001000
+`, Format(code))
+}
+
+func TestAssemble_Symbols(t *testing.T) {
+	code, err := Assemble(strings.NewReader(`
+   @R0
+   D=M              // D = first number
+   @R1
+   D=D-M            // D = first number - second number
+   @OUTPUT_FIRST
+   D;JGT            // if D>0 (first is greater) goto output_first
+   @R1
+   D=M              // D = second number
+   @OUTPUT_D
+   0;JMP            // goto output_d
+(OUTPUT_FIRST)
+   @R0
+   D=M              // D = first number
+(OUTPUT_D)
+   @R2
+   M=D              // M[2] = D (greatest number)
+   @max
+   M=D
+   @sum
+   AM=M+1
+   @max
+   MD=D|M
+   @SCREEN
+   A=D+A
+   @KBD
+(INFINITE_LOOP)
+   @INFINITE_LOOP
+   0;JMP            // infinite loop`))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{
+		0x0000, 0xfc10, 0x0001, 0xf4d0, 10, 0xe301, 0x0001, 0xfc10, 12, 0xea87,
+		0x0000, 0xfc10,
+		0x0002, 0xe308, 16, 0xe308, 17, 0xfde8, 16, 0xf558, 16384, 0xe0a0, 24576,
+		23, 0xea87,
+	}, code)
+}
+
+func TestAssemble_Errors(t *testing.T) {
+	for source, msg := range map[string]string{
+		"@32768":         "line 1: constant out of range:32768",
+		"\n@1abc":        "line 2: invalid symbol:1abc",
+		"D=D*A":          "line 1: invalid comp:D=D*A",
+		"D=A+M":          "line 1: invalid comp:A+M",
+		"X=A":            "line 1: invalid dest:X",
+		"DD=A":           "line 1: invalid dest:DD",
+		"0;JMPP":         "line 1: invalid jump:JMPP",
+		"(LOOP)\n(LOOP)": "line 2: duplicated label:LOOP",
+		"(LOOP":          "line 1: invalid label:(LOOP",
+	} {
+		_, err := Assemble(strings.NewReader(source))
+		if assert.NotNil(t, err, source) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+}
+
+func TestAssembleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	//the translated Pong with the OS must fit in the ROM
+	asm := filepath.Join(dir, "Pong.asm")
+	assert.Nil(t, vmtranslator.TranslatePath("../output/vm/Pong", asm))
+	assert.Nil(t, AssembleFile(asm, ""))
+	hack, err := ioutil.ReadFile(filepath.Join(dir, "Pong.hack"))
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(hack)), "\n")
+	assert.True(t, len(lines) < romSize, len(lines))
+	for _, line := range lines {
+		assert.Len(t, line, 16)
+	}
+}
@@ -0,0 +1,42 @@
+package compiler
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//Tokenize returns the tokens of a jack source, it keeps scanning after a lexical error
+//and all the errors are returned as a DiagnosticList with the tokens scanned
+func Tokenize(r io.Reader) ([]Token, error) {
+	tokenizer := &tokenizer{}
+	err := tokenizer.Tokenize(r)
+	return tokenizer.tokens, err
+}
+
+//Parse parses the source of the jack file name, the class is returned even with syntax errors,
+//the statements failed to parse are kept as bad statements
+func Parse(name string, src []byte) (*ast.Class, DiagnosticList) {
+	var diagnostics DiagnosticList
+	tokenizer := &tokenizer{file: name}
+	diagnostics.AddError(tokenizer.Tokenize(bytes.NewReader(src)), CodeReadError)
+	jc, syntaxErrors := parseTokens(tokenizer.tokens)
+	diagnostics.Add(syntaxErrors.inFile(name)...)
+	diagnostics.sortByPosition()
+	jc.File = name
+	jc.Lines = strings.Split(string(src), "\n")
+	return &jc, diagnostics
+}
+
+//Compile checks the classes of a program together and compiles each class to vm code in memory.
+//The vm code is keyed by the vm file name, e.g. Main.vm for Main.jack, with the json source map
+//Main.vm.map for Options.SourceMap, and Main.ir and Main.dot for Options.DumpIR. The classes with problems aren't compiled
+func Compile(classes []*ast.Class, opts Options) (map[string][]byte, DiagnosticList) {
+	var sources []*sourceFile
+	for _, jc := range classes {
+		sources = append(sources, &sourceFile{file: jc.File, lines: jc.Lines, class: *jc})
+	}
+	return compileSources(sources, opts)
+}
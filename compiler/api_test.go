@@ -0,0 +1,87 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(strings.NewReader(`let s = "a b"; // comment`))
+	assert.Nil(t, err)
+	var vals []string
+	for _, token := range tokens {
+		vals = append(vals, token.GetVal())
+	}
+	assert.Equal(t, []string{"let", "s", "=", "a b", ";"}, vals)
+
+	tokens, err = Tokenize(strings.NewReader("let s = #;"))
+	assert.Equal(t, 4, len(tokens))
+	assert.Equal(t, CodeInvalidCharacter, err.(DiagnosticList)[0].Code)
+}
+
+//a file without tokens misses the class at its start
+func TestParse_EmptyFile(t *testing.T) {
+	for _, src := range []string{"", "// no class\n/* at all */\n"} {
+		_, diagnostics := Parse("Main.jack", []byte(src))
+		assert.Equal(t, "Main.jack:1:1: error JACK0011: unexpected end of file\n\thint: expected 'class'", diagnostics.Error(), src)
+	}
+}
+
+//the programs compiled in memory are the same as the ones compiled from the files
+func TestCompile(t *testing.T) {
+	files, err := filepath.Glob("../sample/Square/*.jack")
+	assert.Nil(t, err)
+	var classes []*ast.Class
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		jc, diagnostics := Parse(filepath.Base(file), src)
+		assert.Nil(t, diagnostics)
+		classes = append(classes, jc)
+	}
+	outputs, diagnostics := Compile(classes, Options{SourceMap: true})
+	assert.Nil(t, diagnostics)
+	assert.Equal(t, 6, len(outputs))
+	for _, name := range []string{"Main.vm", "Square.vm", "SquareGame.vm"} {
+		golden, err := ioutil.ReadFile(filepath.Join("../output/vm/square", name))
+		assert.Nil(t, err)
+		assert.Equal(t, string(golden), string(outputs[name]), name)
+		assert.Contains(t, string(outputs[name+".map"]), `"source": "`+strings.TrimSuffix(name, ".vm")+`.jack"`)
+	}
+}
+
+func TestCompile_Problems(t *testing.T) {
+	main, diagnostics := Parse("Main.jack", []byte(`class Main {
+	function void main() {
+		let x = ;
+		do Point.new();
+		return;
+	}
+}`))
+	assert.Equal(t, "Main.jack:3:11: error JACK0012: unexpected symbol ';', expected a term", diagnostics.Error())
+	assert.Equal(t, []ast.StatementCategory{ast.BadSc, ast.DoSc, ast.RetSc}, statementCategories(main.Subroutines[0].Statements))
+
+	point, diagnostics := Parse("Point.jack", []byte(`class Point {
+	constructor Point new(int x) {
+		return this;
+	}
+}`))
+	assert.Nil(t, diagnostics)
+	outputs, diagnostics := Compile([]*ast.Class{main, point}, Options{})
+	assert.Equal(t, []string{"Point.vm"}, keys(outputs))
+	assert.Equal(t, "Main.jack:3:11: error JACK0012: unexpected symbol ';', expected a term\n"+
+		"Main.jack:4:6: error JACK0041: Point.new expects 1 arguments, got 0", diagnostics.Error())
+}
+
+func keys(m map[string][]byte) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
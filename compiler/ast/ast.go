@@ -0,0 +1,66 @@
+//Package ast declares the types of the syntax tree of jack classes.
+//The tree is built by the parser of package compiler with the positions of the source,
+//it's checked and compiled to vm code by the compiler, and it can be walked by other tools, e.g. linters
+package ast
+
+//Pos is a position in the source, lines and columns start from 1, a tab is one column
+type Pos struct {
+	Line, Column int
+}
+
+//Class is a jack file
+type Class struct {
+	Name         string
+	Declarations []Variable //fields and statics
+	Subroutines  []Subroutine
+	Pos          Pos      //position of the class name
+	File         string   //name of the jack file, e.g. Main.jack
+	Lines        []string //lines of the jack file for the comments of the vm code, optional
+}
+
+type VarKind string
+
+const (
+	Argument VarKind = "argument" //arguments
+	Local    VarKind = "local"    //local var inside method or function
+	Field    VarKind = "field"    // field in class
+	Static   VarKind = "static"   // static var
+)
+
+//Variable is the declaration of a variable
+type Variable struct {
+	Name    string
+	Type    string //int, char, boolean or a class
+	Kind    VarKind
+	Pos     Pos //where the variable is declared
+	TypePos Pos //where the type is declared
+}
+
+type SubroutineCategory string
+
+const (
+	Constructor SubroutineCategory = "constructor"
+	Method      SubroutineCategory = "method"
+	Function    SubroutineCategory = "function"
+)
+
+type Subroutine struct {
+	Name         string
+	Category     SubroutineCategory
+	Declarations []Variable //arguments and locals
+	Statements   []Statement
+	RetType      string
+	Pos          Pos //position of the name
+	RetTypePos   Pos
+}
+
+//Params are the arguments declared in the parameter list
+func (sub Subroutine) Params() []Variable {
+	var params []Variable
+	for _, dec := range sub.Declarations {
+		if dec.Kind == Argument {
+			params = append(params, dec)
+		}
+	}
+	return params
+}
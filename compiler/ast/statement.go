@@ -0,0 +1,110 @@
+package ast
+
+type StatementCategory int
+
+const (
+	IfSc StatementCategory = iota
+	WhileSc
+	RetSc
+	DoSc
+	LetSc
+	BadSc
+)
+
+type Statement interface {
+	Category() StatementCategory
+	Position() Pos
+}
+
+type IfStatement struct {
+	Condition      Expression
+	Statements     []Statement
+	ElseStatements []Statement
+	Pos            Pos
+	ElsePos        Pos //position of else, empty without else
+}
+
+func (is IfStatement) Category() StatementCategory {
+	return IfSc
+}
+
+func (is IfStatement) Position() Pos {
+	return is.Pos
+}
+
+type WhileStatement struct {
+	Condition  Expression
+	Statements []Statement
+	Pos        Pos
+}
+
+func (ws WhileStatement) Category() StatementCategory {
+	return WhileSc
+}
+
+func (ws WhileStatement) Position() Pos {
+	return ws.Pos
+}
+
+type DoStatement struct {
+	Action SubroutineCall
+	Pos    Pos
+}
+
+func (ds DoStatement) Category() StatementCategory {
+	return DoSc
+}
+
+func (ds DoStatement) Position() Pos {
+	return ds.Pos
+}
+
+type LetStatement struct {
+	Target     ReferenceTerm
+	Expression Expression
+	Pos        Pos
+}
+
+func (ls LetStatement) Category() StatementCategory {
+	return LetSc
+}
+
+func (ls LetStatement) Position() Pos {
+	return ls.Pos
+}
+
+type ReturnStatement struct {
+	Expression Expression //empty for return;
+	Pos        Pos
+}
+
+func (rs ReturnStatement) Category() StatementCategory {
+	return RetSc
+}
+
+func (rs ReturnStatement) Position() Pos {
+	return rs.Pos
+}
+
+//Token is a token of the source kept in a bad statement
+type Token struct {
+	Type string //keyword, identifier, symbol, integerConstant or stringConstant
+	Val  string
+	Pos  Pos
+}
+
+//BadStatement keeps the tokens of a statement which failed to parse,
+//the parsing goes on after it so that all the syntax errors of a file are found
+type BadStatement struct {
+	Tokens []Token
+	Err    error
+	Pos    Pos
+}
+
+func (bs BadStatement) Category() StatementCategory {
+	return BadSc
+}
+
+func (bs BadStatement) Position() Pos {
+	return bs.Pos
+}
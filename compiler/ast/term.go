@@ -0,0 +1,110 @@
+package ast
+
+type TermCategory int
+
+const (
+	ConstantTc TermCategory = iota
+	ReferenceTc
+	UnaryTc
+	ExpressionTc
+	SubCallTc
+)
+
+type Term interface {
+	Category() TermCategory
+	Position() Pos
+}
+
+type ConstKind string
+
+const (
+	IntegerConst ConstKind = "integerConstant"
+	StringConst  ConstKind = "stringConstant"
+	KeywordConst ConstKind = "keyword" //true, false, null, this
+)
+
+type ConstTerm struct {
+	Kind ConstKind
+	Val  interface{} //int for integers, string for the others
+	Pos  Pos
+}
+
+func (ct ConstTerm) Category() TermCategory {
+	return ConstantTc
+}
+
+func (ct ConstTerm) Position() Pos {
+	return ct.Pos
+}
+
+type UnaryTerm struct {
+	Operator string //- or ~
+	Term     Term
+	Pos      Pos
+}
+
+func (ut UnaryTerm) Category() TermCategory {
+	return UnaryTc
+}
+
+func (ut UnaryTerm) Position() Pos {
+	return ut.Pos
+}
+
+//ReferenceTerm is a variable or an element of an array, e.g. a[i]
+type ReferenceTerm struct {
+	VarName string
+	Index   Expression //empty for a variable
+	Pos     Pos
+}
+
+func (rt ReferenceTerm) Category() TermCategory {
+	return ReferenceTc
+}
+
+func (rt ReferenceTerm) Position() Pos {
+	return rt.Pos
+}
+
+func (rt ReferenceTerm) IsArrayRef() bool {
+	return !rt.Index.IsEmpty()
+}
+
+//Expression is term (op term)*, it's a term in parentheses inside another expression
+type Expression struct {
+	Terms      []Term
+	Operations []string
+}
+
+func (exp Expression) Category() TermCategory {
+	return ExpressionTc
+}
+
+//Position of an expression is the position of its first term
+func (exp Expression) Position() Pos {
+	if exp.IsEmpty() {
+		return Pos{}
+	}
+	return exp.Terms[0].Position()
+}
+
+func (exp Expression) IsEmpty() bool {
+	return len(exp.Terms) == 0
+}
+
+//SubroutineCall is f(args), Class.f(args) or variable.f(args)
+type SubroutineCall struct {
+	Target  string //empty for calls on this
+	Name    string
+	Args    []Expression
+	Pos     Pos
+	NamePos Pos //position of the subroutine name, same as Pos for calls without target
+}
+
+func (sc SubroutineCall) Category() TermCategory {
+	return SubCallTc
+}
+
+func (sc SubroutineCall) Position() Pos {
+	return sc.Pos
+}
@@ -0,0 +1,99 @@
+package ast
+
+//Node is a class, a subroutine, a variable declaration, a statement or a term
+type Node interface {
+	Position() Pos
+}
+
+func (jc Class) Position() Pos {
+	return jc.Pos
+}
+
+func (sub Subroutine) Position() Pos {
+	return sub.Pos
+}
+
+func (v Variable) Position() Pos {
+	return v.Pos
+}
+
+//Visitor visits the nodes walked by Walk, the children of a node are walked with the visitor returned
+//by Visit unless it's nil, then Visit(nil) is called with that visitor after the children
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+//Walk traverses a tree in the order of the source:
+//the declarations and the subroutines of a class, the declarations and the statements of a subroutine,
+//the conditions before the statements, and the terms of expressions, the index of arrays and the arguments of calls
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case Class:
+		for _, dec := range n.Declarations {
+			Walk(v, dec)
+		}
+		for _, sub := range n.Subroutines {
+			Walk(v, sub)
+		}
+	case Subroutine:
+		for _, dec := range n.Declarations {
+			Walk(v, dec)
+		}
+		walkStatements(v, n.Statements)
+	case IfStatement:
+		Walk(v, n.Condition)
+		walkStatements(v, n.Statements)
+		walkStatements(v, n.ElseStatements)
+	case WhileStatement:
+		Walk(v, n.Condition)
+		walkStatements(v, n.Statements)
+	case DoStatement:
+		Walk(v, n.Action)
+	case LetStatement:
+		Walk(v, n.Target)
+		Walk(v, n.Expression)
+	case ReturnStatement:
+		if !n.Expression.IsEmpty() {
+			Walk(v, n.Expression)
+		}
+	case Expression:
+		for _, term := range n.Terms {
+			Walk(v, term)
+		}
+	case UnaryTerm:
+		Walk(v, n.Term)
+	case ReferenceTerm:
+		if n.IsArrayRef() {
+			Walk(v, n.Index)
+		}
+	case SubroutineCall:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	}
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, st := range statements {
+		Walk(v, st)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+//Inspect traverses a tree in the order of Walk, it calls f for each node and walks its children if f returns true,
+//then f(nil) is called after the children
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,103 @@
+package ast_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+const mainJack = `class Main {
+	field int x;
+
+	method void run(Array a) {
+		var int i;
+		if (~(i < x)) {
+			let a[i] = -x;
+		} else {
+			do Output.printInt(a[0]);
+		}
+		return;
+	}
+}`
+
+//describe names a node by its type and position
+func describe(node ast.Node) string {
+	return fmt.Sprintf("%T %d:%d", node, node.Position().Line, node.Position().Column)
+}
+
+func TestInspect(t *testing.T) {
+	jc, diagnostics := compiler.Parse("Main.jack", []byte(mainJack))
+	assert.Nil(t, diagnostics)
+	var nodes []string
+	ast.Inspect(*jc, func(node ast.Node) bool {
+		if node != nil {
+			nodes = append(nodes, describe(node))
+		}
+		return true
+	})
+	assert.Equal(t, []string{
+		"ast.Class 1:7",
+		"ast.Variable 2:12",
+		"ast.Subroutine 4:14",
+		"ast.Variable 4:24",
+		"ast.Variable 5:11",
+		"ast.IfStatement 6:3",
+		"ast.Expression 6:7",
+		"ast.UnaryTerm 6:7",
+		"ast.Expression 6:9",
+		"ast.ReferenceTerm 6:9",
+		"ast.ReferenceTerm 6:13",
+		"ast.LetStatement 7:4",
+		"ast.ReferenceTerm 7:8",
+		"ast.Expression 7:10",
+		"ast.ReferenceTerm 7:10",
+		"ast.Expression 7:15",
+		"ast.UnaryTerm 7:15",
+		"ast.ReferenceTerm 7:16",
+		"ast.DoStatement 9:4",
+		"ast.SubroutineCall 9:7",
+		"ast.Expression 9:23",
+		"ast.ReferenceTerm 9:23",
+		"ast.Expression 9:25",
+		"ast.ConstTerm 9:25",
+		"ast.ReturnStatement 11:3",
+	}, nodes)
+}
+
+//counter counts the subroutine calls of each subroutine, it skips the declarations
+type counter struct {
+	calls map[string]int
+	sub   string
+}
+
+func (c *counter) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case ast.Subroutine:
+		return &counter{calls: c.calls, sub: n.Name}
+	case ast.Variable:
+		return nil
+	case ast.SubroutineCall:
+		c.calls[c.sub]++
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	jc, diagnostics := compiler.Parse("Main.jack", []byte(`class Main {
+	function void main() {
+		do Main.run(Math.max(1, 2));
+		return;
+	}
+
+	function int run(int x) {
+		return Math.abs(x);
+	}
+}`))
+	assert.Nil(t, diagnostics)
+	c := &counter{calls: map[string]int{}}
+	ast.Walk(c, *jc)
+	assert.Equal(t, map[string]int{"main": 2, "run": 1}, c.calls)
+}
@@ -0,0 +1,221 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//semanticChecker validates the structured classes before code generation,
+//all the classes of the program are known so calls across classes can be checked.
+//Calls on classes outside of the program are reported as warnings.
+type semanticChecker struct {
+	index *programIndex
+}
+
+func newSemanticChecker(index *programIndex) *semanticChecker {
+	return &semanticChecker{index: index}
+}
+
+func (sc *semanticChecker) checkClass(jc ast.Class) DiagnosticList {
+	var diagnostics DiagnosticList
+	table := NewClassSymbolTable()
+	for _, dec := range jc.Declarations {
+		diagnostics.AddError(table.add(dec), CodeRedeclaredVar)
+	}
+	for _, sub := range jc.Subroutines {
+		c := &subroutineChecker{
+			checker:     sc,
+			class:       jc,
+			sub:         sub,
+			table:       NewSubroutineSymbolTable(table),
+			diagnostics: &diagnostics,
+		}
+		c.check()
+	}
+	return diagnostics
+}
+
+type subroutineChecker struct {
+	checker     *semanticChecker
+	class       ast.Class
+	sub         ast.Subroutine
+	table       *symbolTable
+	diagnostics *DiagnosticList
+}
+
+func (c *subroutineChecker) report(code DiagnosticCode, pos ast.Pos, width int, msg string, hints ...string) {
+	c.diagnostics.Add(newSpanDiagnostic(code, pos, width, msg, hints...))
+}
+
+func (c *subroutineChecker) check() {
+	if c.sub.Category == ast.Method {
+		c.table.asMethod()
+	}
+	for _, dec := range c.sub.Declarations {
+		c.diagnostics.AddError(c.table.add(dec), CodeRedeclaredVar)
+	}
+	c.checkStatements(c.sub.Statements)
+	if !endsWithReturn(c.sub.Statements) {
+		c.report(CodeMissingReturn, c.sub.Pos, len(c.sub.Name), fmt.Sprintf("missing return at the end of %s", c.sub.Name))
+	}
+}
+
+//an if statement returns when both of its branches return
+func endsWithReturn(statements []ast.Statement) bool {
+	if len(statements) == 0 {
+		return false
+	}
+	switch st := statements[len(statements)-1].(type) {
+	case ast.ReturnStatement:
+		return true
+	case ast.IfStatement:
+		return endsWithReturn(st.Statements) && endsWithReturn(st.ElseStatements)
+	}
+	return false
+}
+
+func (c *subroutineChecker) checkStatements(statements []ast.Statement) {
+	for _, st := range statements {
+		switch st.Category() {
+		case ast.DoSc:
+			c.checkSubCall(st.(ast.DoStatement).Action)
+		case ast.RetSc:
+			c.checkReturnStatement(st.(ast.ReturnStatement))
+		case ast.LetSc:
+			ls := st.(ast.LetStatement)
+			c.checkExpression(ls.Expression)
+			c.checkReference(ls.Target)
+		case ast.IfSc:
+			is := st.(ast.IfStatement)
+			c.checkExpression(is.Condition)
+			c.checkStatements(is.Statements)
+			c.checkStatements(is.ElseStatements)
+		case ast.WhileSc:
+			ws := st.(ast.WhileStatement)
+			c.checkExpression(ws.Condition)
+			c.checkStatements(ws.Statements)
+		case ast.BadSc:
+			//the class is parsed with syntax errors
+			c.diagnostics.AddError(st.(ast.BadStatement).Err, CodeSyntaxError)
+		}
+	}
+}
+
+func (c *subroutineChecker) checkReturnStatement(st ast.ReturnStatement) {
+	c.checkExpression(st.Expression)
+	switch {
+	case c.sub.Category == ast.Constructor:
+		if !isThis(st.Expression) {
+			c.report(CodeConstructorReturn, st.Pos, len("return"), fmt.Sprintf("constructor %s must return this", c.sub.Name))
+		}
+	case c.sub.RetType == "void":
+		if !st.Expression.IsEmpty() {
+			c.report(CodeUnexpectedReturnValue, st.Pos, len("return"), fmt.Sprintf("void %s %s can't return a value", c.sub.Category, c.sub.Name))
+		}
+	default:
+		if st.Expression.IsEmpty() {
+			c.report(CodeMissingReturnValue, st.Pos, len("return"), fmt.Sprintf("%s %s must return a value of %s", c.sub.Category, c.sub.Name, c.sub.RetType))
+		}
+	}
+}
+
+func isThis(exp ast.Expression) bool {
+	if len(exp.Terms) != 1 {
+		return false
+	}
+	ct, ok := exp.Terms[0].(ast.ConstTerm)
+	return ok && ct.Kind == ast.KeywordConst && ct.Val == "this"
+}
+
+func (c *subroutineChecker) checkExpression(exp ast.Expression) {
+	for _, term := range exp.Terms {
+		c.checkTerm(term)
+	}
+}
+
+func (c *subroutineChecker) checkTerm(term ast.Term) {
+	switch term.Category() {
+	case ast.ConstantTc:
+		ct := term.(ast.ConstTerm)
+		if ct.Kind == ast.KeywordConst && ct.Val == "this" && c.sub.Category == ast.Function {
+			c.report(CodeThisInFunction, ct.Pos, len("this"), fmt.Sprintf("this can't be used in function %s", c.sub.Name))
+		}
+	case ast.ExpressionTc:
+		c.checkExpression(term.(ast.Expression))
+	case ast.UnaryTc:
+		c.checkTerm(term.(ast.UnaryTerm).Term)
+	case ast.ReferenceTc:
+		c.checkReference(term.(ast.ReferenceTerm))
+	case ast.SubCallTc:
+		c.checkSubCall(term.(ast.SubroutineCall))
+	}
+}
+
+func (c *subroutineChecker) checkReference(ref ast.ReferenceTerm) {
+	if ref.IsArrayRef() {
+		c.checkExpression(ref.Index)
+	}
+	if _, ok := c.lookupVar(ref.VarName, ref.Pos); !ok {
+		c.diagnostics.AddError(undeclaredVarErr(ref.VarName, ref.Pos), CodeUndeclaredVar)
+	}
+}
+
+//lookupVar reports fields used in a function
+func (c *subroutineChecker) lookupVar(name string, pos ast.Pos) (variable, bool) {
+	v, ok := c.table.getRecursively(name)
+	if ok && v.Kind == ast.Field && c.sub.Category == ast.Function {
+		c.report(CodeThisInFunction, pos, len(name), fmt.Sprintf("field %s can't be used in function %s", name, c.sub.Name))
+	}
+	return v, ok
+}
+
+func (c *subroutineChecker) checkSubCall(call ast.SubroutineCall) {
+	for _, arg := range call.Args {
+		c.checkExpression(arg)
+	}
+
+	className := call.Target
+	asMethod := true
+	width := len(call.Name)
+	if len(call.Target) == 0 {
+		className = c.class.Name
+	} else {
+		width += len(call.Target) + 1
+		if v, ok := c.lookupVar(call.Target, call.Pos); ok {
+			className = v.Type
+		} else {
+			asMethod = false
+		}
+	}
+	ci, ok := c.checker.index.class(className)
+	if !ok {
+		if !asMethod {
+			d := newSpanDiagnostic(CodeUnknownClass, call.Pos, len(className), fmt.Sprintf("class %s is not defined", className))
+			d.Severity = SeverityWarning
+			c.diagnostics.Add(d)
+		}
+		return
+	}
+
+	callee, ok := ci.subroutine(call.Name)
+	if !ok {
+		c.report(CodeUnknownSubroutine, call.Pos, width, fmt.Sprintf("subroutine %s.%s is not defined", className, call.Name))
+		return
+	}
+	if len(call.Target) == 0 {
+		asMethod = callee.Category == ast.Method //an unqualified call of a function is compiled without 'this'
+	}
+	if params := len(callee.Params()); params != len(call.Args) {
+		c.report(CodeArgumentCount, call.Pos, width, fmt.Sprintf("%s.%s expects %d arguments, got %d", className, call.Name, params, len(call.Args)))
+	}
+	if len(call.Target) == 0 && callee.Category == ast.Method && c.sub.Category == ast.Function {
+		c.report(CodeThisInFunction, call.Pos, width, fmt.Sprintf("method %s can't be called from function %s", call.Name, c.sub.Name),
+			fmt.Sprintf("call it on an instance of %s", className))
+	} else if asMethod && callee.Category != ast.Method {
+		c.report(CodeCallKindMismatch, call.Pos, width, fmt.Sprintf("%s %s.%s can't be called on an object", callee.Category, className, call.Name),
+			fmt.Sprintf("call it as %s.%s", className, call.Name))
+	} else if !asMethod && callee.Category == ast.Method {
+		c.report(CodeCallKindMismatch, call.Pos, width, fmt.Sprintf("method %s.%s can't be called without an object", className, call.Name))
+	}
+}
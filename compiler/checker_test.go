@@ -0,0 +1,175 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+const checkerPoint = `
+class Point {
+	field int x, y;
+	static int count;
+
+	constructor Point new(int ax, int ay) {
+		let x = ax;
+		let y = ay;
+		return this;
+	}
+
+	method int getX() {
+		return x;
+	}
+
+	function int total() {
+		return count;
+	}
+}`
+
+func TestSemanticChecker(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		codes  []DiagnosticCode
+	}{
+		{"valid", `
+class Main {
+	function void main() {
+		var Point p;
+		let p = Point.new(1, 2);
+		do Output.printInt(p.getX() + Point.total());
+		return;
+	}
+}`, nil},
+		{"unknown subroutine", `
+class Main {
+	function void main() {
+		var Point p;
+		let p = Point.create(1, 2);
+		do p.getY();
+		do foo();
+		return;
+	}
+}`, []DiagnosticCode{CodeUnknownSubroutine, CodeUnknownSubroutine, CodeUnknownSubroutine}},
+		{"argument count", `
+class Main {
+	function void main() {
+		var Point p;
+		let p = Point.new(1);
+		do Output.printInt(p.getX(1, 2));
+		return;
+	}
+}`, []DiagnosticCode{CodeArgumentCount, CodeArgumentCount}},
+		{"this in function", `
+class Main {
+	field int x;
+	function Main main() {
+		let x = 1;
+		do run();
+		return this;
+	}
+	method void run() {
+		return;
+	}
+}`, []DiagnosticCode{CodeThisInFunction, CodeThisInFunction, CodeThisInFunction}},
+		{"call kind", `
+class Main {
+	function void main() {
+		var Point p;
+		do Point.getX();
+		do p.total();
+		return;
+	}
+}`, []DiagnosticCode{CodeCallKindMismatch, CodeCallKindMismatch}},
+		{"unqualified calls", `
+class Main {
+	function void main() {
+		var Main m;
+		do helper();
+		let m = Main.new();
+		do m.run();
+		return;
+	}
+	constructor Main new() {
+		do helper();
+		return this;
+	}
+	method void run() {
+		do helper();
+		do run();
+		return;
+	}
+	function void helper() {
+		return;
+	}
+}`, nil},
+		{"return value", `
+class Main {
+	function int foo() {
+		return;
+	}
+	function void bar() {
+		return 1;
+	}
+}`, []DiagnosticCode{CodeMissingReturnValue, CodeUnexpectedReturnValue}},
+		{"constructor return", `
+class Main {
+	constructor Main new() {
+		if (true) {
+			return null;
+		}
+		return this;
+	}
+}`, []DiagnosticCode{CodeConstructorReturn}},
+		{"missing return", `
+class Main {
+	function int foo(int a) {
+		if (a > 0) {
+			return 1;
+		} else {
+			return 0;
+		}
+	}
+	function void bar(int a) {
+		if (a > 0) {
+			return;
+		}
+	}
+}`, []DiagnosticCode{CodeMissingReturn}},
+		{"undeclared var", `
+class Main {
+	function void main() {
+		var Array a;
+		let b = a[i];
+		return;
+	}
+}`, []DiagnosticCode{CodeUndeclaredVar, CodeUndeclaredVar}},
+	}
+	point := parseSource(t, checkerPoint)
+	assert.Empty(t, newSemanticChecker(newProgramIndex([]ast.Class{point})).checkClass(point))
+	for _, c := range cases {
+		main := parseSource(t, c.source)
+		var codes []DiagnosticCode
+		for _, d := range newSemanticChecker(newProgramIndex([]ast.Class{point, main})).checkClass(main) {
+			codes = append(codes, d.Code)
+		}
+		assert.Equal(t, c.codes, codes, c.name)
+	}
+}
+
+func TestSemanticChecker_Position(t *testing.T) {
+	main := parseSource(t, `class Main {
+	function void main() {
+		do Main.run(1);
+		return;
+	}
+	function void run() {
+		return;
+	}
+}`)
+	diagnostics := newSemanticChecker(newProgramIndex([]ast.Class{main})).checkClass(main)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "3:6: error JACK0041: Main.run expects 0 arguments, got 1", diagnostics[0].Error())
+	assert.Equal(t, 14, diagnostics[0].EndColumn)
+}
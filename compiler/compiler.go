@@ -1,13 +1,34 @@
 package compiler
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
 )
 
+//Options of compilation
+type Options struct {
+	StrictTypes    bool //check the types of expressions with the declared types
+	SourceComments bool //comment the vm code of each statement with the jack line, e.g. `// Main.jack:42  let x = y;`
+	SourceMap      bool //write a json source map from the vm lines to the jack lines for each class, e.g. Main.vm.map
+	Optimize       int  //optimization level, 1 removes dead code, folds the constant expressions, inlines small subroutines and rewrites redundant sequences of the vm code
+	NoInline       bool //don't inline the subroutines with Optimize
+	DumpIR         bool //write the basic blocks of the vm functions and their control flow graphs in graphviz dot for each class, e.g. Main.ir and Main.dot
+}
+
+//CompileDir compiles all the jack files under dir as one compilation unit, it goes on with the other files
+//when one fails and returns all the problems found as a DiagnosticList
 func CompileDir(dir string, outputDir string) error {
+	return CompileDirWithOptions(dir, outputDir, Options{})
+}
+
+func CompileDirWithOptions(dir string, outputDir string, opts Options) error {
 	if len(outputDir) == 0 {
 		outputDir = dir
 	}
@@ -21,40 +42,174 @@ func CompileDir(dir string, outputDir string) error {
 	if err != nil {
 		return err
 	}
-	for _, file := range sources {
-		if err := CompileFile(file, outputDir); err != nil {
-			return err
+	return compileFiles(sources, outputDir, opts)
+}
+
+func CompileFile(file string, dir string) error {
+	return compileFiles([]string{file}, dir, Options{})
+}
+
+type sourceFile struct {
+	file        string
+	lines       []string
+	class       ast.Class
+	diagnostics DiagnosticList
+}
+
+//parse all the files first and index the classes of the program, then check and compile each class
+//with the whole program known
+func compileFiles(files []string, dir string, opts Options) error {
+	var sources []*sourceFile
+	for _, file := range files {
+		sources = append(sources, parseFile(file))
+	}
+	outputs, diagnostics := compileSources(sources, opts)
+	for _, src := range sources {
+		if _, ok := outputs[vmFile(src)]; ok {
+			var written DiagnosticList
+			written.AddError(writeClass(src, outputs, dir), CodeWriteError)
+			diagnostics.Add(written.inFile(src.file)...)
 		}
 	}
-	return nil
+	for _, d := range diagnostics {
+		if d.Severity == SeverityInfo {
+			fmt.Println(d.Error()) //the code removed by the optimizations
+		}
+	}
+	return diagnostics.Err()
 }
 
-func CompileFile(file string, dir string) error {
-	f, _ := os.Open(file)
-	defer f.Close()
-	tokenizer := &tokenizer{}
-	tokenizer.Tokenize(f)
-	analysizer := &analysizer{}
-	output, err := analysizer.LexialAnalysis(tokenizer.tokens)
+//compileSources checks the sources together and compiles the ones without problems,
+//the vm code is keyed by the vm file name with the source maps of Options.SourceMap and the dumps of Options.DumpIR,
+//e.g. Main.vm, Main.vm.map, Main.ir and Main.dot.
+//The optimizations remove the code not reachable from the entries of the program
+func compileSources(sources []*sourceFile, opts Options) (map[string][]byte, DiagnosticList) {
+	index := checkSources(sources, opts)
+	var reachable map[string]bool
+	if opts.Optimize >= 1 {
+		reachable = reachableSubroutines(sources)
+	}
+	outputs := map[string][]byte{}
+	var diagnostics DiagnosticList
+	for _, src := range sources {
+		if reachable != nil {
+			src.class = eliminateDeadCode(src.class, reachable, &src.diagnostics)
+		}
+		if !src.diagnostics.HasErrors() {
+			src.diagnostics.AddError(compileClass(src, index, opts, outputs), CodeWriteError)
+		}
+		diagnostics.Add(src.diagnostics.inFile(src.file)...)
+	}
+	return outputs, diagnostics
+}
+
+//vmFile names the vm file of a source after the jack file, or the class if the file is unknown
+func vmFile(src *sourceFile) string {
+	if len(src.file) == 0 {
+		return src.class.Name + ".vm"
+	}
+	base := filepath.Base(src.file)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".vm"
+}
+
+//checkSources indexes the parsed classes and runs the semantic checks of each class,
+//the problems are added to the diagnostics of its source
+func checkSources(sources []*sourceFile, opts Options) *programIndex {
+	var classes []ast.Class
+	declared := map[string]bool{}
+	for _, src := range sources {
+		if src.diagnostics.HasErrors() {
+			continue
+		}
+		if declared[src.class.Name] {
+			src.diagnostics.Add(newSpanDiagnostic(CodeRedeclaredClass, src.class.Pos, len(src.class.Name),
+				fmt.Sprintf("class %s is declared more than once", src.class.Name)))
+			continue
+		}
+		declared[src.class.Name] = true
+		classes = append(classes, src.class)
+	}
+
+	index := newProgramIndex(classes)
+	checker := newSemanticChecker(index)
+	typeChecker := newTypeChecker(index)
+	for _, src := range sources {
+		if !src.diagnostics.HasErrors() {
+			src.diagnostics.Add(checker.checkClass(src.class)...)
+		}
+		if opts.StrictTypes && !src.diagnostics.HasErrors() {
+			src.diagnostics.Add(typeChecker.checkClass(src.class)...)
+		}
+	}
+	return index
+}
+
+func parseFile(file string) *sourceFile {
+	content, err := ioutil.ReadFile(file)
 	if err != nil {
-		fmt.Println(err.Error())
-		return err
+		src := &sourceFile{file: file}
+		src.diagnostics.Add(newDiagnostic(CodeReadError, 0, 0, err.Error()))
+		return src
+	}
+	return parseContent(file, content)
+}
+
+//parseContent parses the content of a jack file into a class
+func parseContent(file string, content []byte) *sourceFile {
+	jc, diagnostics := Parse(file, content)
+	src := &sourceFile{file: file, lines: jc.Lines, diagnostics: diagnostics}
+	if !diagnostics.HasErrors() {
+		src.class = *jc
 	}
-	jc, err := parseClass(output)
+	return src
+}
+
+func compileClass(src *sourceFile, index *programIndex, opts Options, outputs map[string][]byte) error {
+	jc := src.class
+	if opts.Optimize >= 1 {
+		jc = foldClass(jc)
+	}
+	cw := NewVmCompiler(jc, index)
+	if opts.SourceComments || opts.SourceMap {
+		cw.source = &classSource{file: src.file, lines: src.lines, comments: opts.SourceComments}
+	}
+	cw.optimize = opts.Optimize >= 1
+	cw.inline = opts.Optimize >= 1 && !opts.NoInline
+	code, err := cw.compile()
 	if err != nil {
-		fmt.Println(err.Error())
 		return err
 	}
+	output := vmFile(src)
+	if opts.SourceMap {
+		data, err := json.MarshalIndent(cw.sourceMap, "", "  ")
+		if err != nil {
+			return newDiagnostic(CodeWriteError, 0, 0, err.Error())
+		}
+		outputs[output+".map"] = data
+	}
+	if opts.DumpIR {
+		name := strings.TrimSuffix(output, ".vm")
+		outputs[name+".ir"] = []byte(ir.Dump(cw.functions))
+		outputs[name+".dot"] = []byte(ir.Dot(jc.Name, cw.functions))
+	}
+	outputs[output] = []byte(code)
+	return nil
+}
 
-	cw := NewVmCompiler(jc)
-	base := filepath.Base(file)
-	fo, err := os.Create(fmt.Sprintf("%s/%s.vm", dir, strings.TrimSuffix(base, filepath.Ext(file))))
-	if err != nil {
-		panic(err)
+//writeClass writes the vm file of a source compiled with its source map and the dumps of the ir to dir
+func writeClass(src *sourceFile, outputs map[string][]byte, dir string) error {
+	output := vmFile(src)
+	name := strings.TrimSuffix(output, ".vm")
+	for _, extra := range []string{output + ".map", name + ".ir", name + ".dot"} {
+		if data, ok := outputs[extra]; ok {
+			if err := ioutil.WriteFile(filepath.Join(dir, extra), data, 0644); err != nil {
+				return newDiagnostic(CodeWriteError, 0, 0, err.Error())
+			}
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, output), outputs[output], 0644); err != nil {
+		return newDiagnostic(CodeWriteError, 0, 0, err.Error())
 	}
-	// close fo on exit and check for its returned error
-	defer fo.Close()
-	cw.compileAndWrite(fo)
-	fmt.Println(fmt.Sprintf("%s compiled to %s", file, dir))
+	fmt.Println(fmt.Sprintf("%s compiled to %s", src.file, dir))
 	return nil
 }
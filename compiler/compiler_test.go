@@ -1,9 +1,14 @@
 package compiler
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
 )
 
 func TestCompileDir(t *testing.T) {
@@ -14,3 +19,104 @@ func TestCompileDir(t *testing.T) {
 func TestCompileFile(t *testing.T) {
 	CompileFile("/Users/zhangwuh/dev/playground/jack-compiler/sample/Square/SquareGame.jack", ".")
 }
+
+//compile the jack programs under sample/ and compare with the vm files under output/vm
+func TestCompileDir_Regression(t *testing.T) {
+	cases := map[string]string{
+		"Pong":      "Pong",
+		"Square":    "square",
+		"fibonacci": "fibonacci",
+		"Seven":     "Seven",
+	}
+	for source, expected := range cases {
+		dir, err := ioutil.TempDir("", "jack")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		assert.Nil(t, CompileDir(filepath.Join("../sample", source), dir))
+		compiled, _ := filepath.Glob(filepath.Join(dir, "*.vm"))
+		assert.NotEmpty(t, compiled, source)
+		for _, file := range compiled {
+			actual, err := ioutil.ReadFile(file)
+			assert.Nil(t, err)
+			golden, err := ioutil.ReadFile(filepath.Join("../output/vm", expected, filepath.Base(file)))
+			assert.Nil(t, err)
+			assert.Equal(t, string(golden), string(actual), file)
+		}
+	}
+}
+
+//the files without a class are reported, not compiled to a class without name
+func TestCompileDir_EmptyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jack")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "A.jack"), nil, 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "B.jack"), []byte("// B\n"), 0644))
+
+	err = CompileDir(dir, dir)
+	if assert.NotNil(t, err) {
+		diagnostics := err.(DiagnosticList)
+		assert.Equal(t, 2, len(diagnostics))
+		for _, d := range diagnostics {
+			assert.Equal(t, []interface{}{CodeUnexpectedEOF, 1, 1}, []interface{}{d.Code, d.Line, d.Column}, d.File)
+		}
+	}
+	compiled, _ := filepath.Glob(filepath.Join(dir, "*.vm"))
+	assert.Empty(t, compiled)
+}
+
+func parseSource(t *testing.T, src string) ast.Class {
+	jc, diagnostics := parseSourceDiagnostics(t, src)
+	assert.Nil(t, diagnostics)
+	return jc
+}
+
+func compileSource(t *testing.T, src string) string {
+	jc := parseSource(t, src)
+	code, err := NewVmCompiler(jc, newProgramIndex([]ast.Class{jc})).compile()
+	assert.Nil(t, err)
+	return code
+}
+
+func TestCompile_ChainedExpression(t *testing.T) {
+	code := compileSource(t, `
+class Main {
+	function int foo(int a, int b, int c) {
+		var boolean done;
+		while (a < b & ~done) {
+			let a = a + b - c * 2;
+		}
+		return a / b / c;
+	}
+}`)
+	expected := []string{
+		"function Main.foo 1",
+		"label WHILE_0",
+		"push argument 0",
+		"push argument 1",
+		"lt",
+		"push local 0",
+		"not",
+		"and",
+		"not",
+		"if-goto END_WHILE_0",
+		"push argument 0",
+		"push argument 1",
+		"add",
+		"push argument 2",
+		"sub",
+		"push constant 2",
+		"call Math.multiply 2",
+		"pop argument 0",
+		"goto WHILE_0",
+		"label END_WHILE_0",
+		"push argument 0",
+		"push argument 1",
+		"call Math.divide 2",
+		"push argument 2",
+		"call Math.divide 2",
+		"return",
+	}
+	assert.Equal(t, strings.Join(expected, "\n"), code)
+}
@@ -4,16 +4,14 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
 )
 
 type Tokenizer interface {
 	Tokenize(rd io.Reader) []TerminalToken
 }
 
-type Compiler interface {
-	LexialAnalysis(tokens []Token) (*NonTerminalToken, error)
-}
-
 type TokenType string
 
 const (
@@ -42,6 +40,12 @@ const (
 	Expression      TokenType = "expression"
 	TokenTerm       TokenType = "term"
 	ExpressionList  TokenType = "expressionList"
+
+	//tokens of a statement skipped to recover from a syntax error
+	ErrorNode TokenType = "error"
+
+	//end of the token stream
+	EOF TokenType = "eof"
 )
 
 func typeOf(t Token) TokenType {
@@ -62,16 +66,16 @@ func typeOf(t Token) TokenType {
 	return t.GetType()
 }
 
-var operations = map[string]string{
-	"+": "add",
-	"-": "sub",
-	"&": "and",
-	"|": "or",
-	"<": "lt",
-	">": "gt",
-	"=": "eq",
-	"/": "call Math.divide 2",
-	"*": "call Math.multiply 2",
+var operations = map[string]ir.Instruction{
+	"+": ir.Arithmetic(ir.OpAdd),
+	"-": ir.Arithmetic(ir.OpSub),
+	"&": ir.Arithmetic(ir.OpAnd),
+	"|": ir.Arithmetic(ir.OpOr),
+	"<": ir.Arithmetic(ir.OpLt),
+	">": ir.Arithmetic(ir.OpGt),
+	"=": ir.Arithmetic(ir.OpEq),
+	"/": ir.Call("Math.divide", 2),
+	"*": ir.Call("Math.multiply", 2),
 }
 
 var terminalElements = []TokenType{Keyword, Identifier, Symbol, IntegerConstant, StringConstant}
@@ -107,16 +111,15 @@ func isKeywordConstant(key Token) bool {
 type Token interface {
 	GetType() TokenType
 	GetVal() string
-	SubTokens() []Token
-	IsTerminal() bool
 	AsText() string
-	AddSubToken(ts ...Token)
 	Position() int //line number of source code
+	Column() int   //column number of source code
 }
 type TerminalToken struct {
 	tokenType TokenType
 	val       string
 	line      int
+	column    int
 }
 
 func (tt *TerminalToken) GetType() TokenType {
@@ -127,13 +130,6 @@ func (tt *TerminalToken) GetVal() string {
 	return tt.val
 }
 
-func (tt *TerminalToken) SubTokens() []Token {
-	return nil
-}
-
-func (tt *TerminalToken) AddSubToken(ts ...Token) {
-}
-
 func (tt *TerminalToken) AsText() string {
 	if tt.tokenType == StringConstant {
 		tt.val = strings.ReplaceAll(tt.val, "\"", "")
@@ -141,50 +137,10 @@ func (tt *TerminalToken) AsText() string {
 	return fmt.Sprintf("<%s>%s</%s>", tt.tokenType, EscapeXml(tt.val), tt.tokenType)
 }
 
-func (tt *TerminalToken) IsTerminal() bool {
-	return true
-}
-
 func (tt *TerminalToken) Position() int {
 	return tt.line
 }
 
-type NonTerminalToken struct {
-	tokenType TokenType
-	subTokens []Token
-}
-
-func (tt *NonTerminalToken) GetType() TokenType {
-	return tt.tokenType
-}
-
-func (tt *NonTerminalToken) GetVal() string {
-	return ""
-}
-
-func (tt *NonTerminalToken) SubTokens() []Token {
-	return tt.subTokens
-}
-
-func (tt *NonTerminalToken) AsText() string {
-	body := ""
-	for _, t := range tt.subTokens {
-		body += t.AsText()
-	}
-	return fmt.Sprintf("<%s>%s</%s>", tt.tokenType, body, tt.tokenType)
-}
-
-func (tt *NonTerminalToken) IsTerminal() bool {
-	return false
-}
-
-func (tt *NonTerminalToken) AddSubToken(t ...Token) {
-	tt.subTokens = append(tt.subTokens, t...)
-}
-
-func (tt *NonTerminalToken) Position() int {
-	if len(tt.SubTokens()) == 0 {
-		return -1
-	}
-	return tt.subTokens[0].Position()
+func (tt *TerminalToken) Column() int {
+	return tt.column
 }
@@ -1,41 +1,12 @@
 package compiler
 
 import (
-	"fmt"
 	"testing"
-)
 
-func TestNonTerminalToken_AsText(t *testing.T) {
-	token := &NonTerminalToken{
-		tokenType: Class,
-		subTokens: []Token{
-			&TerminalToken{
-				tokenType: Keyword,
-				val:       "function",
-			},
-			&NonTerminalToken{
-				tokenType: VarDec,
-				subTokens: []Token{
-					&TerminalToken{
-						tokenType: Keyword,
-						val:       "var",
-					},
-					&TerminalToken{
-						tokenType: Keyword,
-						val:       "int",
-					},
-					&TerminalToken{
-						tokenType: Identifier,
-						val:       "length",
-					},
-					&TerminalToken{
-						tokenType: Symbol,
-						val:       ";",
-					},
-				},
-			},
-		},
-	}
+	"github.com/stretchr/testify/assert"
+)
 
-	fmt.Println(token.AsText())
+func TestTerminalToken_AsText(t *testing.T) {
+	assert.Equal(t, "<keyword>function</keyword>", (&TerminalToken{tokenType: Keyword, val: "function"}).AsText())
+	assert.Equal(t, "<symbol>&lt;</symbol>", (&TerminalToken{tokenType: Symbol, val: "<"}).AsText())
 }
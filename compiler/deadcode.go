@@ -0,0 +1,134 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//entries of a program, Sys.init is only defined by a program compiled with its own OS classes
+var entries = []string{"Main.main", "Sys.init"}
+
+func findSubroutine(jc ast.Class, name string) (ast.Subroutine, bool) {
+	for _, sub := range jc.Subroutines {
+		if sub.Name == name {
+			return sub, true
+		}
+	}
+	return emptySubroutine, false
+}
+
+//reachableSubroutines returns the subroutines of a program called from its entries, keyed by the vm function name, e.g. Main.main.
+//It returns nil if the program has no entry(e.g. a library of classes) or has problems since its calls are unknown
+func reachableSubroutines(sources []*sourceFile) map[string]bool {
+	classes := map[string]ast.Class{}
+	for _, src := range sources {
+		if src.diagnostics.HasErrors() {
+			return nil
+		}
+		classes[src.class.Name] = src.class
+	}
+	var queue []string
+	for _, entry := range entries {
+		if _, _, ok := lookupFunction(classes, entry); ok {
+			queue = append(queue, entry)
+		}
+	}
+	if len(queue) == 0 {
+		return nil
+	}
+
+	reachable := map[string]bool{}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		jc, sub, ok := lookupFunction(classes, name)
+		if !ok || reachable[name] {
+			continue //the OS classes
+		}
+		reachable[name] = true
+		r := &referenceResolver{class: jc, sub: sub}
+		for _, st := range reachableStatements(sub.Statements, nil) {
+			ast.Inspect(st, func(node ast.Node) bool {
+				if call, ok := node.(ast.SubroutineCall); ok {
+					queue = append(queue, r.callee(call))
+				}
+				return true
+			})
+		}
+	}
+	return reachable
+}
+
+//lookupFunction finds the class and the subroutine of a vm function name
+func lookupFunction(classes map[string]ast.Class, name string) (ast.Class, ast.Subroutine, bool) {
+	parts := strings.SplitN(name, ".", 2)
+	jc, ok := classes[parts[0]]
+	if !ok || len(parts) < 2 {
+		return emptyClass, emptySubroutine, false
+	}
+	sub, ok := findSubroutine(jc, parts[1])
+	return jc, sub, ok
+}
+
+//callee is the vm function name of a call, the class of a method called on a variable is the type of the variable
+func (r *referenceResolver) callee(call ast.SubroutineCall) string {
+	className := r.class.Name
+	if len(call.Target) > 0 {
+		className = call.Target
+		if _, v, ok := r.lookup(call.Target); ok {
+			className = v.Type
+		}
+	}
+	return fmt.Sprintf("%s.%s", className, call.Name)
+}
+
+//reachableStatements drops the statements after a return, or after an if statement of which both branches return,
+//in the statements and the blocks of them. removed is called with the statements dropped of each block
+func reachableStatements(statements []ast.Statement, removed func([]ast.Statement)) []ast.Statement {
+	var reachable []ast.Statement
+	for i, st := range statements {
+		switch s := st.(type) {
+		case ast.IfStatement:
+			s.Statements = reachableStatements(s.Statements, removed)
+			s.ElseStatements = reachableStatements(s.ElseStatements, removed)
+			st = s
+		case ast.WhileStatement:
+			s.Statements = reachableStatements(s.Statements, removed)
+			st = s
+		}
+		reachable = append(reachable, st)
+		if endsWithReturn(reachable) {
+			if i+1 < len(statements) && removed != nil {
+				removed(statements[i+1:])
+			}
+			break
+		}
+	}
+	return reachable
+}
+
+//eliminateDeadCode removes the subroutines of a class which are not reachable and the statements after return,
+//each removal is reported as an info
+func eliminateDeadCode(jc ast.Class, reachable map[string]bool, diagnostics *DiagnosticList) ast.Class {
+	var subroutines []ast.Subroutine
+	for _, sub := range jc.Subroutines {
+		name := fmt.Sprintf("%s.%s", jc.Name, sub.Name)
+		if !reachable[name] {
+			d := newSpanDiagnostic(CodeUnusedSubroutine, sub.Pos, len(sub.Name), fmt.Sprintf("%s %s is never called, removed", sub.Category, name))
+			d.Severity = SeverityInfo
+			diagnostics.Add(d)
+			continue
+		}
+		sub.Statements = reachableStatements(sub.Statements, func(statements []ast.Statement) {
+			d := newDiagnostic(CodeUnreachableCode, statements[0].Position().Line, statements[0].Position().Column,
+				fmt.Sprintf("%d unreachable statements after return in %s, removed", len(statements), name))
+			d.Severity = SeverityInfo
+			diagnostics.Add(d)
+		})
+		subroutines = append(subroutines, sub)
+	}
+	jc.Subroutines = subroutines
+	return jc
+}
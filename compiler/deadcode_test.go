@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+var deadCodeProgram = map[string]string{
+	"Main.jack": `class Main {
+	function void main() {
+		var Point p;
+		let p = Point.new(3);
+		do Output.printInt(p.getX());
+		do Main.sign(-2);
+		return;
+	}
+
+	function int sign(int x) {
+		if (x < 0) {
+			return -1;
+		} else {
+			return 1;
+		}
+		do Point.unused();
+		return 0;
+	}
+}`,
+	"Point.jack": `class Point {
+	field int x;
+
+	constructor Point new(int ax) {
+		let x = ax;
+		return this;
+	}
+
+	method int getX() {
+		while (x > 0) {
+			return x;
+			let x = x - 1;
+		}
+		return x;
+	}
+
+	method int getY() {
+		return Point.helper();
+	}
+
+	function int unused() {
+		return Point.helper();
+	}
+
+	function int helper() {
+		return 0;
+	}
+}`,
+}
+
+func parseSources(files map[string]string) []*sourceFile {
+	var sources []*sourceFile
+	for _, file := range []string{"Main.jack", "Point.jack"} {
+		if src, ok := files[file]; ok {
+			sources = append(sources, parseContent(file, []byte(src)))
+		}
+	}
+	return sources
+}
+
+func TestReachableSubroutines(t *testing.T) {
+	sources := parseSources(deadCodeProgram)
+	checkSources(sources, Options{})
+	assert.Equal(t, map[string]bool{"Main.main": true, "Main.sign": true, "Point.new": true, "Point.getX": true}, reachableSubroutines(sources))
+
+	//a library has no entry, all its subroutines are kept
+	assert.Nil(t, reachableSubroutines(parseSources(map[string]string{"Point.jack": deadCodeProgram["Point.jack"]})))
+}
+
+func TestEliminateDeadCode(t *testing.T) {
+	var classes []*ast.Class
+	for _, file := range []string{"Main.jack", "Point.jack"} {
+		jc, diagnostics := Parse(file, []byte(deadCodeProgram[file]))
+		assert.Nil(t, diagnostics)
+		classes = append(classes, jc)
+	}
+	outputs, diagnostics := Compile(classes, Options{Optimize: 1, NoInline: true})
+	assert.Nil(t, diagnostics.Err())
+	assert.Equal(t, `Main.jack:16:3: info JACK0061: 2 unreachable statements after return in Main.sign, removed
+Point.jack:12:4: info JACK0061: 1 unreachable statements after return in Point.getX, removed
+Point.jack:17:13: info JACK0060: method Point.getY is never called, removed
+Point.jack:21:15: info JACK0060: function Point.unused is never called, removed
+Point.jack:25:15: info JACK0060: function Point.helper is never called, removed`, diagnostics.Error())
+
+	var functions []string
+	for _, output := range []string{"Main.vm", "Point.vm"} {
+		for _, line := range strings.Split(string(outputs[output]), "\n") {
+			if strings.HasPrefix(line, "function ") {
+				functions = append(functions, line)
+			}
+		}
+	}
+	assert.Equal(t, []string{"function Main.main 1", "function Main.sign 0", "function Point.new 0", "function Point.getX 0"}, functions)
+	assert.NotContains(t, string(outputs["Main.vm"]), "Point.unused")
+
+	//the program runs the same without the dead code
+	plain, diagnostics := Compile(classes, Options{})
+	assert.Nil(t, diagnostics)
+	expected, _ := runProgram(t, plain)
+	actual, _ := runProgram(t, outputs)
+	assert.Equal(t, "3", expected)
+	assert.Equal(t, expected, actual)
+}
+
+//the calls of a class with problems are unknown, so nothing is removed from the others
+func TestEliminateDeadCode_Problems(t *testing.T) {
+	sources := parseSources(map[string]string{
+		"Main.jack":  deadCodeProgram["Main.jack"],
+		"Point.jack": strings.Replace(deadCodeProgram["Point.jack"], "let x = ax;", "let x = ;", 1),
+	})
+	outputs, diagnostics := compileSources(sources, Options{Optimize: 1})
+	assert.True(t, diagnostics.HasErrors())
+	for _, d := range diagnostics {
+		assert.NotEqual(t, SeverityInfo, d.Severity, d.Error())
+	}
+	assert.Contains(t, string(outputs["Main.vm"]), "call Point.unused 0")
+}
@@ -0,0 +1,204 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return "error"
+}
+
+type DiagnosticCode string
+
+const (
+	//tokenizer
+	CodeReadError           DiagnosticCode = "JACK0001"
+	CodeInvalidCharacter    DiagnosticCode = "JACK0002"
+	CodeUnterminatedComment DiagnosticCode = "JACK0003"
+	CodeUnterminatedString  DiagnosticCode = "JACK0004"
+	CodeInvalidInteger      DiagnosticCode = "JACK0005"
+
+	//parser
+	CodeSyntaxError     DiagnosticCode = "JACK0010"
+	CodeUnexpectedEOF   DiagnosticCode = "JACK0011"
+	CodeUnexpectedToken DiagnosticCode = "JACK0012"
+	CodeInvalidType     DiagnosticCode = "JACK0013"
+
+	//symbols and code generation
+	CodeRedeclaredVar   DiagnosticCode = "JACK0020"
+	CodeUndeclaredVar   DiagnosticCode = "JACK0021"
+	CodeUnsupportedKind DiagnosticCode = "JACK0022"
+	CodeWriteError      DiagnosticCode = "JACK0030"
+
+	//semantic checks
+	CodeUnknownSubroutine     DiagnosticCode = "JACK0040"
+	CodeArgumentCount         DiagnosticCode = "JACK0041"
+	CodeThisInFunction        DiagnosticCode = "JACK0042"
+	CodeCallKindMismatch      DiagnosticCode = "JACK0043"
+	CodeMissingReturnValue    DiagnosticCode = "JACK0044"
+	CodeUnexpectedReturnValue DiagnosticCode = "JACK0045"
+	CodeConstructorReturn     DiagnosticCode = "JACK0046"
+	CodeMissingReturn         DiagnosticCode = "JACK0047"
+	CodeRedeclaredClass       DiagnosticCode = "JACK0048"
+	CodeUnknownClass          DiagnosticCode = "JACK0049"
+
+	//strict types
+	CodeTypeMismatch   DiagnosticCode = "JACK0050"
+	CodeInvalidOperand DiagnosticCode = "JACK0051"
+	CodeConditionType  DiagnosticCode = "JACK0052"
+	CodeNotAnObject    DiagnosticCode = "JACK0053"
+
+	//optimizations
+	CodeUnusedSubroutine DiagnosticCode = "JACK0060"
+	CodeUnreachableCode  DiagnosticCode = "JACK0061"
+)
+
+//Diagnostic is a problem found in the source code by any stage of the compiler
+type Diagnostic struct {
+	Severity  Severity
+	Code      DiagnosticCode
+	File      string
+	Line      int
+	Column    int
+	EndColumn int //exclusive, same as Column when the span is unknown
+	Message   string
+	Hints     []string
+}
+
+func newDiagnostic(code DiagnosticCode, line, column int, msg string, hints ...string) *Diagnostic {
+	return &Diagnostic{
+		Severity:  SeverityError,
+		Code:      code,
+		Line:      line,
+		Column:    column,
+		EndColumn: column,
+		Message:   msg,
+		Hints:     hints,
+	}
+}
+
+//newSpanDiagnostic spans width columns from pos
+func newSpanDiagnostic(code DiagnosticCode, pos ast.Pos, width int, msg string, hints ...string) *Diagnostic {
+	d := newDiagnostic(code, pos.Line, pos.Column, msg, hints...)
+	d.EndColumn = pos.Column + width
+	return d
+}
+
+//newTokenDiagnostic spans the whole value of the token
+func newTokenDiagnostic(code DiagnosticCode, t Token, msg string, hints ...string) *Diagnostic {
+	if t == nil || t.GetType() == EOF {
+		d := newDiagnostic(CodeUnexpectedEOF, 0, 0, "unexpected end of file", hints...)
+		if t != nil {
+			d.Line, d.Column, d.EndColumn = t.Position(), t.Column(), t.Column()
+		}
+		return d
+	}
+	d := newDiagnostic(code, t.Position(), t.Column(), msg, hints...)
+	d.EndColumn = t.Column() + len([]rune(t.GetVal()))
+	return d
+}
+
+//Main.jack:12:5: error JACK0012: message
+func (d *Diagnostic) Error() string {
+	var sb strings.Builder
+	if len(d.File) > 0 {
+		sb.WriteString(d.File + ":")
+	}
+	if d.Line > 0 {
+		sb.WriteString(fmt.Sprintf("%d:%d:", d.Line, d.Column))
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(" ")
+	}
+	sb.WriteString(fmt.Sprintf("%s %s: %s", d.Severity, d.Code, d.Message))
+	for _, hint := range d.Hints {
+		sb.WriteString("\n\thint: " + hint)
+	}
+	return sb.String()
+}
+
+//DiagnosticList collects all the diagnostics of a compilation instead of stopping at the first one
+type DiagnosticList []*Diagnostic
+
+func (l *DiagnosticList) Add(ds ...*Diagnostic) {
+	*l = append(*l, ds...)
+}
+
+//AddError appends err as diagnostics, errors which are not diagnostics are wrapped with the given code
+func (l *DiagnosticList) AddError(err error, code DiagnosticCode) {
+	switch e := err.(type) {
+	case nil:
+		return
+	case *Diagnostic:
+		l.Add(e)
+	case DiagnosticList:
+		l.Add(e...)
+	default:
+		l.Add(newDiagnostic(code, 0, 0, err.Error()))
+	}
+}
+
+func (l DiagnosticList) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+//Err returns the list as an error if any error was reported, otherwise nil
+func (l DiagnosticList) Err() error {
+	if l.HasErrors() {
+		return l
+	}
+	return nil
+}
+
+func (l DiagnosticList) Error() string {
+	var lines []string
+	for _, d := range l {
+		lines = append(lines, d.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//before reports whether d is at a position before other
+func (d *Diagnostic) before(other *Diagnostic) bool {
+	return d.Line < other.Line || d.Line == other.Line && d.Column < other.Column
+}
+
+//sortByPosition orders the diagnostics of a file found by different stages by their positions
+func (l DiagnosticList) sortByPosition() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].before(l[j])
+	})
+}
+
+//inFile fills the file of diagnostics reported by stages which don't know the source file
+func (l DiagnosticList) inFile(file string) DiagnosticList {
+	for _, d := range l {
+		if len(d.File) == 0 {
+			d.File = file
+		}
+	}
+	return l
+}
@@ -0,0 +1,78 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnostic_Error(t *testing.T) {
+	d := newDiagnostic(CodeUndeclaredVar, 12, 5, "undefined var x", "declare x first")
+	d.File = "Main.jack"
+	assert.Equal(t, "Main.jack:12:5: error JACK0021: undefined var x\n\thint: declare x first", d.Error())
+
+	d = newDiagnostic(CodeReadError, 0, 0, "no such file")
+	assert.Equal(t, "error JACK0001: no such file", d.Error())
+}
+
+func TestDiagnosticList_Err(t *testing.T) {
+	var l DiagnosticList
+	assert.Nil(t, l.Err())
+	warning := newDiagnostic(CodeSyntaxError, 1, 1, "warn")
+	warning.Severity = SeverityWarning
+	l.Add(warning)
+	assert.Nil(t, l.Err())
+	l.AddError(newDiagnostic(CodeSyntaxError, 2, 1, "err"), CodeSyntaxError)
+	assert.NotNil(t, l.Err())
+	assert.Len(t, l, 2)
+}
+
+func TestCompileFile_ReportsAllErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jack")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "Main.jack")
+	assert.Nil(t, ioutil.WriteFile(source, []byte(`class Main {
+	field int x, x;
+	function void main() {
+		var int i;
+		let j = i + k;
+		do Output.printInt(a[0]);
+		return;
+	}
+}`), 0644))
+
+	err = CompileFile(source, dir)
+	list, ok := err.(DiagnosticList)
+	assert.True(t, ok)
+	var actual [][]interface{}
+	for _, d := range list {
+		assert.Equal(t, source, d.File)
+		actual = append(actual, []interface{}{d.Code, d.Line, d.Column})
+	}
+	assert.Equal(t, [][]interface{}{
+		{CodeRedeclaredVar, 2, 15},
+		{CodeUndeclaredVar, 5, 15},
+		{CodeUndeclaredVar, 5, 7},
+		{CodeUndeclaredVar, 6, 22},
+	}, actual)
+	_, err = os.Stat(filepath.Join(dir, "Main.vm"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCompileFile_SyntaxError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jack")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "Main.jack")
+	assert.Nil(t, ioutil.WriteFile(source, []byte("class Main {\n\tfunction void main() {\n\t\tlet x = 1\n\t}\n}"), 0644))
+
+	err = CompileFile(source, dir)
+	list, ok := err.(DiagnosticList)
+	assert.True(t, ok)
+	assert.Len(t, list, 1)
+	assert.Equal(t, source+":4:2: error JACK0012: unexpected symbol '}', expected ';'", list[0].Error())
+}
@@ -0,0 +1,236 @@
+package compiler
+
+import (
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//constant is the 16 bits value of a constant term, booleans are -1 for true and 0 for false as in the vm
+type constant struct {
+	val     int16
+	boolean bool
+}
+
+//constValue returns the value of an integer, true, false or a negated integer,
+//null and strings are objects which are never folded
+func constValue(term ast.Term) (constant, bool) {
+	switch t := term.(type) {
+	case ast.ConstTerm:
+		switch t.Kind {
+		case ast.IntegerConst:
+			return constant{val: int16(t.Val.(int))}, true
+		case ast.KeywordConst:
+			switch t.Val {
+			case "true":
+				return constant{val: -1, boolean: true}, true
+			case "false":
+				return constant{val: 0, boolean: true}, true
+			}
+		}
+	case ast.UnaryTerm:
+		if c, ok := constValue(t.Term); ok && t.Operator == "-" && !c.boolean {
+			return constant{val: -c.val}, true
+		}
+	}
+	return constant{}, false
+}
+
+func isIntConst(term ast.Term, val int16) bool {
+	c, ok := constValue(term)
+	return ok && !c.boolean && c.val == val
+}
+
+//constTerm is the term of a folded value at pos, a negative integer is a negated constant
+//since the vm only pushes constants from 0 to 32767, -32768 can't be a term
+func constTerm(c constant, pos ast.Pos) (ast.Term, bool) {
+	switch {
+	case c.boolean && c.val != 0:
+		return ast.ConstTerm{Kind: ast.KeywordConst, Val: "true", Pos: pos}, true
+	case c.boolean:
+		return ast.ConstTerm{Kind: ast.KeywordConst, Val: "false", Pos: pos}, true
+	case c.val == -32768:
+		return nil, false
+	case c.val < 0:
+		return ast.UnaryTerm{Operator: "-", Term: ast.ConstTerm{Kind: ast.IntegerConst, Val: int(-c.val), Pos: pos}, Pos: pos}, true
+	}
+	return ast.ConstTerm{Kind: ast.IntegerConst, Val: int(c.val), Pos: pos}, true
+}
+
+//fold applies an operator of jack to constants with the 16 bits wraparound of the hack platform,
+//the division truncates toward zero as Math.divide and is not folded by zero
+func fold(op string, x constant, y constant) (constant, bool) {
+	switch op {
+	case "+":
+		return constant{val: x.val + y.val}, true
+	case "-":
+		return constant{val: x.val - y.val}, true
+	case "*":
+		return constant{val: x.val * y.val}, true
+	case "/":
+		if y.val == 0 || (x.val == -32768 && y.val == -1) {
+			return constant{}, false
+		}
+		return constant{val: x.val / y.val}, true
+	case "&":
+		return constant{val: x.val & y.val, boolean: x.boolean && y.boolean}, true
+	case "|":
+		return constant{val: x.val | y.val, boolean: x.boolean && y.boolean}, true
+	case "<":
+		return constant{val: boolValue(x.val < y.val), boolean: true}, true
+	case ">":
+		return constant{val: boolValue(x.val > y.val), boolean: true}, true
+	case "=":
+		return constant{val: boolValue(x.val == y.val), boolean: true}, true
+	}
+	return constant{}, false
+}
+
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+//pure terms have no side effects, so they can be dropped when their value doesn't matter
+func pure(node ast.Node) bool {
+	pure := true
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(ast.SubroutineCall); ok {
+			pure = false
+		}
+		return pure
+	})
+	return pure
+}
+
+//powerOfTwo returns k of a constant 2^k with k > 0
+func powerOfTwo(term ast.Term) (int, bool) {
+	c, ok := constValue(term)
+	if !ok || c.boolean || c.val < 2 || c.val&(c.val-1) != 0 {
+		return 0, false
+	}
+	k := 0
+	for v := c.val; v > 1; v >>= 1 {
+		k++
+	}
+	return k, true
+}
+
+//foldClass folds the constant expressions of a class and simplifies the identities x + 0, x - 0, x * 1, x / 1 and x * 0,
+//the operations are still applied from left to right and the calls are always kept
+func foldClass(jc ast.Class) ast.Class {
+	subroutines := make([]ast.Subroutine, len(jc.Subroutines))
+	for i, sub := range jc.Subroutines {
+		sub.Statements = foldStatements(sub.Statements)
+		subroutines[i] = sub
+	}
+	jc.Subroutines = subroutines
+	return jc
+}
+
+func foldStatements(statements []ast.Statement) []ast.Statement {
+	var folded []ast.Statement
+	for _, st := range statements {
+		switch s := st.(type) {
+		case ast.IfStatement:
+			s.Condition = foldExpression(s.Condition)
+			s.Statements = foldStatements(s.Statements)
+			s.ElseStatements = foldStatements(s.ElseStatements)
+			st = s
+		case ast.WhileStatement:
+			s.Condition = foldExpression(s.Condition)
+			s.Statements = foldStatements(s.Statements)
+			st = s
+		case ast.LetStatement:
+			s.Target = foldTerm(s.Target).(ast.ReferenceTerm)
+			s.Expression = foldExpression(s.Expression)
+			st = s
+		case ast.DoStatement:
+			s.Action = foldTerm(s.Action).(ast.SubroutineCall)
+			st = s
+		case ast.ReturnStatement:
+			s.Expression = foldExpression(s.Expression)
+			st = s
+		}
+		folded = append(folded, st)
+	}
+	return folded
+}
+
+func foldTerm(term ast.Term) ast.Term {
+	switch t := term.(type) {
+	case ast.Expression:
+		exp := foldExpression(t)
+		if len(exp.Terms) == 1 {
+			return exp.Terms[0] //(x)
+		}
+		return exp
+	case ast.UnaryTerm:
+		t.Term = foldTerm(t.Term)
+		if c, ok := constValue(t.Term); ok {
+			if t.Operator == "~" {
+				c.val = ^c.val
+			} else {
+				c = constant{val: -c.val}
+			}
+			if folded, ok := constTerm(c, t.Pos); ok {
+				return folded
+			}
+		}
+		return t
+	case ast.ReferenceTerm:
+		t.Index = foldExpression(t.Index)
+		return t
+	case ast.SubroutineCall:
+		args := make([]ast.Expression, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = foldExpression(arg)
+		}
+		t.Args = args
+		return t
+	}
+	return term
+}
+
+func foldExpression(exp ast.Expression) ast.Expression {
+	if exp.IsEmpty() {
+		return exp
+	}
+	folded := ast.Expression{Terms: []ast.Term{foldTerm(exp.Terms[0])}}
+	for i, op := range exp.Operations {
+		right := foldTerm(exp.Terms[i+1])
+		if len(folded.Terms) == 1 {
+			left := folded.Terms[0]
+			x, xok := constValue(left)
+			y, yok := constValue(right)
+			if xok && yok {
+				if c, ok := fold(op, x, y); ok {
+					if term, ok := constTerm(c, left.Position()); ok {
+						folded.Terms[0] = term
+						continue
+					}
+				}
+			}
+			switch {
+			case op == "+" && isIntConst(left, 0), op == "*" && isIntConst(left, 1): //0 + x, 1 * x
+				folded.Terms[0] = right
+				continue
+			case op == "*" && isIntConst(left, 0) && pure(right): //0 * x
+				continue
+			case op == "*" && xok && !yok: //c * x is x * c, so that x * 2^k can be doubled
+				folded.Terms = []ast.Term{right}
+				right = left
+			}
+		}
+		switch {
+		case (op == "+" || op == "-") && isIntConst(right, 0), (op == "*" || op == "/") && isIntConst(right, 1):
+			continue
+		case op == "*" && isIntConst(right, 0) && pure(folded):
+			folded = ast.Expression{Terms: []ast.Term{ast.ConstTerm{Kind: ast.IntegerConst, Val: 0, Pos: folded.Position()}}}
+			continue
+		}
+		folded.Terms = append(folded.Terms, right)
+		folded.Operations = append(folded.Operations, op)
+	}
+	return folded
+}
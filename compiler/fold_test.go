@@ -0,0 +1,140 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//compileOptimized compiles `let y = exp;` in a function with the optimizations, returns the vm code of the let statement
+func compileOptimized(t *testing.T, exp string) []string {
+	jc, diagnostics := Parse("Main.jack", []byte(fmt.Sprintf(`class Main {
+	function int f() {
+		return 1;
+	}
+
+	function void main() {
+		var int x, y;
+		var boolean b;
+		let y = %s;
+		return;
+	}
+}`, exp)))
+	assert.Nil(t, diagnostics)
+	outputs, diagnostics := Compile([]*ast.Class{jc}, Options{Optimize: 1, NoInline: true})
+	assert.Nil(t, diagnostics.Err()) //Main.f is removed if not called
+	code := strings.Split(string(outputs["Main.vm"]), "\n")
+	for i, line := range code {
+		if line == "function Main.main 3" {
+			return code[i+1 : len(code)-2]
+		}
+	}
+	return nil
+}
+
+func TestFoldConstants(t *testing.T) {
+	cases := map[string][]string{
+		"1 + (2 * 3)":     {"push constant 7"},
+		"2 + 3 * 4":       {"push constant 20"},
+		"10 - 20":         {"push constant 10", "neg"},
+		"-(3 - 5)":        {"push constant 2"},
+		"7 / 2":           {"push constant 3"},
+		"-7 / 2":          {"push constant 3", "neg"},
+		"200 * 200":       {"push constant 25536", "neg"},
+		"32767 * 2":       {"push constant 2", "neg"},
+		"~0":              {"push constant 1", "neg"},
+		"12 & 10 | 1":     {"push constant 9"},
+		"~true":           {"push constant 0"},
+		"1 < 2":           {"push constant 1", "neg"},
+		"(3 = 3) & false": {"push constant 0"},
+		"x + (2 * 0)":     {"push local 0"},
+		"(1 + 1) + x":     {"push constant 2", "push local 0", "add"},
+	}
+	for exp, code := range cases {
+		assert.Equal(t, append(code, "pop local 1"), compileOptimized(t, exp), exp)
+	}
+}
+
+//the values which can't be pushed or computed are left to the vm
+func TestFoldConstants_NotFolded(t *testing.T) {
+	assert.Equal(t, []string{"push constant 32767", "push constant 1", "add", "pop local 1"}, compileOptimized(t, "32767 + 1"))
+	assert.Equal(t, []string{"push constant 1", "push constant 0", "call Math.divide 2", "pop local 1"}, compileOptimized(t, "1 / 0"))
+	assert.Equal(t, []string{"push constant 0", "call Main.f 0", "sub", "pop local 1"}, compileOptimized(t, "0 - Main.f()"))
+}
+
+func TestFoldIdentities(t *testing.T) {
+	cases := map[string][]string{
+		"x + 0":             {"push local 0"},
+		"0 + x":             {"push local 0"},
+		"x - 0":             {"push local 0"},
+		"x * 1":             {"push local 0"},
+		"1 * x":             {"push local 0"},
+		"x / 1":             {"push local 0"},
+		"x * 0":             {"push constant 0"},
+		"0 * (x + y)":       {"push constant 0"},
+		"x + 0 - 0 * 1 + y": {"push local 0", "push local 1", "add"},
+		//the calls are kept even if their values don't matter
+		"Main.f() * 0": {"call Main.f 0", "push constant 0", "call Math.multiply 2"},
+		"0 * Main.f()": {"call Main.f 0", "push constant 0", "call Math.multiply 2"},
+	}
+	for exp, code := range cases {
+		assert.Equal(t, append(code, "pop local 1"), compileOptimized(t, exp), exp)
+	}
+}
+
+func TestFoldPowersOfTwo(t *testing.T) {
+	doubled := []string{"pop temp 1", "push temp 1", "push temp 1", "add"}
+	assert.Equal(t, append(append([]string{"push local 0"}, doubled...), "pop local 1"), compileOptimized(t, "x * 2"))
+	assert.Equal(t, append(append(append(append([]string{"push local 1"}, doubled...), doubled...), doubled...), "pop local 1"),
+		compileOptimized(t, "8 * y"))
+	assert.Equal(t, []string{"push local 0", "push constant 4", "call Math.divide 2", "pop local 1"}, compileOptimized(t, "x / 4"))
+	assert.Equal(t, []string{"push local 0", "push constant 6", "call Math.multiply 2", "pop local 1"}, compileOptimized(t, "x * 6"))
+}
+
+const foldedPrograms = `class Main {
+	function void main() {
+		var int x, y;
+		let x = -3;
+		let y = 1000;
+		do Main.print(x * 8);
+		do Main.print(y * 64);
+		do Main.print(16384 * 2 + x);
+		do Main.print(-32767 - 1 / 1 + y);
+		do Main.print(x * 4 / 2 + (0 * y) - (y * 0));
+		do Main.print(~(x < y) | (3 > 2));
+		do Main.print(2 * (x + y) * 1 - 0);
+		do Main.print(Main.count() * 0 + Main.count() * 16);
+		return;
+	}
+
+	function int count() {
+		var int c;
+		let c = c + 1;
+		return c;
+	}
+
+	function void print(int v) {
+		do Output.printInt(v);
+		do Output.printChar(32);
+		return;
+	}
+}`
+
+//the folded programs print the same as the ones compiled without optimizations
+func TestFoldConstants_Semantics(t *testing.T) {
+	jc, diagnostics := Parse("Main.jack", []byte(foldedPrograms))
+	assert.Nil(t, diagnostics)
+	plain, diagnostics := Compile([]*ast.Class{jc}, Options{})
+	assert.Nil(t, diagnostics)
+	optimized, diagnostics := Compile([]*ast.Class{jc}, Options{Optimize: 1})
+	assert.Nil(t, diagnostics)
+
+	expected, steps := runProgram(t, plain)
+	assert.Equal(t, "-24 -1536 32765 -31768 -6 -1 1994 16 ", expected)
+	actual, optimizedSteps := runProgram(t, optimized)
+	assert.Equal(t, expected, actual)
+	assert.Less(t, optimizedSteps, steps)
+}
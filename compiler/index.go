@@ -0,0 +1,152 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//programIndex knows the declarations and subroutine signatures of all the classes of a program,
+//including the standard OS classes, so that calls can be resolved across files
+type programIndex struct {
+	classes map[string]*classInfo
+}
+
+type classInfo struct {
+	name         string
+	declarations []ast.Variable //fields and statics
+	subroutines  map[string]ast.Subroutine
+	builtin      bool //OS class, only the signatures of its subroutines are known
+}
+
+func (ci *classInfo) subroutine(name string) (ast.Subroutine, bool) {
+	sub, ok := ci.subroutines[name]
+	return sub, ok
+}
+
+func newClassInfo(jc ast.Class, builtin bool) *classInfo {
+	ci := &classInfo{
+		name:         jc.Name,
+		declarations: jc.Declarations,
+		subroutines:  map[string]ast.Subroutine{},
+		builtin:      builtin,
+	}
+	for _, sub := range jc.Subroutines {
+		ci.subroutines[sub.Name] = sub
+	}
+	return ci
+}
+
+//newProgramIndex keeps the first declaration of a class declared more than once
+func newProgramIndex(classes []ast.Class) *programIndex {
+	idx := &programIndex{classes: map[string]*classInfo{}}
+	for _, jc := range osClasses {
+		idx.classes[jc.Name] = newClassInfo(jc, true)
+	}
+	for _, jc := range classes {
+		if ci, ok := idx.classes[jc.Name]; ok && !ci.builtin {
+			continue
+		}
+		idx.classes[jc.Name] = newClassInfo(jc, false)
+	}
+	return idx
+}
+
+func (idx *programIndex) class(name string) (*classInfo, bool) {
+	ci, ok := idx.classes[name]
+	return ci, ok
+}
+
+func (idx *programIndex) lookup(class string, name string) (ast.Subroutine, bool) {
+	ci, ok := idx.class(class)
+	if !ok {
+		return emptySubroutine, false
+	}
+	return ci.subroutine(name)
+}
+
+//signatures of the jack OS classes, parsed with the compiler itself
+var osAPI = []string{`
+class Math {
+	function void init() {}
+	function int abs(int x) {}
+	function int multiply(int x, int y) {}
+	function int divide(int x, int y) {}
+	function int min(int x, int y) {}
+	function int max(int x, int y) {}
+	function int sqrt(int x) {}
+}`, `
+class String {
+	constructor String new(int maxLength) {}
+	method void dispose() {}
+	method int length() {}
+	method char charAt(int j) {}
+	method void setCharAt(int j, char c) {}
+	method String appendChar(char c) {}
+	method void eraseLastChar() {}
+	method int intValue() {}
+	method void setInt(int val) {}
+	function char backSpace() {}
+	function char doubleQuote() {}
+	function char newLine() {}
+}`, `
+class Array {
+	function Array new(int size) {}
+	method void dispose() {}
+}`, `
+class Output {
+	function void init() {}
+	function void moveCursor(int i, int j) {}
+	function void printChar(char c) {}
+	function void printString(String s) {}
+	function void printInt(int i) {}
+	function void println() {}
+	function void backSpace() {}
+}`, `
+class Screen {
+	function void init() {}
+	function void clearScreen() {}
+	function void setColor(boolean b) {}
+	function void drawPixel(int x, int y) {}
+	function void drawLine(int x1, int y1, int x2, int y2) {}
+	function void drawRectangle(int x1, int y1, int x2, int y2) {}
+	function void drawCircle(int x, int y, int r) {}
+}`, `
+class Keyboard {
+	function void init() {}
+	function char keyPressed() {}
+	function char readChar() {}
+	function String readLine(String message) {}
+	function int readInt(String message) {}
+}`, `
+class Memory {
+	function void init() {}
+	function int peek(int address) {}
+	function void poke(int address, int value) {}
+	function Array alloc(int size) {}
+	function void deAlloc(Array o) {}
+}`, `
+class Sys {
+	function void init() {}
+	function void halt() {}
+	function void error(int errorCode) {}
+	function void wait(int duration) {}
+}`}
+
+var osClasses = parseOSClasses()
+
+func parseOSClasses() []ast.Class {
+	var classes []ast.Class
+	for _, src := range osAPI {
+		tokenizer := &tokenizer{}
+		if err := tokenizer.Tokenize(strings.NewReader(src)); err != nil {
+			panic(err)
+		}
+		jc, diagnostics := parseTokens(tokenizer.tokens)
+		if err := diagnostics.Err(); err != nil {
+			panic(err)
+		}
+		classes = append(classes, jc)
+	}
+	return classes
+}
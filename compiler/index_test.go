@@ -0,0 +1,117 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+func TestProgramIndex(t *testing.T) {
+	main := parseSource(t, `
+class Main {
+	static int count;
+	function void main() {
+		return;
+	}
+}`)
+	index := newProgramIndex([]ast.Class{main})
+
+	sub, ok := index.lookup("Main", "main")
+	assert.True(t, ok)
+	assert.Equal(t, ast.Function, sub.Category)
+
+	sub, ok = index.lookup("String", "appendChar")
+	assert.True(t, ok)
+	assert.Equal(t, ast.Method, sub.Category)
+	assert.Equal(t, "String", sub.RetType)
+	assert.Len(t, sub.Params(), 1)
+
+	sub, ok = index.lookup("Screen", "drawRectangle")
+	assert.True(t, ok)
+	assert.Len(t, sub.Params(), 4)
+
+	_, ok = index.lookup("Output", "printLine")
+	assert.False(t, ok)
+
+	ci, ok := index.class("Main")
+	assert.True(t, ok)
+	assert.False(t, ci.builtin)
+	assert.Equal(t, "count", ci.declarations[0].Name)
+}
+
+func TestCompile_UnqualifiedFunctionCall(t *testing.T) {
+	code := compileSource(t, `
+class Main {
+	function void main() {
+		do run(1);
+		return;
+	}
+	function void run(int i) {
+		return;
+	}
+}`)
+	assert.Equal(t, `function Main.main 0
+push constant 1
+call Main.run 1
+pop temp 0
+push constant 0
+return
+function Main.run 0
+push constant 0
+return`, code)
+}
+
+func writeSources(t *testing.T, sources map[string]string) string {
+	dir, err := ioutil.TempDir("", "jack")
+	assert.Nil(t, err)
+	for name, src := range sources {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644))
+	}
+	return dir
+}
+
+func TestCompileDir_CrossClassCheck(t *testing.T) {
+	dir := writeSources(t, map[string]string{
+		"Main.jack": `class Main {
+	function void main() {
+		var Ball b;
+		let b = Ball.new();
+		do b.move(1);
+		do Output.printString("done", 1);
+		do Foo.bar();
+		return;
+	}
+}`,
+		"Ball.jack": `class Ball {
+	constructor Ball new() {
+		return this;
+	}
+	method void move() {
+		return;
+	}
+}`,
+		"Other.jack": `class Ball {
+}`,
+	})
+	defer os.RemoveAll(dir)
+
+	err := CompileDir(dir, dir)
+	list, ok := err.(DiagnosticList)
+	assert.True(t, ok)
+	var actual [][]interface{}
+	for _, d := range list {
+		actual = append(actual, []interface{}{filepath.Base(d.File), d.Severity, d.Code, d.Line})
+	}
+	assert.Equal(t, [][]interface{}{
+		{"Main.jack", SeverityError, CodeArgumentCount, 5},
+		{"Main.jack", SeverityError, CodeArgumentCount, 6},
+		{"Main.jack", SeverityWarning, CodeUnknownClass, 7},
+		{"Other.jack", SeverityError, CodeRedeclaredClass, 1},
+	}, actual)
+	_, err = os.Stat(filepath.Join(dir, "Ball.vm"))
+	assert.Nil(t, err)
+}
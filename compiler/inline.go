@@ -0,0 +1,199 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
+)
+
+//inlineThreshold is the size of the largest subroutine inlined, counted in the nodes of its statements,
+//e.g. `return x;` of an accessor is 3 nodes
+const inlineThreshold = 16
+
+func size(statements []ast.Statement) int {
+	n := 0
+	for _, st := range statements {
+		ast.Inspect(st, func(node ast.Node) bool {
+			if node != nil {
+				n++
+			}
+			return true
+		})
+	}
+	return n
+}
+
+//newLocal allocates a free local slot in the frame of the vm function
+func (c *subRoutineCompiler) newLocal() int {
+	slot := c.frame.free
+	c.frame.free++
+	if c.frame.free > c.frame.locals {
+		c.frame.locals = c.frame.free
+	}
+	return slot
+}
+
+//recursive reports whether a subroutine of the program calls itself, directly or through the other subroutines
+func (idx *programIndex) recursive(name string) bool {
+	visited := map[string]bool{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		parts := strings.SplitN(f, ".", 2)
+		ci, ok := idx.class(parts[0])
+		if !ok || ci.builtin || visited[f] {
+			continue
+		}
+		visited[f] = true
+		sub, ok := ci.subroutine(parts[1])
+		if !ok {
+			continue
+		}
+		r := &referenceResolver{class: ast.Class{Name: ci.name, Declarations: ci.declarations}, sub: sub}
+		for _, st := range sub.Statements {
+			ast.Inspect(st, func(node ast.Node) bool {
+				if call, ok := node.(ast.SubroutineCall); ok {
+					queue = append(queue, r.callee(call))
+				}
+				return true
+			})
+		}
+		for _, callee := range queue {
+			if callee == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//usesStatics reports whether the body of a subroutine uses the static variables of its class
+func usesStatics(ci *classInfo, sub ast.Subroutine, body []ast.Statement) bool {
+	isStatic := func(name string) bool {
+		for _, dec := range sub.Declarations {
+			if dec.Name == name {
+				return false
+			}
+		}
+		for _, dec := range ci.declarations {
+			if dec.Name == name {
+				return dec.Kind == ast.Static
+			}
+		}
+		return false
+	}
+	uses := false
+	for _, st := range body {
+		ast.Inspect(st, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case ast.ReferenceTerm:
+				uses = uses || isStatic(n.VarName)
+			case ast.SubroutineCall:
+				uses = uses || isStatic(n.Target)
+			}
+			return !uses
+		})
+	}
+	return uses
+}
+
+//inlineSubCall replaces a call by the body of a small function or method of the program, it's never done for
+//constructors, recursive subroutines, and subroutines using the static variables of another class since statics belong to a vm file.
+//The arguments are evaluated as for the call and stored in fresh local slots of the caller with the locals of the callee,
+//the object of a method is 'this' for the body and the one of the caller is restored after it.
+//The slots are free again after the body, so the calls inlined one after another share them
+func (c *subRoutineCompiler) inlineSubCall(call ast.SubroutineCall) ([]ir.Instruction, bool) {
+	if !c.parent.inline {
+		return nil, false
+	}
+	className := c.class.Name
+	var target *variable
+	if len(call.Target) > 0 {
+		className = call.Target
+		if v, ok := c.table.getRecursively(call.Target); ok {
+			className, target = v.Type, &v
+		}
+	}
+	ci, ok := c.parent.index.class(className)
+	if !ok || ci.builtin {
+		return nil, false
+	}
+	callee, ok := ci.subroutine(call.Name)
+	if !ok || callee.Category == ast.Constructor || len(callee.Params()) != len(call.Args) {
+		return nil, false
+	}
+	name := fmt.Sprintf("%s.%s", className, call.Name)
+	if c.parent.index.recursive(name) {
+		return nil, false
+	}
+	body := foldStatements(reachableStatements(callee.Statements, nil))
+	if size(body) > inlineThreshold || (className != c.parent.class.Name && usesStatics(ci, callee, body)) {
+		return nil, false
+	}
+
+	var lines []ir.Instruction
+	//a method called without target keeps 'this' of the caller
+	switchThis := callee.Category == ast.Method && target != nil
+	if switchThis {
+		lines = append(lines, ir.Push(target.memSeg(), target.offset))
+	}
+	for _, arg := range call.Args {
+		lines = append(lines, c.compileExpression(arg)...)
+	}
+
+	classTable := NewClassSymbolTable()
+	for _, dec := range ci.declarations {
+		classTable.add(dec)
+	}
+	inlined := &subRoutineCompiler{
+		class:  ast.Class{Name: ci.name, Declarations: ci.declarations},
+		table:  NewSubroutineSymbolTable(classTable),
+		parent: c.parent,
+		frame:  c.frame,
+		ret:    fmt.Sprintf("INLINE_%d", c.parent.labelCounter),
+	}
+	c.parent.labelCounter++
+	free := c.frame.free
+	var args, locals []ir.Instruction
+	for _, dec := range callee.Declarations {
+		slot := c.newLocal()
+		inlined.table.addAt(ast.Variable{Name: dec.Name, Type: dec.Type, Kind: ast.Local, Pos: dec.Pos}, slot)
+		if dec.Kind == ast.Argument {
+			args = append(args, ir.Pop("local", slot))
+		} else {
+			locals = append(locals, ir.Push("constant", 0), ir.Pop("local", slot)) //locals start from 0 as in a vm function
+		}
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		lines = append(lines, args[i])
+	}
+	lines = append(lines, locals...)
+	var saved int
+	if switchThis {
+		saved = c.newLocal()
+		lines = append(lines, ir.Push("pointer", 0), ir.Pop("local", saved), ir.Pop("pointer", 0))
+	}
+
+	code := inlined.compileStatements(body)
+	jumps := 0
+	for i := range code {
+		code[i].Pos = ast.Pos{} //the inlined code is mapped to the call
+		if code[i] == ir.Goto(inlined.ret) {
+			jumps++
+		}
+	}
+	if jumps == 1 && code[len(code)-1] == ir.Goto(inlined.ret) { //the only return at the end
+		lines = append(lines, code[:len(code)-1]...)
+	} else {
+		lines = append(lines, code...)
+		lines = append(lines, ir.Label(inlined.ret))
+	}
+	if switchThis {
+		lines = append(lines, ir.Push("local", saved), ir.Pop("pointer", 0))
+	}
+	c.frame.free = free
+	return lines, true
+}
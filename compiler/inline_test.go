@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+var inlinedProgram = map[string]string{
+	"Main.jack": `class Main {
+	static int calls;
+
+	function void main() {
+		var Point p, q;
+		var int i;
+		let p = Point.new(3, 4);
+		let q = Point.new(10, 20);
+		do q.setX(p.getX() + q.getX());
+		do Main.print(q.getX());
+		do Main.print(p.sum());
+		do Main.print(Main.twice(Main.twice(5)));
+		do Main.print(Main.fact(5));
+		while (i < 3) {
+			do Main.print(Main.fresh());
+			do Main.print(Point.next());
+			let i = i + 1;
+		}
+		do Main.print(Main.sign(-7) + Main.sign(7));
+		do Main.print(calls);
+		return;
+	}
+
+	function int twice(int x) {
+		let calls = calls + 1;
+		return x + x;
+	}
+
+	function int fact(int n) {
+		if (n < 2) {
+			return 1;
+		}
+		return n * Main.fact(n - 1);
+	}
+
+	function int fresh() {
+		var int c;
+		let c = c + 1;
+		return c;
+	}
+
+	function int sign(int x) {
+		if (x < 0) {
+			return -1;
+		}
+		return 1;
+	}
+
+	function void print(int v) {
+		do Output.printInt(v);
+		do Output.printChar(32);
+		return;
+	}
+}`,
+	"Point.jack": `class Point {
+	field int x, y;
+	static int count;
+
+	constructor Point new(int ax, int ay) {
+		let x = ax;
+		let y = ay;
+		return this;
+	}
+
+	method int getX() {
+		return x;
+	}
+
+	method void setX(int ax) {
+		let x = ax;
+		return;
+	}
+
+	method int sum() {
+		return getX() + y;
+	}
+
+	function int next() {
+		let count = count + 1;
+		return count;
+	}
+}`,
+}
+
+func compileInlined(t *testing.T, opts Options) map[string][]byte {
+	var classes []*ast.Class
+	for _, file := range []string{"Main.jack", "Point.jack"} {
+		jc, diagnostics := Parse(file, []byte(inlinedProgram[file]))
+		assert.Nil(t, diagnostics)
+		classes = append(classes, jc)
+	}
+	outputs, diagnostics := Compile(classes, opts)
+	assert.Nil(t, diagnostics)
+	return outputs
+}
+
+func TestInline(t *testing.T) {
+	outputs := compileInlined(t, Options{Optimize: 1})
+	main := string(outputs["Main.vm"])
+	for _, call := range []string{"call Point.getX", "call Point.setX", "call Point.sum", "call Main.twice", "call Main.fresh", "call Main.sign"} {
+		assert.NotContains(t, main, call)
+	}
+	assert.Contains(t, main, "call Point.new 2")     //constructor
+	assert.Contains(t, main, "call Main.fact 1")     //recursive
+	assert.Contains(t, main, "call Point.next 0")    //statics of Point
+	assert.Contains(t, main, "function Main.main 5") //3 locals and the slots of the subroutines inlined
+	//getX on 'this' of sum
+	assert.NotContains(t, string(outputs["Point.vm"]), "call Point.getX")
+
+	plain := compileInlined(t, Options{})
+	expected, steps := runProgram(t, plain)
+	assert.Equal(t, "13 7 20 120 1 1 1 2 1 3 0 2 ", expected)
+	actual, inlinedSteps := runProgram(t, outputs)
+	assert.Equal(t, expected, actual)
+
+	notInlined := compileInlined(t, Options{Optimize: 1, NoInline: true})
+	assert.Contains(t, string(notInlined["Main.vm"]), "call Point.getX 1")
+	actual, notInlinedSteps := runProgram(t, notInlined)
+	assert.Equal(t, expected, actual)
+	assert.Less(t, inlinedSteps, notInlinedSteps)
+	assert.LessOrEqual(t, notInlinedSteps, steps)
+}
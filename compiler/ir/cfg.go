@@ -0,0 +1,153 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+//Block is a basic block, its instructions are only entered at the first one and only left after the last one
+type Block struct {
+	ID           int //index of the block in its function
+	Instructions []Instruction
+	Succs        []*Block
+	Preds        []*Block
+}
+
+//Function is a vm function with the control flow graph of its blocks, the first block is the entry
+type Function struct {
+	Name   string
+	Blocks []*Block
+}
+
+//Instructions returns the instructions of the blocks in order
+func (f *Function) Instructions() []Instruction {
+	var insts []Instruction
+	for _, b := range f.Blocks {
+		insts = append(insts, b.Instructions...)
+	}
+	return insts
+}
+
+//Build splits the instructions of a vm file into its functions and the functions into basic blocks,
+//a block starts at a function, a label or after a jump, and ends before a label or with a jump.
+//The blocks are connected by the jumps and the fall throughs, a return has no successor
+func Build(insts []Instruction) []*Function {
+	var funcs []*Function
+	var f *Function
+	var b *Block
+	for _, inst := range insts {
+		if inst.Op == OpFunction || f == nil {
+			f = &Function{Name: inst.Callee}
+			funcs = append(funcs, f)
+			b = nil
+		}
+		if inst.Op == OpLabel && b != nil && len(b.Instructions) > 0 {
+			b = nil
+		}
+		if b == nil {
+			b = &Block{ID: len(f.Blocks)}
+			f.Blocks = append(f.Blocks, b)
+		}
+		b.Instructions = append(b.Instructions, inst)
+		if inst.Op.IsJump() {
+			b = nil
+		}
+	}
+	for _, f := range funcs {
+		f.connect()
+	}
+	return funcs
+}
+
+func (f *Function) connect() {
+	labels := map[string]*Block{}
+	for _, b := range f.Blocks {
+		if first := b.Instructions[0]; first.Op == OpLabel {
+			labels[first.Label] = b
+		}
+	}
+	for i, b := range f.Blocks {
+		last := b.Instructions[len(b.Instructions)-1]
+		var succs []*Block
+		if last.Op == OpGoto || last.Op == OpIfGoto {
+			if target, ok := labels[last.Label]; ok {
+				succs = append(succs, target)
+			}
+		}
+		//an if-goto to the label right after it is one edge
+		if last.Op != OpGoto && last.Op != OpReturn && i+1 < len(f.Blocks) && (len(succs) == 0 || succs[0] != f.Blocks[i+1]) {
+			succs = append(succs, f.Blocks[i+1])
+		}
+		for _, s := range succs {
+			b.Succs = append(b.Succs, s)
+			s.Preds = append(s.Preds, b)
+		}
+	}
+}
+
+//edges shows the blocks of edges after an arrow, nothing if there is none
+func edges(arrow string, blocks []*Block) string {
+	s := ""
+	for i, b := range blocks {
+		if i == 0 {
+			s += " " + arrow
+		}
+		s += fmt.Sprintf(" B%d", b.ID)
+	}
+	return s
+}
+
+//Dump prints the blocks of the functions with their predecessors and successors, and the source positions
+//of the instructions, e.g. `B3 <- B1 B2 -> B5 B4` before the instructions of B3
+func Dump(funcs []*Function) string {
+	var sb strings.Builder
+	for _, f := range funcs {
+		sb.WriteString(fmt.Sprintf("%s:\n", f.Name))
+		for _, b := range f.Blocks {
+			sb.WriteString(fmt.Sprintf("B%d%s%s\n", b.ID, edges("<-", b.Preds), edges("->", b.Succs)))
+			for _, inst := range b.Instructions {
+				line := "  " + inst.String()
+				if inst.Pos.Line > 0 {
+					line = fmt.Sprintf("%-32s //%d:%d", line, inst.Pos.Line, inst.Pos.Column)
+				}
+				sb.WriteString(line + "\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+//Dot prints the control flow graphs of the functions in the dot language of graphviz, one cluster for each function,
+//e.g. `dot -Tsvg Main.dot -o Main.svg`. The edge of a conditional jump taken is labeled true
+func Dot(name string, funcs []*Function) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("digraph \"%s\" {\n", name))
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	node := func(f *Function, b *Block) string {
+		return fmt.Sprintf("\"%s.B%d\"", f.Name, b.ID)
+	}
+	for i, f := range funcs {
+		sb.WriteString(fmt.Sprintf("  subgraph cluster_%d {\n    label=\"%s\";\n", i, f.Name))
+		for _, b := range f.Blocks {
+			label := fmt.Sprintf("B%d\\l", b.ID)
+			for _, inst := range b.Instructions {
+				label += inst.String() + "\\l"
+			}
+			sb.WriteString(fmt.Sprintf("    %s [label=\"%s\"];\n", node(f, b), label))
+		}
+		for _, b := range f.Blocks {
+			last := b.Instructions[len(b.Instructions)-1]
+			for j, s := range b.Succs {
+				attrs := ""
+				if last.Op == OpIfGoto && len(b.Succs) == 2 {
+					attrs = []string{" [label=\"true\"]", " [label=\"false\"]"}[j]
+				}
+				sb.WriteString(fmt.Sprintf("    %s -> %s%s;\n", node(f, b), node(f, s), attrs))
+			}
+		}
+		sb.WriteString("  }\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package ir
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//`if (x) { let x = 0; } return x;` of Main.f and `return 1;` of Main.g
+var program = `function Main.f 0
+push argument 0
+if-goto IF_0
+goto ENDIF_0
+label IF_0
+push constant 0
+pop argument 0
+label ENDIF_0
+push argument 0
+return
+function Main.g 0
+push constant 1
+return`
+
+func parseProgram(t *testing.T) []Instruction {
+	var insts []Instruction
+	for _, line := range strings.Split(program, "\n") {
+		inst, err := Parse(line)
+		assert.Nil(t, err)
+		insts = append(insts, inst)
+	}
+	return insts
+}
+
+func ids(blocks []*Block) []int {
+	var ids []int
+	for _, b := range blocks {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+func TestBuild(t *testing.T) {
+	insts := parseProgram(t)
+	funcs := Build(insts)
+	assert.Equal(t, 2, len(funcs))
+	f := funcs[0]
+	assert.Equal(t, "Main.f", f.Name)
+	assert.Equal(t, 4, len(f.Blocks))
+	assert.Equal(t, []Instruction{Label("IF_0"), Push("constant", 0), Pop("argument", 0)}, f.Blocks[2].Instructions)
+	assert.Equal(t, []int{2, 1}, ids(f.Blocks[0].Succs)) //jumped to, then fallen through
+	assert.Equal(t, []int{3}, ids(f.Blocks[1].Succs))
+	assert.Equal(t, []int{3}, ids(f.Blocks[2].Succs))
+	assert.Equal(t, []int{1, 2}, ids(f.Blocks[3].Preds))
+	assert.Nil(t, f.Blocks[3].Succs)
+	assert.Equal(t, "Main.g", funcs[1].Name)
+	assert.Equal(t, 1, len(funcs[1].Blocks))
+
+	//the blocks keep all the instructions in order
+	var all []Instruction
+	for _, f := range funcs {
+		all = append(all, f.Instructions()...)
+	}
+	assert.Equal(t, insts, all)
+}
+
+//the jump and the fall through of `if-goto L` right before `label L` are the same edge
+func TestBuild_JumpToNext(t *testing.T) {
+	funcs := Build([]Instruction{Func("Main.h", 0), Push("argument", 0), IfGoto("L"), Label("L"), Return()})
+	f := funcs[0]
+	assert.Equal(t, 2, len(f.Blocks))
+	assert.Equal(t, []int{1}, ids(f.Blocks[0].Succs))
+	assert.Equal(t, []int{0}, ids(f.Blocks[1].Preds))
+	assert.Equal(t, 1, strings.Count(Dot("Main", funcs), " -> "))
+}
+
+func TestDump(t *testing.T) {
+	insts := parseProgram(t)
+	insts[len(insts)-1].Pos = ast.Pos{Line: 12, Column: 3}
+	assert.Equal(t, `Main.f:
+B0 -> B2 B1
+  function Main.f 0
+  push argument 0
+  if-goto IF_0
+B1 <- B0 -> B3
+  goto ENDIF_0
+B2 <- B0 -> B3
+  label IF_0
+  push constant 0
+  pop argument 0
+B3 <- B1 B2
+  label ENDIF_0
+  push argument 0
+  return
+
+Main.g:
+B0
+  function Main.g 0
+  push constant 1
+  return                         //12:3
+
+`, Dump(Build(insts)))
+}
+
+func TestDot(t *testing.T) {
+	dot := Dot("Main", Build(parseProgram(t)))
+	assert.True(t, strings.HasPrefix(dot, "digraph \"Main\" {\n"))
+	assert.Contains(t, dot, "  subgraph cluster_1 {\n    label=\"Main.g\";\n")
+	assert.Contains(t, dot, `    "Main.f.B1" [label="B1\lgoto ENDIF_0\l"];`)
+	assert.Contains(t, dot, `    "Main.f.B0" -> "Main.f.B2" [label="true"];`)
+	assert.Contains(t, dot, `    "Main.f.B0" -> "Main.f.B1" [label="false"];`)
+	assert.Contains(t, dot, `    "Main.f.B1" -> "Main.f.B3";`)
+	assert.Equal(t, 4, strings.Count(dot, " -> "))
+}
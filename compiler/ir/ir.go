@@ -0,0 +1,149 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//Op is the command of a vm instruction
+type Op string
+
+const (
+	OpPush     Op = "push"
+	OpPop      Op = "pop"
+	OpAdd      Op = "add"
+	OpSub      Op = "sub"
+	OpNeg      Op = "neg"
+	OpEq       Op = "eq"
+	OpGt       Op = "gt"
+	OpLt       Op = "lt"
+	OpAnd      Op = "and"
+	OpOr       Op = "or"
+	OpNot      Op = "not"
+	OpLabel    Op = "label"
+	OpGoto     Op = "goto"
+	OpIfGoto   Op = "if-goto"
+	OpFunction Op = "function"
+	OpCall     Op = "call"
+	OpReturn   Op = "return"
+)
+
+var arithmetic = []Op{OpAdd, OpSub, OpNeg, OpEq, OpGt, OpLt, OpAnd, OpOr, OpNot}
+
+func (op Op) IsArithmetic() bool {
+	for _, a := range arithmetic {
+		if a == op {
+			return true
+		}
+	}
+	return false
+}
+
+//IsJump reports whether the instruction may not continue with the next one
+func (op Op) IsJump() bool {
+	return op == OpGoto || op == OpIfGoto || op == OpReturn
+}
+
+//Instruction is a vm command with its typed arguments, only the ones of its op are set
+type Instruction struct {
+	Op      Op
+	Segment string  //push and pop
+	Index   int     //push and pop
+	Label   string  //label, goto and if-goto
+	Callee  string  //vm function name of call and function
+	NArgs   int     //arguments of call, locals of function
+	Pos     ast.Pos //position of the jack statement(or subroutine declaration) compiled from, empty if unknown
+}
+
+func Push(segment string, index int) Instruction {
+	return Instruction{Op: OpPush, Segment: segment, Index: index}
+}
+
+func Pop(segment string, index int) Instruction {
+	return Instruction{Op: OpPop, Segment: segment, Index: index}
+}
+
+func Arithmetic(op Op) Instruction {
+	return Instruction{Op: op}
+}
+
+func Label(label string) Instruction {
+	return Instruction{Op: OpLabel, Label: label}
+}
+
+func Goto(label string) Instruction {
+	return Instruction{Op: OpGoto, Label: label}
+}
+
+func IfGoto(label string) Instruction {
+	return Instruction{Op: OpIfGoto, Label: label}
+}
+
+func Func(name string, locals int) Instruction {
+	return Instruction{Op: OpFunction, Callee: name, NArgs: locals}
+}
+
+func Call(name string, args int) Instruction {
+	return Instruction{Op: OpCall, Callee: name, NArgs: args}
+}
+
+func Return() Instruction {
+	return Instruction{Op: OpReturn}
+}
+
+//String is the vm code of the instruction, e.g. `push local 0`
+func (i Instruction) String() string {
+	switch i.Op {
+	case OpPush, OpPop:
+		return fmt.Sprintf("%s %s %d", i.Op, i.Segment, i.Index)
+	case OpLabel, OpGoto, OpIfGoto:
+		return fmt.Sprintf("%s %s", i.Op, i.Label)
+	case OpFunction, OpCall:
+		return fmt.Sprintf("%s %s %d", i.Op, i.Callee, i.NArgs)
+	}
+	return string(i.Op)
+}
+
+//At returns the instruction at pos
+func (i Instruction) At(pos ast.Pos) Instruction {
+	i.Pos = pos
+	return i
+}
+
+//Parse parses a line of vm code without comments, e.g. `call Math.multiply 2`
+func Parse(line string) (Instruction, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Instruction{}, fmt.Errorf("empty instruction")
+	}
+	op := Op(fields[0])
+	arity := 0
+	switch {
+	case op == OpPush || op == OpPop || op == OpFunction || op == OpCall:
+		arity = 2
+	case op == OpLabel || op == OpGoto || op == OpIfGoto:
+		arity = 1
+	case op != OpReturn && !op.IsArithmetic():
+		return Instruction{}, fmt.Errorf("unknown instruction:%s", line)
+	}
+	if len(fields) != arity+1 {
+		return Instruction{}, fmt.Errorf("invalid instruction:%s", line)
+	}
+	if arity == 1 {
+		return Instruction{Op: op, Label: fields[1]}, nil
+	}
+	if arity == 2 {
+		n, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return Instruction{}, fmt.Errorf("invalid instruction:%s", line)
+		}
+		if op == OpPush || op == OpPop {
+			return Instruction{Op: op, Segment: fields[1], Index: n}, nil
+		}
+		return Instruction{Op: op, Callee: fields[1], NArgs: n}, nil
+	}
+	return Instruction{Op: op}, nil
+}
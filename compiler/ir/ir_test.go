@@ -0,0 +1,34 @@
+package ir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		line string
+		inst Instruction
+	}{
+		{"push constant 7", Push("constant", 7)},
+		{"pop that 0", Pop("that", 0)},
+		{"not", Arithmetic(OpNot)},
+		{"label END_WHILE_0", Label("END_WHILE_0")},
+		{"goto WHILE_0", Goto("WHILE_0")},
+		{"if-goto IF_1", IfGoto("IF_1")},
+		{"function Main.main 2", Func("Main.main", 2)},
+		{"call Math.multiply 2", Call("Math.multiply", 2)},
+		{"return", Return()},
+	}
+	for _, c := range cases {
+		inst, err := Parse(c.line)
+		assert.Nil(t, err)
+		assert.Equal(t, c.inst, inst)
+		assert.Equal(t, c.line, inst.String())
+	}
+	for _, line := range []string{"", "push constant", "pop local x", "shl", "return 1"} {
+		_, err := Parse(line)
+		assert.NotNil(t, err, line)
+	}
+}
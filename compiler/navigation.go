@@ -0,0 +1,315 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//Location is a span of a line in a jack file
+type Location struct {
+	File      string
+	Line      int
+	Column    int
+	EndColumn int //exclusive
+}
+
+//Completion is a candidate for completing the member of a class
+type Completion struct {
+	Label  string
+	Kind   string //constructor, function or method
+	Detail string //signature
+}
+
+//symbol is a declaration of a class, a subroutine or a variable
+type symbol struct {
+	detail string   //declaration shown on hover, e.g. `field int x`
+	decl   Location //empty file for the OS classes
+}
+
+//occurrence is a declaration or a reference of a symbol in a file
+type occurrence struct {
+	Location
+	key string
+}
+
+//symbolIndex knows where the symbols of a program are declared and referenced,
+//symbols are keyed by kind and qualified name, e.g. `class Main`, `sub Main.run`, `var Main.x`, `var Main.run.i`
+type symbolIndex struct {
+	program     *programIndex
+	symbols     map[string]symbol
+	occurrences map[string][]occurrence //by file
+}
+
+func newSymbolIndex(classes map[string]ast.Class) *symbolIndex {
+	var files []string
+	for file := range classes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var parsed []ast.Class
+	for _, file := range files {
+		parsed = append(parsed, classes[file])
+	}
+	si := &symbolIndex{
+		program:     newProgramIndex(parsed),
+		symbols:     map[string]symbol{},
+		occurrences: map[string][]occurrence{},
+	}
+	for _, ci := range si.program.classes {
+		if !ci.builtin {
+			continue
+		}
+		si.symbols[classKey(ci.name)] = symbol{detail: "class " + ci.name}
+		for _, sub := range ci.subroutines {
+			si.symbols[subKey(ci.name, sub.Name)] = symbol{detail: signature(ci.name, sub)}
+		}
+	}
+	for _, file := range files {
+		si.indexClass(file, classes[file])
+	}
+	return si
+}
+
+func classKey(class string) string {
+	return "class " + class
+}
+
+func subKey(class string, sub string) string {
+	return fmt.Sprintf("sub %s.%s", class, sub)
+}
+
+func varKey(scope string, name string) string {
+	return fmt.Sprintf("var %s.%s", scope, name)
+}
+
+//signature of a subroutine, e.g. `method int Point.distance(Point other)`
+func signature(class string, sub ast.Subroutine) string {
+	var params []string
+	for _, p := range sub.Params() {
+		params = append(params, fmt.Sprintf("%s %s", p.Type, p.Name))
+	}
+	return fmt.Sprintf("%s %s %s.%s(%s)", sub.Category, sub.RetType, class, sub.Name, strings.Join(params, ", "))
+}
+
+func (si *symbolIndex) declare(file string, key string, pos ast.Pos, name string, detail string) {
+	loc := Location{File: file, Line: pos.Line, Column: pos.Column, EndColumn: pos.Column + len(name)}
+	si.symbols[key] = symbol{detail: detail, decl: loc}
+	si.occurrences[file] = append(si.occurrences[file], occurrence{Location: loc, key: key})
+}
+
+func (si *symbolIndex) reference(file string, key string, pos ast.Pos, name string) {
+	loc := Location{File: file, Line: pos.Line, Column: pos.Column, EndColumn: pos.Column + len(name)}
+	si.occurrences[file] = append(si.occurrences[file], occurrence{Location: loc, key: key})
+}
+
+//referenceType references the class of a declared type
+func (si *symbolIndex) referenceType(file string, typ string, pos ast.Pos) {
+	if !vType(typ).isPrimitive() && typ != "void" && pos.Line > 0 {
+		si.reference(file, classKey(typ), pos, typ)
+	}
+}
+
+func (si *symbolIndex) indexClass(file string, jc ast.Class) {
+	//the first declaration wins as in the program index, an OS class can be redeclared
+	if len(si.symbols[classKey(jc.Name)].decl.File) == 0 {
+		si.declare(file, classKey(jc.Name), jc.Pos, jc.Name, "class "+jc.Name)
+	} else {
+		si.reference(file, classKey(jc.Name), jc.Pos, jc.Name) //redeclared class
+	}
+	for _, dec := range jc.Declarations {
+		si.declare(file, varKey(jc.Name, dec.Name), dec.Pos, dec.Name, fmt.Sprintf("%s %s %s", dec.Kind, dec.Type, dec.Name))
+		si.referenceType(file, dec.Type, dec.TypePos)
+	}
+	for _, sub := range jc.Subroutines {
+		si.declare(file, subKey(jc.Name, sub.Name), sub.Pos, sub.Name, signature(jc.Name, sub))
+		si.referenceType(file, sub.RetType, sub.RetTypePos)
+		scope := fmt.Sprintf("%s.%s", jc.Name, sub.Name)
+		for _, dec := range sub.Declarations {
+			si.declare(file, varKey(scope, dec.Name), dec.Pos, dec.Name, fmt.Sprintf("%s %s %s", dec.Kind, dec.Type, dec.Name))
+			si.referenceType(file, dec.Type, dec.TypePos)
+		}
+		ast.Walk(&referenceResolver{index: si, file: file, class: jc, sub: sub}, sub)
+	}
+}
+
+//referenceResolver records the references in the statements of a subroutine as it walks them
+type referenceResolver struct {
+	index *symbolIndex
+	file  string
+	class ast.Class
+	sub   ast.Subroutine
+}
+
+//lookup finds a variable visible in the subroutine, returns its key and declaration
+func (r *referenceResolver) lookup(name string) (string, ast.Variable, bool) {
+	for _, dec := range r.sub.Declarations {
+		if dec.Name == name {
+			return varKey(fmt.Sprintf("%s.%s", r.class.Name, r.sub.Name), name), dec, true
+		}
+	}
+	for _, dec := range r.class.Declarations {
+		if dec.Name == name {
+			return varKey(r.class.Name, name), dec, true
+		}
+	}
+	return "", ast.Variable{}, false
+}
+
+//Visit records the references of the variables and the calls in the statements
+func (r *referenceResolver) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case ast.ReferenceTerm:
+		r.reference(n)
+	case ast.SubroutineCall:
+		r.subCall(n)
+	}
+	return r
+}
+
+func (r *referenceResolver) reference(ref ast.ReferenceTerm) {
+	if key, _, ok := r.lookup(ref.VarName); ok {
+		r.index.reference(r.file, key, ref.Pos, ref.VarName)
+	}
+}
+
+//subCall references the target, which is a variable or a class, and the subroutine called
+func (r *referenceResolver) subCall(call ast.SubroutineCall) {
+	className := r.class.Name
+	if len(call.Target) > 0 {
+		if key, v, ok := r.lookup(call.Target); ok {
+			r.index.reference(r.file, key, call.Pos, call.Target)
+			className = v.Type
+		} else {
+			className = call.Target
+			r.index.reference(r.file, classKey(className), call.Pos, className)
+		}
+	}
+	r.index.reference(r.file, subKey(className, call.Name), call.NamePos, call.Name)
+}
+
+//occurrence finds the declaration or the reference at a position of a file
+func (si *symbolIndex) occurrence(file string, line, column int) (occurrence, bool) {
+	for _, o := range si.occurrences[file] {
+		if o.Line == line && column >= o.Column && column < o.EndColumn {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+//Definition returns where the symbol at a position is declared,
+//positions are 1 based as the diagnostics
+func (w *Workspace) Definition(file string, line, column int) (Location, bool) {
+	w.analyze()
+	o, ok := w.symbols.occurrence(file, line, column)
+	if !ok {
+		return Location{}, false
+	}
+	sym, ok := w.symbols.symbols[o.key]
+	if !ok || len(sym.decl.File) == 0 {
+		return Location{}, false
+	}
+	return sym.decl, true
+}
+
+//References returns all the occurrences of the symbol at a position in the workspace sorted by file and position
+func (w *Workspace) References(file string, line, column int, includeDeclaration bool) []Location {
+	w.analyze()
+	o, ok := w.symbols.occurrence(file, line, column)
+	if !ok {
+		return nil
+	}
+	decl := w.symbols.symbols[o.key].decl
+	var locations []Location
+	for _, occurrences := range w.symbols.occurrences {
+		for _, ref := range occurrences {
+			if ref.key == o.key && (includeDeclaration || ref.Location != decl) {
+				locations = append(locations, ref.Location)
+			}
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return locations
+}
+
+//Hover returns the declaration of the symbol at a position, e.g. `local int i` or `function int Math.max(int x, int y)`
+func (w *Workspace) Hover(file string, line, column int) (string, Location, bool) {
+	w.analyze()
+	o, ok := w.symbols.occurrence(file, line, column)
+	if !ok {
+		return "", Location{}, false
+	}
+	sym, ok := w.symbols.symbols[o.key]
+	if !ok {
+		return "", Location{}, false
+	}
+	return sym.detail, o.Location, true
+}
+
+//memberPrefix matches `target.prefix` at the end of the text before the cursor
+var memberPrefix = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z0-9_]*)$`)
+
+//Completions returns the subroutines of a class for `Class.` or `variable.` before a position:
+//the functions and constructors of a class, or the methods of the class of a variable
+func (w *Workspace) Completions(file string, line, column int) []Completion {
+	w.analyze()
+	lines := strings.Split(w.contents[file], "\n")
+	if line <= 0 || line > len(lines) {
+		return nil
+	}
+	text := []rune(lines[line-1])
+	if column-1 < len(text) {
+		text = text[:column-1]
+	}
+	m := memberPrefix.FindStringSubmatch(string(text))
+	if m == nil {
+		return nil
+	}
+	className, asMethod := m[1], false
+	if v, ok := w.lookupVar(file, line, m[1]); ok {
+		className, asMethod = v.Type, true
+	}
+	ci, ok := w.symbols.program.class(className)
+	if !ok {
+		return nil
+	}
+	var completions []Completion
+	for _, sub := range ci.subroutines {
+		if (sub.Category == ast.Method) != asMethod || !strings.HasPrefix(sub.Name, m[2]) {
+			continue
+		}
+		completions = append(completions, Completion{Label: sub.Name, Kind: string(sub.Category), Detail: signature(className, sub)})
+	}
+	sort.Slice(completions, func(i, j int) bool { return completions[i].Label < completions[j].Label })
+	return completions
+}
+
+//lookupVar finds a variable visible at a line of a file with the last parsed class of the file
+func (w *Workspace) lookupVar(file string, line int, name string) (ast.Variable, bool) {
+	jc, ok := w.parsed[file]
+	if !ok {
+		return ast.Variable{}, false
+	}
+	r := &referenceResolver{class: jc}
+	//the subroutine containing the line is the last one declared before it
+	for _, sub := range jc.Subroutines {
+		if sub.Pos.Line <= line {
+			r.sub = sub
+		}
+	}
+	_, v, ok := r.lookup(name)
+	return v, ok
+}
@@ -0,0 +1,120 @@
+package compiler
+
+import (
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
+)
+
+//peephole rewrites a window of vm instructions, the window never crosses a function
+//since a function starts with its declaration and no rule matches it
+type peephole struct {
+	name    string
+	pattern []ir.Instruction //the op, the segment and the label of an instruction are any if empty, e.g. `if-goto` for any label
+	rewrite func(window []ir.Instruction) ([]ir.Instruction, bool)
+}
+
+var (
+	anyInst   = ir.Instruction{}
+	anyPush   = ir.Instruction{Op: ir.OpPush}
+	anyPop    = ir.Instruction{Op: ir.OpPop}
+	anyLabel  = ir.Instruction{Op: ir.OpLabel}
+	anyGoto   = ir.Instruction{Op: ir.OpGoto}
+	anyIfGoto = ir.Instruction{Op: ir.OpIfGoto}
+	notInst   = ir.Arithmetic(ir.OpNot)
+	negInst   = ir.Arithmetic(ir.OpNeg)
+	pushOne   = ir.Push("constant", 1)
+)
+
+//peepholes are applied until none matches, each of them keeps the stack and the memory as they were
+//and never grows the code so that the optimization always ends
+var peepholes = []peephole{
+	//~true is false
+	{"not true", []ir.Instruction{pushOne, negInst, notInst}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		return []ir.Instruction{ir.Push("constant", 0)}, true
+	}},
+	//if (true), while (true) after its condition is inverted
+	{"jump always", []ir.Instruction{pushOne, negInst, anyIfGoto}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		return []ir.Instruction{ir.Goto(w[2].Label)}, true
+	}},
+	{"jump never", []ir.Instruction{ir.Push("constant", 0), anyIfGoto}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		return nil, true
+	}},
+	{"double not", []ir.Instruction{notInst, notInst}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		return nil, true
+	}},
+	{"double neg", []ir.Instruction{negInst, negInst}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		return nil, true
+	}},
+	//jumps over the goto if the condition is false, e.g. `if (~(x < y)) {...}` without else.
+	//Only a comparison is true or false, ~x of any other x is not 0 unless x is -1, e.g. ~3 is -4
+	{"inverted jump", []ir.Instruction{anyInst, notInst, anyIfGoto, anyGoto, anyLabel}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		if !isComparison(w[0]) || w[2].Label != w[4].Label {
+			return nil, false
+		}
+		return []ir.Instruction{w[0], ir.IfGoto(w[3].Label), w[4]}, true
+	}},
+	//the value popped is the one pushed, e.g. `let x = x;`
+	{"push pop", []ir.Instruction{anyPush, anyPop}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		if w[0].Segment != w[1].Segment || w[0].Index != w[1].Index {
+			return nil, false
+		}
+		return nil, true
+	}},
+	//the goto before the label of an if without else
+	{"jump next", []ir.Instruction{anyGoto, anyLabel}, func(w []ir.Instruction) ([]ir.Instruction, bool) {
+		if w[0].Label != w[1].Label {
+			return nil, false
+		}
+		return []ir.Instruction{w[1]}, true
+	}},
+}
+
+//isComparison reports whether the instruction leaves true(-1) or false(0) on the stack
+func isComparison(inst ir.Instruction) bool {
+	return inst.Op == ir.OpEq || inst.Op == ir.OpLt || inst.Op == ir.OpGt
+}
+
+func (p peephole) match(window []ir.Instruction) bool {
+	for i, inst := range p.pattern {
+		w := window[i]
+		if (inst.Op != "" && w.Op != inst.Op) || (inst.Segment != "" && (w.Segment != inst.Segment || w.Index != inst.Index)) ||
+			(inst.Label != "" && w.Label != inst.Label) {
+			return false
+		}
+	}
+	return true
+}
+
+//optimize applies the peephole rewrites to the instructions of a class as they are emitted,
+//the tail of the emitted instructions is matched again after every rewrite so that a rewrite can enable another one.
+//The instructions of a replacement are at the source position of the last one rewritten
+func optimize(insts []ir.Instruction) []ir.Instruction {
+	var out []ir.Instruction
+	for _, inst := range insts {
+		out = append(out, inst)
+		for rewritten := true; rewritten; {
+			rewritten = false
+			for _, p := range peepholes {
+				n := len(p.pattern)
+				if n > len(out) {
+					continue
+				}
+				window := out[len(out)-n:]
+				if !p.match(window) {
+					continue
+				}
+				replacement, ok := p.rewrite(window)
+				if !ok {
+					continue
+				}
+				pos := window[n-1].Pos
+				out = out[:len(out)-n]
+				for _, r := range replacement {
+					out = append(out, r.At(pos))
+				}
+				rewritten = true
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,233 @@
+package compiler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
+	"github.com/zhangwuh/jack-compiler/vmemulator"
+	"github.com/zhangwuh/jack-compiler/vmtranslator"
+)
+
+func TestOptimize(t *testing.T) {
+	cases := []struct {
+		lines     []string
+		optimized []string
+	}{
+		{[]string{"push constant 1", "neg", "not", "pop local 0"}, []string{"push constant 0", "pop local 0"}},
+		{[]string{"label WHILE_0", "push constant 1", "neg", "not", "if-goto END_WHILE_0"}, []string{"label WHILE_0"}},
+		{[]string{"push constant 1", "neg", "if-goto IF_0"}, []string{"goto IF_0"}},
+		{[]string{"push local 0", "not", "not", "neg", "neg", "return"}, []string{"push local 0", "return"}},
+		{[]string{"lt", "not", "if-goto END_WHILE_0", "goto WHILE_0", "label END_WHILE_0"}, []string{"lt", "if-goto WHILE_0", "label END_WHILE_0"}},
+		{[]string{"push argument 1", "pop argument 1", "push that 0", "pop this 0"}, []string{"push that 0", "pop this 0"}},
+		{[]string{"goto ENDIF_0", "label ENDIF_0"}, []string{"label ENDIF_0"}},
+		{[]string{"goto ENDIF_0", "label IF_0"}, []string{"goto ENDIF_0", "label IF_0"}},
+		{[]string{"not", "if-goto IF_0", "goto ENDIF_0", "label ENDIF_0"}, []string{"not", "if-goto IF_0", "label ENDIF_0"}},
+		{[]string{"eq", "not", "if-goto IF_0", "goto ENDIF_0", "label IF_0"}, []string{"eq", "if-goto ENDIF_0", "label IF_0"}},
+		//~x is not false for x other than true
+		{[]string{"and", "not", "if-goto IF_0", "goto ENDIF_0", "label IF_0"}, []string{"and", "not", "if-goto IF_0", "goto ENDIF_0", "label IF_0"}},
+	}
+	for _, c := range cases {
+		var insts []ir.Instruction
+		for _, line := range c.lines {
+			inst, err := ir.Parse(line)
+			assert.Nil(t, err)
+			insts = append(insts, inst)
+		}
+		var optimized []string
+		for _, inst := range optimize(insts) {
+			optimized = append(optimized, inst.String())
+		}
+		assert.Equal(t, c.optimized, optimized, strings.Join(c.lines, "; "))
+	}
+}
+
+//the instructions of a replacement are at the position of the last one rewritten so that the optimized code can still be mapped to the source
+func TestOptimize_Positions(t *testing.T) {
+	first, second := ast.Pos{Line: 3, Column: 3}, ast.Pos{Line: 4, Column: 3}
+	assert.Equal(t, []ir.Instruction{ir.Push("constant", 0).At(second), ir.Return().At(second)},
+		optimize([]ir.Instruction{ir.Push("constant", 1).At(first), ir.Arithmetic(ir.OpNeg).At(first), ir.Arithmetic(ir.OpNot).At(second), ir.Return().At(second)}))
+}
+
+const optimizedPrograms = `class Main {
+	function void main() {
+		var int x, i;
+		var boolean b;
+		var Array a;
+		let a = Array.new(3);
+		let x = 7;
+		let x = x;
+		let b = ~true;
+		if (true) {
+			let x = -(-x);
+		} else {
+			let x = 0;
+		}
+		if (~(~b)) {
+			let x = 1;
+		}
+		while (i < 3) {
+			let a[i] = x + i;
+			let i = i + 1;
+		}
+		while (i > 10) {}
+		while (true) {
+			do Output.printInt(Main.sum(a, i));
+			return;
+		}
+		return;
+	}
+
+	function int sum(Array a, int n) {
+		var int i, s;
+		while (~(i = n)) {
+			let s = s + a[i];
+			let i = i + 1;
+		}
+		return s;
+	}
+}`
+
+var osVMFiles = []string{"Array", "Keyboard", "Math", "Memory", "Output", "Screen", "String", "Sys"}
+
+//runProgram runs the vm code compiled, returns what's printed with the OS bound to native functions
+//and the steps executed with the vm code of the OS, e.g. the steps of Math.multiply
+func runProgram(t *testing.T, outputs map[string][]byte) (string, int) {
+	var sources []vmtranslator.Source
+	for name, code := range outputs {
+		if filepath.Ext(name) == ".vm" {
+			src, err := vmtranslator.Parse(strings.TrimSuffix(name, ".vm"), strings.NewReader(string(code)))
+			assert.Nil(t, err)
+			sources = append(sources, src)
+		}
+	}
+	m, err := vmemulator.Load(sources)
+	assert.Nil(t, err)
+	os := vmemulator.BindOS(m)
+	m.SetMaxSteps(1000000)
+	assert.Nil(t, m.Boot())
+	assert.Nil(t, m.Run())
+
+	for _, file := range osVMFiles {
+		src, err := vmtranslator.ParseFile(filepath.Join("../output/vm/Pong", file+".vm"))
+		assert.Nil(t, err)
+		sources = append(sources, src)
+	}
+	m, err = vmemulator.Load(sources)
+	assert.Nil(t, err)
+	m.SetMaxSteps(10000000)
+	assert.Nil(t, m.Boot())
+	assert.Nil(t, m.Run())
+	return os.Output(), m.Steps()
+}
+
+//the condition of a loop is tested after the body if it's a comparison, without a not
+func TestOptimize_Loops(t *testing.T) {
+	jc, diagnostics := Parse("Main.jack", []byte(`class Main {
+	function int count(int n) {
+		var int i;
+		while (i < n) {
+			let i = i + 1;
+		}
+		while (i & 1) {
+			let i = i + 1;
+		}
+		return i;
+	}
+}`))
+	assert.Nil(t, diagnostics)
+	outputs, diagnostics := Compile([]*ast.Class{jc}, Options{Optimize: 1})
+	assert.Nil(t, diagnostics)
+	assert.Equal(t, `function Main.count 1
+goto WHILE_COND_0
+label WHILE_0
+push local 0
+push constant 1
+add
+pop local 0
+label WHILE_COND_0
+push local 0
+push argument 0
+lt
+if-goto WHILE_0
+label WHILE_1
+push local 0
+push constant 1
+and
+not
+if-goto END_WHILE_1
+push local 0
+push constant 1
+add
+pop local 0
+goto WHILE_1
+label END_WHILE_1
+push local 0
+return`, string(outputs["Main.vm"]))
+}
+
+//the conditions of an if and a while aren't booleans
+const notCondition = `class Main {
+	function void main() {
+		var int x, n;
+		let x = 3;
+		if (~(x & 1)) {
+			do Output.printInt(1);
+		}
+		do Output.printInt(2);
+		let x = 1;
+		while (x & 1) {
+			let n = n + 1;
+			let x = x + 2;
+			if (n > 3) {
+				let x = 0;
+			}
+		}
+		do Output.printInt(n);
+		return;
+	}
+}`
+
+//the programs print the same before and after the optimization, with fewer steps
+func TestOptimize_Semantics(t *testing.T) {
+	programs := map[string]string{"optimized": optimizedPrograms, "not condition": notCondition}
+	printed := map[string]string{"optimized": "24", "not condition": "120", "fibonacci": "THE Fib result is: 6765", "Seven": "7"}
+	for _, sample := range []string{"fibonacci", "Seven"} {
+		src, err := ioutil.ReadFile(filepath.Join("../sample", sample, "Main.jack"))
+		assert.Nil(t, err)
+		programs[sample] = string(src)
+	}
+	for name, src := range programs {
+		jc, diagnostics := Parse("Main.jack", []byte(src))
+		assert.Nil(t, diagnostics)
+		plain, diagnostics := Compile([]*ast.Class{jc}, Options{})
+		assert.Nil(t, diagnostics)
+		optimized, diagnostics := Compile([]*ast.Class{jc}, Options{Optimize: 1})
+		assert.Nil(t, diagnostics)
+
+		output, steps := runProgram(t, plain)
+		assert.Equal(t, printed[name], output, name)
+		output, optimizedSteps := runProgram(t, optimized)
+		assert.Equal(t, printed[name], output, name)
+		assert.LessOrEqual(t, optimizedSteps, steps, name)
+		assert.LessOrEqual(t, len(optimized["Main.vm"]), len(plain["Main.vm"]), name)
+	}
+}
+
+//the source map is built from the optimized code
+func TestOptimize_SourceMap(t *testing.T) {
+	jc, diagnostics := Parse("Main.jack", []byte(optimizedPrograms))
+	assert.Nil(t, diagnostics)
+	outputs, diagnostics := Compile([]*ast.Class{jc}, Options{Optimize: 1, SourceMap: true})
+	assert.Nil(t, diagnostics)
+	lines := strings.Split(string(outputs["Main.vm"]), "\n")
+	assert.NotContains(t, lines, "neg")
+	var sm SourceMap
+	assert.Nil(t, json.Unmarshal(outputs["Main.vm.map"], &sm))
+	assert.Equal(t, len(lines), len(sm.Mappings))
+}
@@ -0,0 +1,547 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+func assertToken(t Token, typ TokenType, val string) error {
+	if t == nil || typ != t.GetType() || (len(val) > 0 && t.GetVal() != val) {
+		expected := string(typ)
+		if len(val) > 0 {
+			expected = fmt.Sprintf("'%s'", val)
+		}
+		if t == nil || t.GetType() == EOF {
+			return newTokenDiagnostic(CodeUnexpectedEOF, t, "", "expected "+expected)
+		}
+		return newTokenDiagnostic(CodeUnexpectedToken, t, fmt.Sprintf("unexpected %s '%s', expected %s", t.GetType(), t.GetVal(), expected))
+	}
+	return nil
+}
+
+func isSymbolToken(t Token, val string) bool {
+	return t != nil && t.GetType() == Symbol && t.GetVal() == val
+}
+
+func isKeywordToken(t Token, vals ...string) bool {
+	return t != nil && t.GetType() == Keyword && ContainsString(vals, t.GetVal())
+}
+
+var langSupportedTypes = []string{"int", "string", "Array", "char", "boolean"}
+
+//assertType accepts the types of variables and the extra keywords, e.g. void for return types
+func assertType(t Token, extra ...string) error {
+	if t != nil && (t.GetType() == Identifier ||
+		t.GetType() == Keyword && (ContainsString(langSupportedTypes, t.GetVal()) || ContainsString(extra, t.GetVal()))) {
+		return nil
+	}
+	if t == nil || t.GetType() == EOF {
+		return newTokenDiagnostic(CodeUnexpectedEOF, t, "", "expected a type")
+	}
+	return newTokenDiagnostic(CodeInvalidType, t, fmt.Sprintf("invalid type:%s", t.GetVal()))
+}
+
+func unexpected(t Token, expected string) error {
+	return newTokenDiagnostic(CodeUnexpectedToken, t, fmt.Sprintf("unexpected %s '%s', expected %s", t.GetType(), t.GetVal(), expected))
+}
+
+func tokenPos(t Token) ast.Pos {
+	return ast.Pos{Line: t.Position(), Column: t.Column()}
+}
+
+var emptyClass = ast.Class{}
+var emptySubroutine = ast.Subroutine{}
+var emptyExpression = ast.Expression{}
+
+var statementKeywords = []string{"let", "do", "if", "while", "return", "var"}
+var declarationKeywords = []string{"field", "static", "constructor", "function", "method"}
+
+//parser builds the class of a jack file from its tokens with the positions of the source.
+//It recovers from a syntax error at the boundary of the statement or the declaration and goes on,
+//so that all the syntax errors of a file are reported at once
+type parser struct {
+	it          *TokenIterator
+	diagnostics DiagnosticList
+}
+
+//parseTokens returns the class parsed and all the syntax errors, the statements which fail to parse
+//are kept in the class as bad statements and the declarations are dropped
+func parseTokens(tokens []Token) (ast.Class, DiagnosticList) {
+	eof := &TerminalToken{tokenType: EOF, line: 1, column: 1} //an empty file or a file of comments misses the class at 1:1
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		eof = &TerminalToken{tokenType: EOF, line: last.Position(), column: last.Column() + len([]rune(last.GetVal()))}
+	}
+	p := &parser{it: NewTokenIterator(append(tokens[:len(tokens):len(tokens)], eof))}
+	jc, err := p.class()
+	if next := p.it.Peek(); err == nil && next != nil && next.GetType() != EOF {
+		err = newTokenDiagnostic(CodeUnexpectedToken, next, fmt.Sprintf("unexpected %s '%s' after the end of class", next.GetType(), next.GetVal()))
+	}
+	if d, ok := err.(*Diagnostic); ok {
+		p.report(d) //the end of file may have been reported by the last declaration already
+	}
+	return jc, p.diagnostics
+}
+
+//report adds d unless it's at or before the last error reported, the tokens skipped to recover from an error
+//are reported again by the enclosing statement or declaration, e.g. the `else` of `if (x) {} else }`
+func (p *parser) report(d *Diagnostic) {
+	if n := len(p.diagnostics); n == 0 || p.diagnostics[n-1].before(d) {
+		p.diagnostics.Add(d)
+	}
+}
+
+//recoverFrom skips the tokens of a statement or a declaration which failed to parse from its start until
+//a ';' ending it, a '}' closing it or the enclosing block, or a keyword starting the next one.
+//The curly brackets opened inside are skipped as a whole so that the enclosing block isn't closed by a nested '}'
+func recoverFrom(it *TokenIterator, start int, keywords []string) []Token {
+	it.i = start
+	depth := 0
+	for it.HasNext() {
+		t := it.Peek()
+		if t.GetType() == EOF {
+			break
+		}
+		if depth == 0 && it.i > start && t.GetType() == Keyword && ContainsString(keywords, t.GetVal()) {
+			break
+		}
+		if isSymbolToken(t, "}") {
+			if depth == 0 {
+				break
+			}
+			it.Next()
+			if depth--; depth == 0 {
+				break
+			}
+			continue
+		}
+		it.Next()
+		if isSymbolToken(t, "{") {
+			depth++
+		} else if depth == 0 && isSymbolToken(t, ";") {
+			break
+		}
+	}
+	return it.tokens[start:it.i]
+}
+
+//recover skips the statement or the declaration started at start and reports err, the errors
+//found inside it before are dropped since its tokens are skipped as a whole
+func (p *parser) recover(start int, reported int, err error, keywords []string) ast.BadStatement {
+	skipped := recoverFrom(p.it, start, keywords)
+	d, ok := err.(*Diagnostic)
+	if !ok {
+		d = newDiagnostic(CodeSyntaxError, 0, 0, err.Error())
+		if len(skipped) > 0 {
+			d.Line, d.Column, d.EndColumn = skipped[0].Position(), skipped[0].Column(), skipped[0].Column()
+		}
+	}
+	p.diagnostics = p.diagnostics[:reported]
+	p.report(d)
+	bs := ast.BadStatement{Err: d}
+	for _, t := range skipped {
+		bs.Tokens = append(bs.Tokens, ast.Token{Type: string(t.GetType()), Val: t.GetVal(), Pos: tokenPos(t)})
+	}
+	if len(skipped) > 0 {
+		bs.Pos = tokenPos(skipped[0])
+	}
+	return bs
+}
+
+//expect consumes the next token if it's the symbol or the keyword val
+func (p *parser) expect(typ TokenType, val string) (Token, error) {
+	t := p.it.Next()
+	return t, assertToken(t, typ, val)
+}
+
+func (p *parser) identifier() (Token, error) {
+	return p.expect(Identifier, "")
+}
+
+func (p *parser) class() (jc ast.Class, err error) {
+	if _, err = p.expect(Keyword, "class"); err != nil {
+		return
+	}
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+	jc.Name, jc.Pos = name.GetVal(), tokenPos(name)
+	if _, err = p.expect(Symbol, "{"); err != nil {
+		return
+	}
+	for p.it.HasNext() {
+		t := p.it.Peek()
+		if t.GetType() == EOF || isSymbolToken(t, "}") {
+			break
+		}
+		start, reported := p.it.i, len(p.diagnostics)
+		if isKeywordToken(t, "field", "static") {
+			var decs []ast.Variable
+			if decs, err = p.classVarDec(); err == nil {
+				jc.Declarations = append(jc.Declarations, decs...)
+			}
+		} else if isKeywordToken(t, "constructor", "function", "method") {
+			var sub ast.Subroutine
+			if sub, err = p.subroutineDec(); err == nil {
+				jc.Subroutines = append(jc.Subroutines, sub)
+			}
+		} else {
+			err = unexpected(t, "a class variable or a subroutine")
+		}
+		if err != nil {
+			p.recover(start, reported, err, declarationKeywords)
+		}
+	}
+	_, err = p.expect(Symbol, "}")
+	return
+}
+
+//field|static type name (, name)* ;
+func (p *parser) classVarDec() ([]ast.Variable, error) {
+	kind := p.it.Next()
+	return p.varNames(ast.VarKind(kind.GetVal()))
+}
+
+//var type name (, name)* ;
+func (p *parser) varDec() ([]ast.Variable, error) {
+	if _, err := p.expect(Keyword, "var"); err != nil {
+		return nil, err
+	}
+	return p.varNames(ast.Local)
+}
+
+//type name (, name)* ; of variable declarations
+func (p *parser) varNames(kind ast.VarKind) ([]ast.Variable, error) {
+	typ := p.it.Next()
+	if err := assertType(typ); err != nil {
+		return nil, err
+	}
+	var vs []ast.Variable
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, ast.Variable{Name: name.GetVal(), Kind: kind, Type: typ.GetVal(), Pos: tokenPos(name), TypePos: tokenPos(typ)})
+
+		t := p.it.Next()
+		if isSymbolToken(t, ";") {
+			return vs, nil
+		}
+		if err := assertToken(t, Symbol, ","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) subroutineDec() (sub ast.Subroutine, err error) {
+	sub.Category = ast.SubroutineCategory(p.it.Next().GetVal()) //constructor, method, function
+	typ := p.it.Next()                                          //class name in constructor, void, return type
+	if err = assertType(typ, "void"); err != nil {
+		return
+	}
+	sub.RetType, sub.RetTypePos = typ.GetVal(), tokenPos(typ)
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+	sub.Name, sub.Pos = name.GetVal(), tokenPos(name)
+
+	if _, err = p.expect(Symbol, "("); err != nil {
+		return
+	}
+	if sub.Declarations, err = p.parameters(); err != nil {
+		return
+	}
+	if _, err = p.expect(Symbol, ")"); err != nil {
+		return
+	}
+	err = p.subroutineBody(&sub)
+	return
+}
+
+//type name (, type name)*
+func (p *parser) parameters() ([]ast.Variable, error) {
+	var vs []ast.Variable
+	for !isSymbolToken(p.it.Peek(), ")") {
+		if len(vs) > 0 {
+			if _, err := p.expect(Symbol, ","); err != nil {
+				return nil, err
+			}
+		}
+		typ := p.it.Next()
+		if err := assertType(typ); err != nil {
+			return nil, err
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, ast.Variable{Name: name.GetVal(), Kind: ast.Argument, Type: typ.GetVal(), Pos: tokenPos(name), TypePos: tokenPos(typ)})
+	}
+	return vs, nil
+}
+
+//{ varDec* statements }, the var declarations and the statements which fail to parse are skipped
+func (p *parser) subroutineBody(sub *ast.Subroutine) error {
+	if _, err := p.expect(Symbol, "{"); err != nil {
+		return err
+	}
+	for p.it.HasNext() {
+		t := p.it.Peek()
+		if isSymbolToken(t, "}") {
+			p.it.Next()
+			return nil
+		}
+		if t.GetType() == EOF {
+			break
+		}
+		start, reported := p.it.i, len(p.diagnostics)
+		switch typeOf(t) {
+		case IfStatement, LetStatement, WhileStatement, DoStatement, ReturnStatement:
+			sub.Statements = append(sub.Statements, p.statements()...)
+		case VarStatement:
+			decs, err := p.varDec()
+			if err != nil {
+				p.recover(start, reported, err, statementKeywords)
+				continue
+			}
+			sub.Declarations = append(sub.Declarations, decs...)
+		default:
+			sub.Statements = append(sub.Statements, p.recover(start, reported, unexpected(t, "a statement"), statementKeywords))
+		}
+	}
+	_, err := p.expect(Symbol, "}")
+	return err
+}
+
+//statements replaces a statement which fails to parse with a bad statement and goes on with the next one,
+//so it never fails
+func (p *parser) statements() []ast.Statement {
+	var sts []ast.Statement
+	for p.it.HasNext() {
+		start, reported := p.it.i, len(p.diagnostics)
+		var st ast.Statement
+		var err error
+		switch typeOf(p.it.Peek()) {
+		case IfStatement:
+			st, err = p.ifStatement()
+		case WhileStatement:
+			st, err = p.whileStatement()
+		case LetStatement:
+			st, err = p.letStatement()
+		case DoStatement:
+			st, err = p.doStatement()
+		case ReturnStatement:
+			st, err = p.returnStatement()
+		default:
+			return sts
+		}
+		if err != nil {
+			st = p.recover(start, reported, err, statementKeywords)
+		}
+		sts = append(sts, st)
+	}
+	return sts
+}
+
+//{ statements }
+func (p *parser) block() ([]ast.Statement, error) {
+	if _, err := p.expect(Symbol, "{"); err != nil {
+		return nil, err
+	}
+	sts := p.statements()
+	_, err := p.expect(Symbol, "}")
+	return sts, err
+}
+
+//( expression )
+func (p *parser) condition() (ast.Expression, error) {
+	if _, err := p.expect(Symbol, "("); err != nil {
+		return emptyExpression, err
+	}
+	exp, err := p.expression()
+	if err != nil {
+		return emptyExpression, err
+	}
+	_, err = p.expect(Symbol, ")")
+	return exp, err
+}
+
+func (p *parser) ifStatement() (is ast.IfStatement, err error) {
+	is.Pos = tokenPos(p.it.Next()) //if
+	if is.Condition, err = p.condition(); err != nil {
+		return
+	}
+	if is.Statements, err = p.block(); err != nil {
+		return
+	}
+	if t := p.it.Peek(); isKeywordToken(t, "else") {
+		is.ElsePos = tokenPos(p.it.Next())
+		is.ElseStatements, err = p.block()
+	}
+	return
+}
+
+func (p *parser) whileStatement() (ws ast.WhileStatement, err error) {
+	ws.Pos = tokenPos(p.it.Next()) //while
+	if ws.Condition, err = p.condition(); err != nil {
+		return
+	}
+	ws.Statements, err = p.block()
+	return
+}
+
+//let name([expression])? = expression;
+func (p *parser) letStatement() (ls ast.LetStatement, err error) {
+	ls.Pos = tokenPos(p.it.Next()) //let
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+	if ls.Target, err = p.reference(name); err != nil {
+		return
+	}
+	if _, err = p.expect(Symbol, "="); err != nil {
+		return
+	}
+	if ls.Expression, err = p.expression(); err != nil {
+		return
+	}
+	_, err = p.expect(Symbol, ";")
+	return
+}
+
+func (p *parser) doStatement() (ds ast.DoStatement, err error) {
+	ds.Pos = tokenPos(p.it.Next()) //do
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+	if ds.Action, err = p.subCall(name); err != nil {
+		return
+	}
+	_, err = p.expect(Symbol, ";")
+	return
+}
+
+func (p *parser) returnStatement() (rs ast.ReturnStatement, err error) {
+	rs.Pos = tokenPos(p.it.Next()) //return
+	if !isSymbolToken(p.it.Peek(), ";") {
+		if rs.Expression, err = p.expression(); err != nil {
+			return
+		}
+	}
+	_, err = p.expect(Symbol, ";")
+	return
+}
+
+//term (op term)*
+func (p *parser) expression() (exp ast.Expression, err error) {
+	term, err := p.term()
+	if err != nil {
+		return emptyExpression, err
+	}
+	exp.Terms = append(exp.Terms, term)
+	for {
+		t := p.it.Peek()
+		if t == nil || t.GetType() != Symbol {
+			return exp, nil
+		}
+		if _, ok := operations[t.GetVal()]; !ok {
+			return exp, nil
+		}
+		exp.Operations = append(exp.Operations, p.it.Next().GetVal())
+		if term, err = p.term(); err != nil {
+			return emptyExpression, err
+		}
+		exp.Terms = append(exp.Terms, term)
+	}
+}
+
+func (p *parser) term() (ast.Term, error) {
+	t := p.it.Next()
+	switch {
+	case t == nil:
+		return nil, assertToken(t, TokenTerm, "")
+	case isSymbolToken(t, "("): //(expression)
+		exp, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(Symbol, ")")
+		return exp, err
+	case isSymbolToken(t, "-") || isSymbolToken(t, "~"): //-1, ~done
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		return ast.UnaryTerm{Operator: t.GetVal(), Term: term, Pos: tokenPos(t)}, nil
+	case t.GetType() == Identifier: //x, a[i], f(), x.f()
+		next := p.it.Peek()
+		if isSymbolToken(next, "(") || isSymbolToken(next, ".") {
+			return p.subCall(t)
+		}
+		return p.reference(t)
+	case t.GetType() == IntegerConstant:
+		iv, err := strconv.Atoi(t.GetVal())
+		if err != nil {
+			return nil, newTokenDiagnostic(CodeSyntaxError, t, "int required")
+		}
+		return ast.ConstTerm{Kind: ast.IntegerConst, Val: iv, Pos: tokenPos(t)}, nil
+	case t.GetType() == StringConstant:
+		return ast.ConstTerm{Kind: ast.StringConst, Val: t.GetVal(), Pos: tokenPos(t)}, nil
+	case isKeywordConstant(t):
+		return ast.ConstTerm{Kind: ast.KeywordConst, Val: t.GetVal(), Pos: tokenPos(t)}, nil
+	}
+	return nil, unexpected(t, "a term")
+}
+
+//name, name[expression]
+func (p *parser) reference(name Token) (ast.ReferenceTerm, error) {
+	ref := ast.ReferenceTerm{VarName: name.GetVal(), Pos: tokenPos(name)}
+	if !isSymbolToken(p.it.Peek(), "[") {
+		return ref, nil
+	}
+	p.it.Next()
+	index, err := p.expression()
+	if err != nil {
+		return ref, err
+	}
+	ref.Index = index
+	_, err = p.expect(Symbol, "]")
+	return ref, err
+}
+
+//name(expressionList) or target.name(expressionList) with the first identifier consumed
+func (p *parser) subCall(first Token) (call ast.SubroutineCall, err error) {
+	call.Name, call.Pos, call.NamePos = first.GetVal(), tokenPos(first), tokenPos(first)
+	if isSymbolToken(p.it.Peek(), ".") {
+		p.it.Next()
+		name, err := p.identifier()
+		if err != nil {
+			return call, err
+		}
+		call.Target, call.Name, call.NamePos = first.GetVal(), name.GetVal(), tokenPos(name)
+	}
+	if _, err = p.expect(Symbol, "("); err != nil {
+		return
+	}
+	for !isSymbolToken(p.it.Peek(), ")") {
+		if len(call.Args) > 0 {
+			if _, err = p.expect(Symbol, ","); err != nil {
+				return
+			}
+		}
+		var arg ast.Expression
+		if arg, err = p.expression(); err != nil {
+			return
+		}
+		call.Args = append(call.Args, arg)
+	}
+	p.it.Next() //)
+	return
+}
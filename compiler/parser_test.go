@@ -0,0 +1,148 @@
+package compiler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//the parse trees printed are the same as the xml files of the book
+func TestPrintXML(t *testing.T) {
+	for _, file := range []string{"../sample/Square/Main", "../sample/Square/Square", "../sample/Square/SquareGame", "../sample/ArrayTest/Main"} {
+		src, err := ioutil.ReadFile(file + ".jack")
+		assert.Nil(t, err)
+		expected, err := ioutil.ReadFile(file + ".xml")
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), printXML(parseSource(t, string(src))), file)
+	}
+}
+
+func TestParseTokens_TruncatedSource(t *testing.T) {
+	file, err := os.Open("../sample/Pong/Ball.jack")
+	assert.Nil(t, err)
+	defer file.Close()
+	tokenizer := &tokenizer{}
+	assert.Nil(t, tokenizer.Tokenize(file))
+
+	for i := 1; i < len(tokenizer.tokens); i++ {
+		_, diagnostics := parseTokens(tokenizer.tokens[:i])
+		assert.True(t, diagnostics.HasErrors(), "tokens:%d", i)
+	}
+}
+
+func parseSourceDiagnostics(t *testing.T, src string) (ast.Class, DiagnosticList) {
+	tokenizer := &tokenizer{}
+	assert.Nil(t, tokenizer.Tokenize(strings.NewReader(src)))
+	return parseTokens(tokenizer.tokens)
+}
+
+func statementCategories(statements []ast.Statement) []ast.StatementCategory {
+	var categories []ast.StatementCategory
+	for _, st := range statements {
+		categories = append(categories, st.Category())
+	}
+	return categories
+}
+
+func TestParseTokens_Recovery(t *testing.T) {
+	jc, diagnostics := parseSourceDiagnostics(t, `class Main {
+	field int x y;
+	static boolean done;
+
+	method void run() {
+		var int a, ;
+		var int b;
+		let a = ;
+		if (a { let b = 1; }
+		do Output.printInt(b);
+		let b = b +
+		return;
+	}
+
+	function void (int x) {
+		return;
+	}
+
+	method int twice(int n) {
+		return n + n;
+	}
+}`)
+	var errors []string
+	for _, d := range diagnostics {
+		errors = append(errors, fmt.Sprintf("%d:%d %s", d.Line, d.Column, d.Message))
+	}
+	assert.Equal(t, []string{
+		"2:14 unexpected identifier 'y', expected ','",
+		"6:14 unexpected symbol ';', expected identifier",
+		"8:11 unexpected symbol ';', expected a term",
+		"9:9 unexpected symbol '{', expected ')'",
+		"12:3 unexpected keyword 'return', expected a term",
+		"15:16 unexpected symbol '(', expected identifier",
+	}, errors)
+
+	//the declarations and the statements around the errors are kept, the statements failed are bad statements
+	assert.Equal(t, []string{"done"}, []string{jc.Declarations[0].Name})
+	assert.Equal(t, 2, len(jc.Subroutines))
+	run := jc.Subroutines[0]
+	assert.Equal(t, []string{"b"}, []string{run.Declarations[0].Name})
+	assert.Equal(t, []ast.StatementCategory{ast.BadSc, ast.BadSc, ast.DoSc, ast.BadSc, ast.RetSc}, statementCategories(run.Statements))
+	assert.Equal(t, diagnostics[2], run.Statements[0].(ast.BadStatement).Err)
+	assert.Equal(t, "twice", jc.Subroutines[1].Name)
+	assert.Contains(t, printXML(jc), `<error>
+          <keyword> let </keyword>
+          <identifier> a </identifier>
+          <symbol> = </symbol>
+          <symbol> ; </symbol>
+        </error>`)
+}
+
+//the tokens skipped to recover from an error aren't reported again, the errors of the tokenizer and the parser are in order
+func TestParse_Diagnostics(t *testing.T) {
+	_, diagnostics := Parse("Main.jack", []byte(`class Main {
+	function void main() {
+		var int x y;
+		let x = (1 + ;
+		if (x) {} else }
+		do Output.printString("abc);
+	}
+}`))
+	var errors []string
+	for _, d := range diagnostics {
+		errors = append(errors, fmt.Sprintf("%d:%d %s %s", d.Line, d.Column, d.Code, d.Message))
+	}
+	assert.Equal(t, []string{
+		"3:13 JACK0012 unexpected identifier 'y', expected ','",
+		"4:16 JACK0012 unexpected symbol ';', expected a term",
+		"5:18 JACK0012 unexpected symbol '}', expected '{'",
+		"6:3 JACK0012 unexpected keyword 'do', expected a class variable or a subroutine",
+		"6:25 JACK0004 unterminated string constant",
+		"8:1 JACK0012 unexpected symbol '}' after the end of class",
+	}, errors)
+}
+
+func TestParseTokens_MissingBrace(t *testing.T) {
+	_, diagnostics := parseSourceDiagnostics(t, `class Main {
+	function void main() {
+		return;
+	}`)
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, CodeUnexpectedEOF, diagnostics[0].Code)
+
+	_, diagnostics = parseSourceDiagnostics(t, `class Main {
+	function void main() {
+		if (true) {
+			return;
+		}
+	}
+	}
+	function void f(int) {
+	}
+}`)
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, "unexpected keyword 'function' after the end of class", diagnostics[0].Message)
+}
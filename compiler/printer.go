@@ -0,0 +1,286 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//xmlPrinter prints a class as the parse tree in xml of the book, which is compared with the tools of nand2tetris,
+//the tokens omitted by the model, e.g. the brackets and the commas, are printed again
+type xmlPrinter struct {
+	sb    strings.Builder
+	depth int
+}
+
+//printXML prints the parse tree of a class, e.g. `<keyword> class </keyword>` for a terminal element
+func printXML(jc ast.Class) string {
+	p := &xmlPrinter{}
+	p.class(jc)
+	return p.sb.String()
+}
+
+func (p *xmlPrinter) line(s string) {
+	p.sb.WriteString(strings.Repeat("  ", p.depth) + s + "\n")
+}
+
+func (p *xmlPrinter) terminal(typ TokenType, val string) {
+	p.line(fmt.Sprintf("<%s> %s </%s>", typ, EscapeXml(val), typ))
+}
+
+func (p *xmlPrinter) keyword(val string) {
+	p.terminal(Keyword, val)
+}
+
+func (p *xmlPrinter) symbol(val string) {
+	p.terminal(Symbol, val)
+}
+
+func (p *xmlPrinter) identifier(val string) {
+	p.terminal(Identifier, val)
+}
+
+//typ prints the type of a declaration, the primitive types are keywords and the classes are identifiers
+func (p *xmlPrinter) typ(typ string) {
+	if ContainsString(keywords, typ) {
+		p.keyword(typ)
+	} else {
+		p.identifier(typ)
+	}
+}
+
+//node prints a non terminal element, an empty one is printed in one line
+func (p *xmlPrinter) node(typ TokenType, empty bool, body func()) {
+	if empty {
+		p.line(fmt.Sprintf("<%s></%s>", typ, typ))
+		return
+	}
+	p.line(fmt.Sprintf("<%s>", typ))
+	p.depth++
+	body()
+	p.depth--
+	p.line(fmt.Sprintf("</%s>", typ))
+}
+
+func (p *xmlPrinter) class(jc ast.Class) {
+	p.node(Class, false, func() {
+		p.keyword("class")
+		p.identifier(jc.Name)
+		p.symbol("{")
+		for _, decs := range groupDeclarations(jc.Declarations) {
+			p.node(ClassVarDec, false, func() {
+				p.keyword(string(decs[0].Kind))
+				p.varNames(decs)
+			})
+		}
+		for _, sub := range jc.Subroutines {
+			p.subroutine(sub)
+		}
+		p.symbol("}")
+	})
+}
+
+//groupDeclarations groups the variables declared together, e.g. `var int x, y;`, by the position of their type
+func groupDeclarations(declarations []ast.Variable) [][]ast.Variable {
+	var groups [][]ast.Variable
+	for i, dec := range declarations {
+		if i > 0 {
+			prev := declarations[i-1]
+			if prev.Kind == dec.Kind && prev.Type == dec.Type && prev.TypePos == dec.TypePos {
+				groups[len(groups)-1] = append(groups[len(groups)-1], dec)
+				continue
+			}
+		}
+		groups = append(groups, []ast.Variable{dec})
+	}
+	return groups
+}
+
+//type name (, name)* ;
+func (p *xmlPrinter) varNames(decs []ast.Variable) {
+	p.typ(decs[0].Type)
+	for i, dec := range decs {
+		if i > 0 {
+			p.symbol(",")
+		}
+		p.identifier(dec.Name)
+	}
+	p.symbol(";")
+}
+
+func (p *xmlPrinter) subroutine(sub ast.Subroutine) {
+	var locals []ast.Variable
+	for _, dec := range sub.Declarations {
+		if dec.Kind == ast.Local {
+			locals = append(locals, dec)
+		}
+	}
+	params := sub.Params()
+	p.node(SubroutineDec, false, func() {
+		p.keyword(string(sub.Category))
+		p.typ(sub.RetType)
+		p.identifier(sub.Name)
+		p.symbol("(")
+		p.node(ParameterList, len(params) == 0, func() {
+			for i, param := range params {
+				if i > 0 {
+					p.symbol(",")
+				}
+				p.typ(param.Type)
+				p.identifier(param.Name)
+			}
+		})
+		p.symbol(")")
+		p.node(SubroutineBody, false, func() {
+			p.symbol("{")
+			for _, decs := range groupDeclarations(locals) {
+				p.node(VarDec, false, func() {
+					p.keyword("var")
+					p.varNames(decs)
+				})
+			}
+			p.statements(sub.Statements)
+			p.symbol("}")
+		})
+	})
+}
+
+func (p *xmlPrinter) statements(statements []ast.Statement) {
+	p.node(Statements, len(statements) == 0, func() {
+		for _, st := range statements {
+			p.statement(st)
+		}
+	})
+}
+
+//{ statements }
+func (p *xmlPrinter) block(statements []ast.Statement) {
+	p.symbol("{")
+	p.statements(statements)
+	p.symbol("}")
+}
+
+func (p *xmlPrinter) statement(st ast.Statement) {
+	switch st.Category() {
+	case ast.LetSc:
+		ls := st.(ast.LetStatement)
+		p.node(LetStatement, false, func() {
+			p.keyword("let")
+			p.reference(ls.Target)
+			p.symbol("=")
+			p.expression(ls.Expression)
+			p.symbol(";")
+		})
+	case ast.IfSc:
+		is := st.(ast.IfStatement)
+		p.node(IfStatement, false, func() {
+			p.keyword("if")
+			p.symbol("(")
+			p.expression(is.Condition)
+			p.symbol(")")
+			p.block(is.Statements)
+			if is.ElsePos.Line > 0 || len(is.ElseStatements) > 0 {
+				p.keyword("else")
+				p.block(is.ElseStatements)
+			}
+		})
+	case ast.WhileSc:
+		ws := st.(ast.WhileStatement)
+		p.node(WhileStatement, false, func() {
+			p.keyword("while")
+			p.symbol("(")
+			p.expression(ws.Condition)
+			p.symbol(")")
+			p.block(ws.Statements)
+		})
+	case ast.DoSc:
+		p.node(DoStatement, false, func() {
+			p.keyword("do")
+			p.subCall(st.(ast.DoStatement).Action)
+			p.symbol(";")
+		})
+	case ast.RetSc:
+		rs := st.(ast.ReturnStatement)
+		p.node(ReturnStatement, false, func() {
+			p.keyword("return")
+			if !rs.Expression.IsEmpty() {
+				p.expression(rs.Expression)
+			}
+			p.symbol(";")
+		})
+	case ast.BadSc:
+		bs := st.(ast.BadStatement)
+		p.node(ErrorNode, len(bs.Tokens) == 0, func() {
+			for _, t := range bs.Tokens {
+				p.terminal(TokenType(t.Type), t.Val)
+			}
+		})
+	}
+}
+
+func (p *xmlPrinter) expression(exp ast.Expression) {
+	p.node(Expression, false, func() {
+		p.term(exp.Terms[0])
+		for i, op := range exp.Operations {
+			p.symbol(op)
+			p.term(exp.Terms[i+1])
+		}
+	})
+}
+
+func (p *xmlPrinter) term(term ast.Term) {
+	p.node(TokenTerm, false, func() {
+		switch term.Category() {
+		case ast.ConstantTc:
+			ct := term.(ast.ConstTerm)
+			switch ct.Kind {
+			case ast.IntegerConst:
+				p.terminal(IntegerConstant, strconv.Itoa(ct.Val.(int)))
+			default:
+				p.terminal(TokenType(ct.Kind), ct.Val.(string))
+			}
+		case ast.ExpressionTc:
+			p.symbol("(")
+			p.expression(term.(ast.Expression))
+			p.symbol(")")
+		case ast.UnaryTc:
+			ut := term.(ast.UnaryTerm)
+			p.symbol(ut.Operator)
+			p.term(ut.Term)
+		case ast.ReferenceTc:
+			p.reference(term.(ast.ReferenceTerm))
+		case ast.SubCallTc:
+			p.subCall(term.(ast.SubroutineCall))
+		}
+	})
+}
+
+//name or name[expression]
+func (p *xmlPrinter) reference(ref ast.ReferenceTerm) {
+	p.identifier(ref.VarName)
+	if ref.IsArrayRef() {
+		p.symbol("[")
+		p.expression(ref.Index)
+		p.symbol("]")
+	}
+}
+
+func (p *xmlPrinter) subCall(call ast.SubroutineCall) {
+	if len(call.Target) > 0 {
+		p.identifier(call.Target)
+		p.symbol(".")
+	}
+	p.identifier(call.Name)
+	p.symbol("(")
+	p.node(ExpressionList, len(call.Args) == 0, func() {
+		for i, arg := range call.Args {
+			if i > 0 {
+				p.symbol(",")
+			}
+			p.expression(arg)
+		}
+	})
+	p.symbol(")")
+}
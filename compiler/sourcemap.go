@@ -0,0 +1,119 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
+)
+
+//classSource is the jack source of a class
+type classSource struct {
+	file     string
+	lines    []string
+	comments bool //emit a comment with the jack line before the vm code of each statement
+}
+
+//comment shows the jack line of a position, e.g. `// Main.jack:42  let x = y;`
+func (src *classSource) comment(pos ast.Pos) string {
+	comment := fmt.Sprintf("// %s:%d", filepath.Base(src.file), pos.Line)
+	if pos.Line > 0 && pos.Line <= len(src.lines) {
+		comment += "  " + strings.TrimSpace(src.lines[pos.Line-1])
+	}
+	return comment
+}
+
+//SourceMap maps the lines of a vm file to the positions of the jack file it's compiled from,
+//with the symbols of the class for debuggers
+type SourceMap struct {
+	Source      string              `json:"source"` //jack file
+	Class       string              `json:"class"`
+	Variables   []VarSymbol         `json:"variables"` //fields and statics
+	Subroutines []SubroutineSymbols `json:"subroutines"`
+	Mappings    []Mapping           `json:"mappings"`
+}
+
+//VarSymbol is a variable of the symbol table, it's stored at Index of the Segment
+type VarSymbol struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Kind    string `json:"kind"` //field, static, argument or local
+	Segment string `json:"segment"`
+	Index   int    `json:"index"`
+}
+
+//SubroutineSymbols are the arguments and locals of a subroutine, 'this' is the first argument of a method
+type SubroutineSymbols struct {
+	Name      string      `json:"name"` //vm function name, e.g. Main.main
+	Category  string      `json:"category"`
+	Line      int         `json:"line"`
+	Variables []VarSymbol `json:"variables"`
+}
+
+//Mapping is the position of the jack statement(or subroutine declaration) a vm line is compiled from,
+//lines and columns start from 1
+type Mapping struct {
+	VMLine int `json:"vmLine"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+//tableSymbols returns the variables of a symbol table ordered by kind and index
+func tableSymbols(table *symbolTable, class string) []VarSymbol {
+	var syms []VarSymbol
+	for _, v := range table.table {
+		typ := v.Type
+		if v.Name == thisRef.Name && v.Type == thisRef.Type {
+			typ = class
+		}
+		syms = append(syms, VarSymbol{Name: v.Name, Type: typ, Kind: string(v.Kind), Segment: v.memSeg(), Index: v.offset})
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		if syms[i].Kind != syms[j].Kind {
+			return syms[i].Kind < syms[j].Kind
+		}
+		return syms[i].Index < syms[j].Index
+	})
+	return syms
+}
+
+//renderPositions serializes the instructions to vm lines, commented with the jack lines of their positions
+//if asked, and maps the rendered lines to the positions when the source is known
+func renderPositions(insts []ir.Instruction, src *classSource) ([]string, *SourceMap) {
+	var rendered []string
+	var sm *SourceMap
+	if src != nil {
+		sm = &SourceMap{Source: filepath.Base(src.file)}
+	}
+	var commented int //line of the last comment
+	for _, inst := range insts {
+		pos := inst.Pos
+		if src != nil && src.comments && pos.Line != commented {
+			rendered = append(rendered, src.comment(pos))
+			commented = pos.Line
+		}
+		rendered = append(rendered, inst.String())
+		if sm != nil {
+			sm.Mappings = append(sm.Mappings, Mapping{VMLine: len(rendered), Line: pos.Line, Column: pos.Column})
+		}
+	}
+	return rendered, sm
+}
+
+//ReadSourceMap reads a source map written with Options.SourceMap
+func ReadSourceMap(path string) (*SourceMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sm := &SourceMap{}
+	if err := json.Unmarshal(data, sm); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return sm, nil
+}
@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sourceMapPoint = `class Main {
+	function int max(int a, int b) {
+		if (a > b) {
+			return a;
+		}
+		return b;
+	}
+}`
+
+func TestCompile_SourceComments(t *testing.T) {
+	dir := writeSources(t, map[string]string{"Main.jack": sourceMapPoint})
+	defer os.RemoveAll(dir)
+	assert.Nil(t, compileFiles([]string{filepath.Join(dir, "Main.jack")}, dir, Options{SourceComments: true, SourceMap: true}))
+	code, err := ioutil.ReadFile(filepath.Join(dir, "Main.vm"))
+	assert.Nil(t, err)
+	assert.Equal(t, `// Main.jack:2  function int max(int a, int b) {
+function Main.max 0
+// Main.jack:3  if (a > b) {
+push argument 0
+push argument 1
+gt
+if-goto IF_0
+goto ENDIF_0
+label IF_0
+// Main.jack:4  return a;
+push argument 0
+return
+// Main.jack:3  if (a > b) {
+label ENDIF_0
+// Main.jack:6  return b;
+push argument 1
+return`, string(code))
+
+	sm, err := ReadSourceMap(filepath.Join(dir, "Main.vm.map"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Main.jack", sm.Source)
+	assert.Equal(t, 12, len(sm.Mappings))
+	assert.Equal(t, Mapping{VMLine: 2, Line: 2, Column: 15}, sm.Mappings[0])
+	assert.Equal(t, Mapping{VMLine: 4, Line: 3, Column: 3}, sm.Mappings[1])
+	assert.Equal(t, Mapping{VMLine: 11, Line: 4, Column: 4}, sm.Mappings[7])
+	assert.Equal(t, Mapping{VMLine: 17, Line: 6, Column: 3}, sm.Mappings[11])
+	assert.Equal(t, "Main", sm.Class)
+	assert.Equal(t, []SubroutineSymbols{{Name: "Main.max", Category: "function", Line: 2, Variables: []VarSymbol{
+		{Name: "a", Type: "int", Kind: "argument", Segment: "argument", Index: 0},
+		{Name: "b", Type: "int", Kind: "argument", Segment: "argument", Index: 1},
+	}}}, sm.Subroutines)
+}
+
+//the comments don't change the vm code
+func TestCompile_SourceMapOnly(t *testing.T) {
+	dir := writeSources(t, map[string]string{"Main.jack": sourceMapPoint})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "Main.jack")
+	assert.Nil(t, compileFiles([]string{file}, dir, Options{}))
+	plain, err := ioutil.ReadFile(filepath.Join(dir, "Main.vm"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "Main.vm.map"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, compileFiles([]string{file}, dir, Options{SourceComments: true}))
+	commented, err := ioutil.ReadFile(filepath.Join(dir, "Main.vm"))
+	assert.Nil(t, err)
+	var lines []string
+	for _, line := range strings.Split(string(commented), "\n") {
+		if !strings.HasPrefix(line, "//") {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, string(plain), strings.Join(lines, "\n"))
+
+	assert.Nil(t, compileFiles([]string{file}, dir, Options{SourceMap: true}))
+	sm, err := ReadSourceMap(filepath.Join(dir, "Main.vm.map"))
+	assert.Nil(t, err)
+	assert.Equal(t, len(strings.Split(string(plain), "\n")), len(sm.Mappings))
+	assert.Equal(t, Mapping{VMLine: 2, Line: 3, Column: 3}, sm.Mappings[1])
+}
+
+//the dumps of the ir have the same instructions as the vm code
+func TestCompile_DumpIR(t *testing.T) {
+	dir := writeSources(t, map[string]string{"Main.jack": sourceMapPoint})
+	defer os.RemoveAll(dir)
+	assert.Nil(t, compileFiles([]string{filepath.Join(dir, "Main.jack")}, dir, Options{DumpIR: true}))
+	vm, err := ioutil.ReadFile(filepath.Join(dir, "Main.vm"))
+	assert.Nil(t, err)
+	dump, err := ioutil.ReadFile(filepath.Join(dir, "Main.ir"))
+	assert.Nil(t, err)
+	var insts []string
+	for _, line := range strings.Split(string(dump), "\n") {
+		if strings.HasPrefix(line, "  ") {
+			insts = append(insts, strings.TrimSpace(strings.Split(line, "//")[0]))
+		}
+	}
+	assert.Equal(t, string(vm), strings.Join(insts, "\n"))
+	assert.Contains(t, string(dump), "//3:3")
+	dot, err := ioutil.ReadFile(filepath.Join(dir, "Main.dot"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(dot), "digraph \"Main\" {"))
+}
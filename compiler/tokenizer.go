@@ -4,14 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"math"
 	"strconv"
+	"unicode"
 )
 
 type tokenizer struct {
-	file         string
-	tokens       []Token
-	currentToken []rune
+	file        string
+	tokens      []Token
+	diagnostics DiagnosticList
 }
 
 type TokensWriter interface {
@@ -30,114 +30,195 @@ func (tow *tokensOnlyWriter) Write(writer io.Writer, ts ...Token) {
 
 }
 
+//Tokenize keeps scanning after a lexical error, all the errors are returned as a DiagnosticList
 func (tokenizer *tokenizer) Tokenize(rd io.Reader) error {
-	reader := bufio.NewReader(rd)
-	var lineCount int
+	sc := newScanner(rd)
 	for {
-		lineCount++
-		line, _, e := reader.ReadLine()
-		if e != nil {
-			if e != io.EOF {
-				fmt.Println(fmt.Sprintf("read from reader err:%s", e.Error()))
-				return e
-			}
-			//end of file
-			return nil
+		t, e := sc.next()
+		if e == nil {
+			tokenizer.tokens = append(tokenizer.tokens, t)
+			continue
+		}
+		if e == io.EOF {
+			break
 		}
-		e = tokenizer.tokenize(string(line), lineCount)
-		if e != nil {
-			fmt.Println(fmt.Sprintf("err in file %s, line %d, error:%s", tokenizer.file, lineCount, e.Error()))
-			return e
+		if d, ok := e.(*Diagnostic); ok {
+			tokenizer.diagnostics.Add(d)
+			continue
 		}
+		tokenizer.diagnostics.Add(newDiagnostic(CodeReadError, sc.line, sc.column, fmt.Sprintf("read from reader err:%s", e.Error())))
+		break
 	}
+	return tokenizer.diagnostics.inFile(tokenizer.file).Err()
+}
+
+type scanState int
+
+const (
+	inCode scanState = iota
+	inLineComment
+	inBlockComment
+	inString
+)
+
+//scanner reads the source rune by rune, the state is kept across lines so that
+//block comments and string constants are recognized wherever they appear
+type scanner struct {
+	reader       *bufio.Reader
+	state        scanState
+	line, column int //position of the next rune
+	peeked       []rune
+}
+
+func newScanner(rd io.Reader) *scanner {
+	return &scanner{reader: bufio.NewReader(rd), line: 1, column: 1}
 }
 
-func (tokenizer *tokenizer) tokenize(line string, lineCount int) error {
-	line = removeComments(line)
-	if len(line) == 0 {
-		return nil
+func (s *scanner) peek() (rune, error) {
+	if len(s.peeked) == 0 {
+		r, _, err := s.reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		s.peeked = append(s.peeked, r)
 	}
-	return tokenizer.lexicalAnalysis(line, lineCount)
+	return s.peeked[0], nil
 }
 
-func buildToken(currentToken []rune, lineCount int) (Token, error) {
-	typ, err := resolveTokenType(string(currentToken))
+func (s *scanner) read() (rune, error) {
+	r, err := s.peek()
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	s.peeked = s.peeked[1:]
+	if r == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
 	}
-	return &TerminalToken{typ, string(currentToken), lineCount}, nil
+	return r, nil
 }
 
-func (t *tokenizer) lexicalAnalysis(line string, lineCount int) error {
-	rs := []rune(line)
-	for i := 0; i < len(rs); i++ {
-		r := []rune(line)[i]
-		if isWord(r) {
-			t.currentToken = append(t.currentToken, r)
-		} else if isNumber(r) {
-			t.currentToken = append(t.currentToken, r)
-		} else if isSymbol(r) {
-			err := t.flush(lineCount)
-			if err != nil {
-				return err
+func (s *scanner) errorf(code DiagnosticCode, line, column int, format string, args ...interface{}) error {
+	d := newDiagnostic(code, line, column, fmt.Sprintf(format, args...))
+	if line == s.line {
+		d.EndColumn = s.column
+	}
+	return d
+}
+
+//next returns the next terminal token, io.EOF is returned at the end of source
+func (s *scanner) next() (*TerminalToken, error) {
+	var val []rune
+	var line, column int
+	for {
+		r, err := s.peek()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
 			}
-			tt := &TerminalToken{Symbol, string(r), lineCount}
-			t.tokens = append(t.tokens, tt)
-		} else if r == ' ' {
-			err := t.flush(lineCount)
-			if err != nil {
-				return err
+			state := s.state
+			s.state = inCode
+			switch state {
+			case inBlockComment:
+				return nil, s.errorf(CodeUnterminatedComment, s.line, s.column, "unterminated comment")
+			case inString:
+				return nil, s.errorf(CodeUnterminatedString, line, column, "unterminated string constant")
 			}
-		} else if r == '"' {
-			t.currentToken = append(t.currentToken, '"')
-			for i < len(line) {
-				i++
-				nr := line[i]
-				if nr == '"' {
-					t.currentToken = append(t.currentToken, '"')
-					err := t.flush(lineCount)
-					if err != nil {
-						return err
-					}
-					break
+			return nil, io.EOF
+		}
+
+		switch s.state {
+		case inLineComment:
+			s.read()
+			if r == '\n' {
+				s.state = inCode
+			}
+		case inBlockComment:
+			s.read()
+			if r == '*' {
+				if n, err := s.peek(); err == nil && n == '/' {
+					s.read()
+					s.state = inCode
+				}
+			}
+		case inString:
+			s.read()
+			if r == '"' {
+				s.state = inCode
+				return &TerminalToken{tokenType: StringConstant, val: string(val), line: line, column: column}, nil
+			}
+			if r == '\n' {
+				s.state = inCode
+				return nil, s.errorf(CodeUnterminatedString, line, column, "unterminated string constant")
+			}
+			val = append(val, r)
+		default:
+			line, column = s.line, s.column
+			if unicode.IsSpace(r) {
+				s.read()
+			} else if r == '/' {
+				s.read()
+				n, err := s.peek()
+				if err == nil && n == '/' {
+					s.read()
+					s.state = inLineComment
+				} else if err == nil && n == '*' {
+					s.read()
+					s.state = inBlockComment
 				} else {
-					t.currentToken = append(t.currentToken, rune(nr))
+					return &TerminalToken{tokenType: Symbol, val: "/", line: line, column: column}, nil
 				}
+			} else if r == '"' {
+				s.read()
+				s.state = inString
+			} else if isSymbol(r) {
+				s.read()
+				return &TerminalToken{tokenType: Symbol, val: string(r), line: line, column: column}, nil
+			} else if isWord(r) {
+				return s.scanWord(line, column)
+			} else if isNumber(r) {
+				return s.scanInteger(line, column)
+			} else {
+				s.read()
+				return nil, s.errorf(CodeInvalidCharacter, line, column, "invalid character:%q", r)
 			}
 		}
 	}
-	err := t.flush(lineCount)
-	if err != nil {
-		return err
-	}
-	return nil
 }
 
-func (t *tokenizer) flush(lineCount int) error {
-	if len(t.currentToken) > 0 {
-		tt, err := buildToken(t.currentToken, lineCount)
-		if err != nil {
-			return err
+func (s *scanner) scanWord(line, column int) (*TerminalToken, error) {
+	var val []rune
+	for {
+		r, err := s.peek()
+		if err != nil || !(isWord(r) || isNumber(r)) {
+			break
 		}
-		t.currentToken = t.currentToken[:0]
-		t.tokens = append(t.tokens, tt)
+		s.read()
+		val = append(val, r)
 	}
-	return nil
-}
-
-func resolveTokenType(s string) (TokenType, error) {
-	if ContainsString(keywords, s) {
-		return Keyword, nil
+	typ := Identifier
+	if ContainsString(keywords, string(val)) {
+		typ = Keyword
 	}
+	return &TerminalToken{tokenType: typ, val: string(val), line: line, column: column}, nil
+}
 
-	if stringReg.MatchString(s) {
-		return StringConstant, nil
-	}
-	if identifierReg.MatchString(s) {
-		return Identifier, nil
+func (s *scanner) scanInteger(line, column int) (*TerminalToken, error) {
+	var val []rune
+	for {
+		r, err := s.peek()
+		if err != nil || !(isWord(r) || isNumber(r)) {
+			break
+		}
+		s.read()
+		val = append(val, r)
 	}
-	if i, err := strconv.Atoi(s); err == nil || i <= math.MaxInt16 {
-		return IntegerConstant, nil
+	if i, err := strconv.Atoi(string(val)); err != nil || i > maxIntegerConstant {
+		return nil, s.errorf(CodeInvalidInteger, line, column, "invalid integer constant:%s", string(val))
 	}
-	return "", fmt.Errorf("syntax error:%s", s)
+	return &TerminalToken{tokenType: IntegerConstant, val: string(val), line: line, column: column}, nil
 }
+
+const maxIntegerConstant = 32767
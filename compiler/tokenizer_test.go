@@ -2,24 +2,109 @@ package compiler
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func Test_removeComments(t *testing.T) {
-	assert.Equal(t, removeComments("//ttt xxx"), "")
-	assert.Equal(t, removeComments("///xxxx"), "")
-	assert.Equal(t, removeComments("aa///"), "aa")
-	assert.Equal(t, removeComments("bbb //ttt xxx //xxx"), "bbb")
-	assert.Equal(t, removeComments("xxx"), "xxx")
-
-	assert.Equal(t, removeComments("/*ttt xxx */"), "")
-	assert.Equal(t, removeComments("aa/*ttt xxx */"), "aa")
-	assert.Equal(t, removeComments("aaa/*ttt xxx */ bbb"), "aaa bbb")
-	assert.Equal(t, removeComments("  /**ttt xxx ****/  "), "")
-	assert.Equal(t, removeComments("  * ttt xxx ****  "), "")
-	assert.Equal(t, removeComments("  /** ttt xxx ****  "), "")
+type expectedToken struct {
+	typ          TokenType
+	val          string
+	line, column int
+}
+
+func TestTokenizer_Comments(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		tokens []expectedToken
+	}{
+		{"line comment", "//ttt xxx", nil},
+		{"triple slash", "///xxxx", nil},
+		{"trailing line comment", "aa///", []expectedToken{{Identifier, "aa", 1, 1}}},
+		{"nested line comment", "bbb //ttt xxx //xxx", []expectedToken{{Identifier, "bbb", 1, 1}}},
+		{"no comment", "xxx", []expectedToken{{Identifier, "xxx", 1, 1}}},
+		{"block comment", "/*ttt xxx */", nil},
+		{"trailing block comment", "aa/*ttt xxx */", []expectedToken{{Identifier, "aa", 1, 1}}},
+		{"inline block comment", "aaa/*ttt xxx */ bbb", []expectedToken{{Identifier, "aaa", 1, 1}, {Identifier, "bbb", 1, 17}}},
+		{"doc comment", "  /**ttt xxx ****/  ", nil},
+		{"multi line block comment", "/* let x = 1;\nlet y = 2;\n   do foo(); */ x", []expectedToken{{Identifier, "x", 3, 17}}},
+		{"multi line doc comment", "/**\n * let a = b;\n */\nreturn;", []expectedToken{{ReturnStatement, "return", 4, 1}, {Symbol, ";", 4, 7}}},
+		{"comment opener in block comment", "/* /* // */ a", []expectedToken{{Identifier, "a", 1, 13}}},
+		{"stars in block comment", "/***/ a /* ** / */", []expectedToken{{Identifier, "a", 1, 7}}},
+		{"division", "a/b", []expectedToken{{Identifier, "a", 1, 1}, {Symbol, "/", 1, 2}, {Identifier, "b", 1, 3}}},
+	}
+	for _, c := range cases {
+		assertTokens(t, c.name, c.source, c.tokens)
+	}
+}
+
+func TestTokenizer_Tokens(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		tokens []expectedToken
+	}{
+		{"statement", "let x = x + 10;", []expectedToken{
+			{LetStatement, "let", 1, 1}, {Identifier, "x", 1, 5}, {Symbol, "=", 1, 7}, {Identifier, "x", 1, 9},
+			{Symbol, "+", 1, 11}, {IntegerConstant, "10", 1, 13}, {Symbol, ";", 1, 15}}},
+		{"string with comment", `do Output.printString("a // b /* c */");`, []expectedToken{
+			{DoStatement, "do", 1, 1}, {Identifier, "Output", 1, 4}, {Symbol, ".", 1, 10}, {Identifier, "printString", 1, 11},
+			{Symbol, "(", 1, 22}, {StringConstant, "a // b /* c */", 1, 23}, {Symbol, ")", 1, 39}, {Symbol, ";", 1, 40}}},
+		{"tabs and crlf", "\tvar int\ti;\r\n\tlet i=-1;", []expectedToken{
+			{VarStatement, "var", 1, 2}, {Keyword, "int", 1, 6}, {Identifier, "i", 1, 10}, {Symbol, ";", 1, 11},
+			{LetStatement, "let", 2, 2}, {Identifier, "i", 2, 6}, {Symbol, "=", 2, 7}, {Symbol, "-", 2, 8},
+			{IntegerConstant, "1", 2, 9}, {Symbol, ";", 2, 10}}},
+		{"identifier with digits", "a_1[i2]", []expectedToken{
+			{Identifier, "a_1", 1, 1}, {Symbol, "[", 1, 4}, {Identifier, "i2", 1, 5}, {Symbol, "]", 1, 7}}},
+		{"keyword prefix", "classes class", []expectedToken{{Identifier, "classes", 1, 1}, {Keyword, "class", 1, 9}}},
+		{"max integer", "32767", []expectedToken{{IntegerConstant, "32767", 1, 1}}},
+	}
+	for _, c := range cases {
+		assertTokens(t, c.name, c.source, c.tokens)
+	}
+}
+
+func TestTokenizer_Errors(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		errs   []*Diagnostic
+	}{
+		{"unterminated comment", "a /* b\n c", []*Diagnostic{
+			{Code: CodeUnterminatedComment, Line: 2, Column: 3, EndColumn: 3, Message: "unterminated comment"}}},
+		{"unterminated string", "let s = \"abc\nx\";", []*Diagnostic{
+			{Code: CodeUnterminatedString, Line: 1, Column: 9, EndColumn: 9, Message: "unterminated string constant"},
+			{Code: CodeUnterminatedString, Line: 2, Column: 2, EndColumn: 4, Message: "unterminated string constant"}}},
+		{"unterminated string at eof", "\"abc", []*Diagnostic{
+			{Code: CodeUnterminatedString, Line: 1, Column: 1, EndColumn: 5, Message: "unterminated string constant"}}},
+		{"invalid character", "let a = b # c;", []*Diagnostic{
+			{Code: CodeInvalidCharacter, Line: 1, Column: 11, EndColumn: 12, Message: "invalid character:'#'"}}},
+		{"integer overflow", "let a = 32768;", []*Diagnostic{
+			{Code: CodeInvalidInteger, Line: 1, Column: 9, EndColumn: 14, Message: "invalid integer constant:32768"}}},
+		{"multiple errors", "let a = 12ab;\nlet b = $;", []*Diagnostic{
+			{Code: CodeInvalidInteger, Line: 1, Column: 9, EndColumn: 13, Message: "invalid integer constant:12ab"},
+			{Code: CodeInvalidCharacter, Line: 2, Column: 9, EndColumn: 10, Message: "invalid character:'$'"}}},
+	}
+	for _, c := range cases {
+		tokenizer := &tokenizer{file: "Main.jack"}
+		err := tokenizer.Tokenize(strings.NewReader(c.source))
+		for _, d := range c.errs {
+			d.File = "Main.jack"
+		}
+		assert.Equal(t, DiagnosticList(c.errs), err, c.name)
+	}
+}
+
+func assertTokens(t *testing.T, name string, source string, expected []expectedToken) {
+	tokenizer := &tokenizer{}
+	assert.Nil(t, tokenizer.Tokenize(strings.NewReader(source)), name)
+	var actual []expectedToken
+	for _, token := range tokenizer.tokens {
+		actual = append(actual, expectedToken{typeOf(token), token.GetVal(), token.Position(), token.Column()})
+	}
+	assert.Equal(t, expected, actual, name)
 }
 
 func TestTokenizer_Tokenize(t *testing.T) {
@@ -0,0 +1,277 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+const (
+	vchar  vType = "char"
+	vArray vType = "Array"
+	vnull  vType = "null"
+	//type of terms which can't be inferred, e.g. elements of Array, it matches all the types
+	vunknown vType = ""
+)
+
+var primitiveTypes = []vType{vinteger, vchar, vboolean}
+
+func (t vType) isPrimitive() bool {
+	for _, p := range primitiveTypes {
+		if p == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (t vType) isNumeric() bool {
+	return t == vinteger || t == vchar || t == vunknown
+}
+
+//int and char are interchangeable, null can be assigned to any object,
+//and any object can be used as an Array which is the raw pointer of jack(e.g. Memory.deAlloc(this))
+func assignable(from vType, to vType) bool {
+	if from == to || from == vunknown || to == vunknown {
+		return true
+	}
+	if from.isNumeric() && to.isNumeric() {
+		return true
+	}
+	if to == vArray {
+		return !from.isPrimitive()
+	}
+	return from == vnull && !to.isPrimitive()
+}
+
+//typeChecker infers the type of every expression with the declared types of variables and subroutines,
+//it's only run with Options.StrictTypes since jack itself doesn't check types
+type typeChecker struct {
+	index *programIndex
+}
+
+func newTypeChecker(index *programIndex) *typeChecker {
+	return &typeChecker{index: index}
+}
+
+func (tc *typeChecker) checkClass(jc ast.Class) DiagnosticList {
+	var diagnostics DiagnosticList
+	table := NewClassSymbolTable()
+	for _, dec := range jc.Declarations {
+		table.add(dec)
+	}
+	for _, sub := range jc.Subroutines {
+		c := &subroutineTypeChecker{
+			checker:     tc,
+			class:       jc,
+			sub:         sub,
+			table:       NewSubroutineSymbolTable(table),
+			diagnostics: &diagnostics,
+		}
+		c.check()
+	}
+	return diagnostics
+}
+
+type subroutineTypeChecker struct {
+	checker     *typeChecker
+	class       ast.Class
+	sub         ast.Subroutine
+	table       *symbolTable
+	diagnostics *DiagnosticList
+}
+
+func (c *subroutineTypeChecker) report(code DiagnosticCode, pos ast.Pos, msg string, hints ...string) {
+	c.diagnostics.Add(newDiagnostic(code, pos.Line, pos.Column, msg, hints...))
+}
+
+func (c *subroutineTypeChecker) check() {
+	if c.sub.Category == ast.Method {
+		c.table.asMethod()
+	}
+	for _, dec := range c.sub.Declarations {
+		c.table.add(dec)
+	}
+	c.checkStatements(c.sub.Statements)
+}
+
+func (c *subroutineTypeChecker) checkStatements(statements []ast.Statement) {
+	for _, st := range statements {
+		switch st.Category() {
+		case ast.DoSc:
+			c.typeOfSubCall(st.(ast.DoStatement).Action)
+		case ast.RetSc:
+			rs := st.(ast.ReturnStatement)
+			if !rs.Expression.IsEmpty() {
+				c.expect(rs.Expression, vType(c.sub.RetType), fmt.Sprintf("return value of %s", c.sub.Name))
+			}
+		case ast.LetSc:
+			ls := st.(ast.LetStatement)
+			target := c.typeOfReference(ls.Target)
+			c.expect(ls.Expression, target, fmt.Sprintf("assignment to %s", ls.Target.VarName))
+		case ast.IfSc:
+			is := st.(ast.IfStatement)
+			c.expectCondition(is.Condition, "if")
+			c.checkStatements(is.Statements)
+			c.checkStatements(is.ElseStatements)
+		case ast.WhileSc:
+			ws := st.(ast.WhileStatement)
+			c.expectCondition(ws.Condition, "while")
+			c.checkStatements(ws.Statements)
+		}
+	}
+}
+
+func (c *subroutineTypeChecker) expect(exp ast.Expression, expected vType, context string) {
+	if actual := c.typeOfExpression(exp); !assignable(actual, expected) {
+		c.report(CodeTypeMismatch, exp.Position(), fmt.Sprintf("%s expects %s, got %s", context, expected, actual))
+	}
+}
+
+func (c *subroutineTypeChecker) expectCondition(exp ast.Expression, statement string) {
+	if actual := c.typeOfExpression(exp); actual != vboolean && actual != vunknown {
+		c.report(CodeConditionType, exp.Position(), fmt.Sprintf("%s condition must be boolean, got %s", statement, actual))
+	}
+}
+
+//operations are applied from left to right, so is the inference
+func (c *subroutineTypeChecker) typeOfExpression(exp ast.Expression) vType {
+	if exp.IsEmpty() {
+		return vunknown
+	}
+	typ := c.typeOfTerm(exp.Terms[0])
+	for i, op := range exp.Operations {
+		right := c.typeOfTerm(exp.Terms[i+1])
+		typ = c.typeOfOperation(op, typ, right, exp.Terms[i+1].Position())
+	}
+	return typ
+}
+
+func (c *subroutineTypeChecker) typeOfOperation(op string, left vType, right vType, pos ast.Pos) vType {
+	switch op {
+	case "+", "-", "*", "/":
+		if !left.isNumeric() || !right.isNumeric() {
+			c.report(CodeInvalidOperand, pos, fmt.Sprintf("operator %s is not defined on %s and %s", op, left, right))
+			return vunknown
+		}
+		return vinteger
+	case "&", "|":
+		if left == vboolean && right == vboolean {
+			return vboolean
+		}
+		if left.isNumeric() && right.isNumeric() {
+			return vinteger
+		}
+		if left == vunknown || right == vunknown {
+			return vunknown
+		}
+		c.report(CodeInvalidOperand, pos, fmt.Sprintf("operator %s is not defined on %s and %s", op, left, right))
+		return vunknown
+	case "<", ">":
+		if !left.isNumeric() || !right.isNumeric() {
+			c.report(CodeInvalidOperand, pos, fmt.Sprintf("operator %s is not defined on %s and %s", op, left, right))
+		}
+		return vboolean
+	case "=":
+		if !assignable(left, right) && !assignable(right, left) {
+			c.report(CodeInvalidOperand, pos, fmt.Sprintf("%s can't be compared with %s", left, right))
+		}
+		return vboolean
+	}
+	return vunknown
+}
+
+func (c *subroutineTypeChecker) typeOfTerm(term ast.Term) vType {
+	switch term.Category() {
+	case ast.ConstantTc:
+		ct := term.(ast.ConstTerm)
+		switch ct.Kind {
+		case ast.IntegerConst:
+			return vinteger
+		case ast.StringConst:
+			return vType("String")
+		}
+		switch ct.Val {
+		case "true", "false":
+			return vboolean
+		case "null":
+			return vnull
+		case "this":
+			return vType(c.class.Name)
+		}
+	case ast.ExpressionTc:
+		return c.typeOfExpression(term.(ast.Expression))
+	case ast.UnaryTc:
+		ut := term.(ast.UnaryTerm)
+		typ := c.typeOfTerm(ut.Term)
+		if ut.Operator == "-" && !typ.isNumeric() {
+			c.report(CodeInvalidOperand, ut.Term.Position(), fmt.Sprintf("operator - is not defined on %s", typ))
+			return vunknown
+		}
+		if ut.Operator == "~" && typ != vboolean && !typ.isNumeric() {
+			c.report(CodeInvalidOperand, ut.Term.Position(), fmt.Sprintf("operator ~ is not defined on %s", typ))
+			return vunknown
+		}
+		return typ
+	case ast.ReferenceTc:
+		return c.typeOfReference(term.(ast.ReferenceTerm))
+	case ast.SubCallTc:
+		return c.typeOfSubCall(term.(ast.SubroutineCall))
+	}
+	return vunknown
+}
+
+//the elements of an Array have no type
+func (c *subroutineTypeChecker) typeOfReference(ref ast.ReferenceTerm) vType {
+	v, ok := c.table.getRecursively(ref.VarName)
+	if !ok {
+		return vunknown
+	}
+	if !ref.IsArrayRef() {
+		return vType(v.Type)
+	}
+	if vType(v.Type) != vArray {
+		c.report(CodeTypeMismatch, ref.Pos, fmt.Sprintf("%s of %s can't be indexed", ref.VarName, v.Type))
+	}
+	if typ := c.typeOfExpression(ref.Index); !typ.isNumeric() {
+		c.report(CodeTypeMismatch, ref.Index.Position(), fmt.Sprintf("index of %s must be int, got %s", ref.VarName, typ))
+	}
+	return vunknown
+}
+
+func (c *subroutineTypeChecker) typeOfSubCall(call ast.SubroutineCall) vType {
+	var argTypes []vType
+	for _, arg := range call.Args {
+		argTypes = append(argTypes, c.typeOfExpression(arg))
+	}
+
+	className := call.Target
+	if len(call.Target) == 0 {
+		className = c.class.Name
+	} else if v, ok := c.table.getRecursively(call.Target); ok {
+		if vType(v.Type).isPrimitive() {
+			c.report(CodeNotAnObject, call.Pos, fmt.Sprintf("%s of %s has no method %s", call.Target, v.Type, call.Name))
+			return vunknown
+		}
+		className = v.Type
+		if ci, ok := c.checker.index.class(className); ok {
+			if _, ok := ci.subroutine(call.Name); !ok {
+				c.report(CodeUnknownSubroutine, call.Pos, fmt.Sprintf("class %s of %s has no method %s", className, call.Target, call.Name))
+				return vunknown
+			}
+		}
+	}
+
+	callee, ok := c.checker.index.lookup(className, call.Name)
+	if !ok {
+		return vunknown
+	}
+	params := callee.Params()
+	for i, arg := range call.Args {
+		if i < len(params) && !assignable(argTypes[i], vType(params[i].Type)) {
+			c.report(CodeTypeMismatch, arg.Position(), fmt.Sprintf("argument %s of %s.%s expects %s, got %s",
+				params[i].Name, className, call.Name, params[i].Type, argTypes[i]))
+		}
+	}
+	return vType(callee.RetType)
+}
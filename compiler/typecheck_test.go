@@ -0,0 +1,112 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+func TestTypeChecker(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		codes []DiagnosticCode
+	}{
+		{"valid", `
+		let i = p.getX() + 1;
+		let c = 65;
+		let i = c - 1;
+		let s = "abc";
+		let p = null;
+		let a = Array.new(3);
+		let a[i] = s;
+		let s = a[0];
+		let b = (i < 3) & ~b;
+		if (p = null) {
+			do Output.printString(s);
+		}`, nil},
+		{"string as int argument", `
+		do Output.printInt(s);`, []DiagnosticCode{CodeTypeMismatch}},
+		{"int as condition", `
+		while (i) {
+			let i = i - 1;
+		}
+		if (i + 1) {
+			return;
+		}`, []DiagnosticCode{CodeConditionType, CodeConditionType}},
+		{"method not on class", `
+		do p.getY();`, []DiagnosticCode{CodeUnknownSubroutine}},
+		{"method on primitive", `
+		do i.foo();`, []DiagnosticCode{CodeNotAnObject}},
+		{"assignment", `
+		let i = s;
+		let p = s;
+		let b = 1;`, []DiagnosticCode{CodeTypeMismatch, CodeTypeMismatch, CodeTypeMismatch}},
+		{"operands", `
+		let i = s + 1;
+		let b = b < 1;
+		let i = -b;
+		let b = p = 1;`, []DiagnosticCode{CodeInvalidOperand, CodeInvalidOperand, CodeInvalidOperand, CodeInvalidOperand}},
+		{"array index", `
+		let i = a[s];
+		let i = i[0];`, []DiagnosticCode{CodeTypeMismatch, CodeTypeMismatch}},
+	}
+	point := parseSource(t, checkerPoint)
+	for _, c := range cases {
+		main := parseSource(t, `
+class Main {
+	function void main() {
+		var int i;
+		var char c;
+		var boolean b;
+		var String s;
+		var Point p;
+		var Array a;
+`+c.body+`
+		return;
+	}
+}`)
+		var codes []DiagnosticCode
+		for _, d := range newTypeChecker(newProgramIndex([]ast.Class{point, main})).checkClass(main) {
+			codes = append(codes, d.Code)
+		}
+		assert.Equal(t, c.codes, codes, c.name)
+	}
+}
+
+func TestTypeChecker_ReturnType(t *testing.T) {
+	main := parseSource(t, `class Main {
+	function int foo() {
+		return "foo";
+	}
+	function Main bar() {
+		return null;
+	}
+}`)
+	diagnostics := newTypeChecker(newProgramIndex([]ast.Class{main})).checkClass(main)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "3:10: error JACK0050: return value of foo expects int, got String", diagnostics[0].Error())
+}
+
+func TestCompileDirWithOptions_StrictTypes(t *testing.T) {
+	for _, source := range []string{"Pong", "Square", "fibonacci", "Seven"} {
+		dir, err := ioutil.TempDir("", "jack")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		assert.Nil(t, CompileDirWithOptions(filepath.Join("../sample", source), dir, Options{StrictTypes: true}), source)
+	}
+
+	dir := writeSources(t, map[string]string{"Main.jack": `class Main {
+	function void main() {
+		do Output.printInt("1");
+		return;
+	}
+}`})
+	defer os.RemoveAll(dir)
+	assert.Nil(t, CompileDir(dir, dir))
+	assert.NotNil(t, CompileDirWithOptions(dir, dir, Options{StrictTypes: true}))
+}
@@ -1,8 +1,6 @@
 package compiler
 
 import (
-	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -28,9 +26,6 @@ func EscapeXml(s string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(s, "&", "&amp;"), ">", "&gt;"), "<", "&lt;")
 }
 
-var stringReg = regexp.MustCompile(`^".*"$`)
-var identifierReg = regexp.MustCompile(`^[a-zA-Z]\w*$`)
-
 func isWord(r rune) bool {
 	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
 }
@@ -39,12 +34,6 @@ func isNumber(r rune) bool {
 	return r >= '0' && r <= '9'
 }
 
-var commentReg = regexp.MustCompile(`(/\*([^*]|[\r\n]|(\*+([^*/]|[\r\n])))*\*+/)|(//.*)|(^\*[^\/]).*|(^(\/\*\*).*)|^(\*\/)`)
-
-func removeComments(line string) string {
-	return strings.TrimSpace(commentReg.ReplaceAllString(strings.TrimSpace(line), ""))
-}
-
 type TokenIterator struct {
 	tokens []Token
 	i      int
@@ -77,25 +66,3 @@ func (it *TokenIterator) Peek() Token {
 	}
 	return it.tokens[it.i]
 }
-
-func IsDot(t Token) bool {
-	return t.GetType() == Symbol && t.GetVal() == "."
-}
-
-func newGrammarError(t Token, msg string) error {
-	return fmt.Errorf("%s, line:%d", msg, t.Position())
-}
-
-func newSyntaxError(t Token) error {
-	return newGrammarError(t, "syntax error")
-}
-
-//find matched sub tokens
-func match(t Token, tag TokenType) (ts []Token) {
-	for _, sub := range t.SubTokens() {
-		if sub.GetType() == tag {
-			ts = append(ts, sub)
-		}
-	}
-	return
-}
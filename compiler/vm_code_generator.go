@@ -2,825 +2,399 @@ package compiler
 
 import (
 	"fmt"
-	"io"
-	"strconv"
 	"strings"
-)
 
-type jackClass struct {
-	name         string
-	declarations []variable
-	subroutines  []subroutine
-}
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+	"github.com/zhangwuh/jack-compiler/compiler/ir"
+)
 
 type vmCompiler struct {
-	class         jackClass
+	class         ast.Class
+	index         *programIndex
 	classSymTable *symbolTable
 	labelCounter  int
+	diagnostics   DiagnosticList
+	source        *classSource //jack source for the comments of source positions and the source map, optional
+	sourceMap     *SourceMap
+	symbols       []SubroutineSymbols
+	optimize      bool //double for the multiplications by powers of two, test the comparisons of loops at the bottom and rewrite the vm code with the peephole rules
+	inline        bool //replace the calls of small subroutines by their bodies
+	//blocks of the vm functions compiled, for the dumps of the ir
+	functions []*ir.Function
 }
 
-func NewVmCompiler(class jackClass) *vmCompiler {
+func NewVmCompiler(class ast.Class, index *programIndex) *vmCompiler {
 	return &vmCompiler{
 		class:         class,
+		index:         index,
 		classSymTable: NewClassSymbolTable(),
 	}
 }
 
+//compile keeps going after an error so that all the problems of the class are reported.
+//The instructions are grouped into the blocks of the functions, which are serialized to vm code at last
 func (vc *vmCompiler) compile() (string, error) {
-	err := vc.compileClassDeclarations(vc.class.declarations)
-	if err != nil {
+	vc.compileClassDeclarations(vc.class.Declarations)
+	insts := vc.compileSubRoutines(vc.class.Subroutines)
+	if err := vc.diagnostics.Err(); err != nil {
 		return "", err
 	}
-	code, err := vc.compileSubRoutines(vc.class.subroutines)
-	if err != nil {
-		return "", err
+	if vc.optimize {
+		insts = optimize(insts)
 	}
-	return code, nil
-}
-
-//parse tokenized results to structured class
-func (w *vmCompiler) compileAndWrite(writer io.Writer) {
-	code, err := w.compile()
-	if err != nil {
-		fmt.Printf("err when compule to vm code:%v", err)
-		return
+	vc.functions = ir.Build(insts)
+	var code []ir.Instruction
+	for _, f := range vc.functions {
+		code = append(code, f.Instructions()...)
 	}
-	if _, err = writer.Write([]byte(code)); err != nil {
-		fmt.Printf("err when write to output file:%v", err)
+	var lines []string
+	lines, vc.sourceMap = renderPositions(code, vc.source)
+	if vc.sourceMap != nil {
+		vc.sourceMap.Class = vc.class.Name
+		vc.sourceMap.Variables = tableSymbols(vc.classSymTable, vc.class.Name)
+		vc.sourceMap.Subroutines = vc.symbols
 	}
+	return strings.Join(lines, "\n"), nil
 }
 
-func (vc *vmCompiler) compileClassDeclarations(declarations []variable) error {
+func (vc *vmCompiler) compileClassDeclarations(declarations []ast.Variable) {
 	for _, dec := range declarations {
-		if err := vc.classSymTable.add(dec); err != nil {
-			return err
-		}
+		vc.diagnostics.AddError(vc.classSymTable.add(dec), CodeRedeclaredVar)
 	}
-	return nil
 }
 
-func (vc *vmCompiler) compileSubRoutines(subroutines []subroutine) (string, error) {
-	var lines []string
+func (vc *vmCompiler) compileSubRoutines(subroutines []ast.Subroutine) []ir.Instruction {
+	var lines []ir.Instruction
 	for _, sub := range subroutines {
 		sc := newSubRoutineCompiler(vc.class, vc.classSymTable, vc)
-		sl, err := sc.compileSubRoutine(sub)
-		if err != nil {
-			return "", err
-		}
-		lines = append(lines, sl...)
+		lines = append(lines, sc.compileSubRoutine(sub)...)
 	}
-	return strings.Join(lines, "\n"), nil
+	return lines
 }
 
 type subRoutineCompiler struct {
-	class  jackClass
+	class  ast.Class
 	table  *symbolTable
 	parent *vmCompiler
+	frame  *subRoutineCompiler //compiler of the vm function, it's not itself for the body of an inlined subroutine
+	locals int                 //local slots of the vm function, the inlined subroutines get slots after the declared locals
+	free   int                 //first local slot free for an inlined subroutine
+	ret    string              //label jumped to by the returns of an inlined body, empty for a vm function
 }
 
-func newSubRoutineCompiler(class jackClass, parentTable *symbolTable, parent *vmCompiler) *subRoutineCompiler {
-	return &subRoutineCompiler{class: class, table: NewSubroutineSymbolTable(parentTable), parent: parent}
+func newSubRoutineCompiler(class ast.Class, parentTable *symbolTable, parent *vmCompiler) *subRoutineCompiler {
+	c := &subRoutineCompiler{class: class, table: NewSubroutineSymbolTable(parentTable), parent: parent}
+	c.frame = c
+	return c
 }
 
-func (c *subRoutineCompiler) compileSubRoutine(sub subroutine) ([]string, error) {
-	if sub.category == method {
+func (c *subRoutineCompiler) compileSubRoutine(sub ast.Subroutine) []ir.Instruction {
+	if sub.Category == ast.Method {
 		c.table.asMethod() // 'this' is always the first element in the symbol table
 	}
 
-	var varCount int
-	for _, dec := range sub.declarations {
-		if dec.kind == klocal {
-			varCount++
-		}
-		if err := c.table.add(dec); err != nil {
-			return nil, err
+	for _, dec := range sub.Declarations {
+		if dec.Kind == ast.Local {
+			c.locals++
 		}
+		c.parent.diagnostics.AddError(c.table.add(dec), CodeRedeclaredVar)
 	}
+	c.free = c.locals
 
-	var lines []string
-	lines = append(lines, fmt.Sprintf("function %s.%s %d", c.class.name, sub.name, varCount))
-	if sub.category == constructor {
-		vcount, _ := c.table.parent.count(kfield)
-		lines = append(lines, fmt.Sprintf("push constant %d", vcount)) //for memory alloc
-		lines = append(lines, "call Memory.alloc 1")
-		lines = append(lines, "pop pointer 0") //init address of 'this'
-	} else if sub.category == method {
-		lines = append(lines, "push argument 0")
-		lines = append(lines, "pop pointer 0") //init address of 'this'
+	if c.parent.source != nil {
+		c.parent.symbols = append(c.parent.symbols, SubroutineSymbols{
+			Name:      fmt.Sprintf("%s.%s", c.class.Name, sub.Name),
+			Category:  string(sub.Category),
+			Line:      sub.Pos.Line,
+			Variables: tableSymbols(c.table, c.class.Name),
+		})
+	}
+
+	slines := c.compileStatements(sub.Statements) //before the declaration which counts the slots of the inlined subroutines
+	var lines []ir.Instruction
+	lines = append(lines, ir.Func(fmt.Sprintf("%s.%s", c.class.Name, sub.Name), c.locals))
+	if sub.Category == ast.Constructor {
+		vcount, _ := c.table.parent.count(ast.Field)
+		lines = append(lines, ir.Push("constant", vcount)) //for memory alloc
+		lines = append(lines, ir.Call("Memory.alloc", 1))
+		lines = append(lines, ir.Pop("pointer", 0)) //init address of 'this'
+	} else if sub.Category == ast.Method {
+		lines = append(lines, ir.Push("argument", 0))
+		lines = append(lines, ir.Pop("pointer", 0)) //init address of 'this'
 	}
-	slines := c.compileStatements(sub.statements)
+	lines = atPos(lines, sub.Pos)
 	lines = append(lines, slines...)
-	return lines, nil
+	return lines
 }
 
-func (c *subRoutineCompiler) compileStatements(statements []Statement) []string {
-	var lines []string
+//atPos sets the source position of the instructions which have none, the ones of the nested statements keep theirs
+func atPos(lines []ir.Instruction, pos ast.Pos) []ir.Instruction {
+	for i := range lines {
+		if lines[i].Pos == (ast.Pos{}) {
+			lines[i].Pos = pos
+		}
+	}
+	return lines
+}
+
+func (c *subRoutineCompiler) compileStatements(statements []ast.Statement) []ir.Instruction {
+	var lines []ir.Instruction
 	for _, st := range statements {
-		switch st.category() {
-		case doSc:
-			lines = append(lines, c.compileDoStatement(st.(doStatement))...)
-		case retSc:
-			lines = append(lines, c.compileReturnStatement(st.(retStatement))...)
-		case letSc:
-			lines = append(lines, c.compileLetStatement(st.(letStatement))...)
-		case ifSc:
-			lines = append(lines, c.compileIfStatement(st.(ifStatement))...)
-		case whileSc:
-			lines = append(lines, c.compileWhileStatement(st.(whileStatement))...)
+		var slines []ir.Instruction
+		switch st.Category() {
+		case ast.DoSc:
+			slines = c.compileDoStatement(st.(ast.DoStatement))
+		case ast.RetSc:
+			slines = c.compileReturnStatement(st.(ast.ReturnStatement))
+		case ast.LetSc:
+			slines = c.compileLetStatement(st.(ast.LetStatement))
+		case ast.IfSc:
+			slines = c.compileIfStatement(st.(ast.IfStatement))
+		case ast.WhileSc:
+			slines = c.compileWhileStatement(st.(ast.WhileStatement))
 		}
+		lines = append(lines, atPos(slines, st.Position())...)
 	}
 	return lines
 }
 
-func (c *subRoutineCompiler) compileDoStatement(st doStatement) []string {
-	var lines []string
-	lines = append(lines, c.compileSubCall(st.action)...)
-	lines = append(lines, "pop temp 0") // store sub call return val to temp
+func (c *subRoutineCompiler) compileDoStatement(st ast.DoStatement) []ir.Instruction {
+	var lines []ir.Instruction
+	lines = append(lines, c.compileSubCall(st.Action)...)
+	lines = append(lines, ir.Pop("temp", 0)) // store sub call return val to temp
 	return lines
 }
 
-func (c *subRoutineCompiler) compileSubCall(call subroutineCall) []string {
-	var lines []string
-	onTarget := call.target //object | method | function
-	argSize := len(call.args)
+func (c *subRoutineCompiler) compileSubCall(call ast.SubroutineCall) []ir.Instruction {
+	if lines, ok := c.inlineSubCall(call); ok {
+		return lines
+	}
+	var lines []ir.Instruction
+	onTarget := call.Target //object | method | function
+	argSize := len(call.Args)
 	if len(onTarget) == 0 { //call on `this`
-		onTarget = c.class.name
-		lines = append(lines, "push pointer 0")
-		argSize++
+		onTarget = c.class.Name
+		if callee, ok := c.parent.index.lookup(onTarget, call.Name); !ok || callee.Category == ast.Method {
+			lines = append(lines, ir.Push("pointer", 0))
+			argSize++
+		}
 	} else {
 		v, ok := c.table.getRecursively(onTarget)
 		if ok { //call on `that`
-			onTarget = string(v.typ)
-			lines = append(lines, fmt.Sprintf("push %s %d", v.memSeg(), v.offset))
+			onTarget = v.Type
+			lines = append(lines, ir.Push(v.memSeg(), v.offset))
 			argSize++
 		}
 	}
-	for _, arg := range call.args {
+	for _, arg := range call.Args {
 		lines = append(lines, c.compileExpression(arg)...)
 	}
 
-	lines = append(lines, fmt.Sprintf("call %s.%s %d", onTarget, call.name, argSize))
+	lines = append(lines, ir.Call(fmt.Sprintf("%s.%s", onTarget, call.Name), argSize))
 	return lines
 }
 
-func (c *subRoutineCompiler) compileExpression(exp expression) []string {
-	var lines []string
+func (c *subRoutineCompiler) compileExpression(exp ast.Expression) []ir.Instruction {
+	var lines []ir.Instruction
+	if exp.IsEmpty() {
+		return lines
+	}
 
-	var left, right Term
-	var opIndex int
-	for _, term := range exp.terms {
-		if left == nil {
-			left = term
-			lines = append(lines, c.compileTerm(left)...)
-		} else {
-			right = term
-			lines = append(lines, c.compileTerm(right)...)
-			lines = append(lines, c.compileOperator(exp.operations[opIndex]))
-			opIndex++
-			left = nil
-			right = nil
+	//no operator precedence in jack, operations are applied strictly from left to right
+	lines = append(lines, c.compileTerm(exp.Terms[0])...)
+	for i, op := range exp.Operations {
+		if k, ok := powerOfTwo(exp.Terms[i+1]); ok && op == "*" && c.parent.optimize {
+			lines = append(lines, double(k)...)
+			continue
 		}
+		lines = append(lines, c.compileTerm(exp.Terms[i+1])...)
+		lines = append(lines, c.compileOperator(op))
 	}
 
 	return lines
 }
 
-func (c *subRoutineCompiler) compileTerm(term Term) []string {
-	var lines []string
+func (c *subRoutineCompiler) compileTerm(term ast.Term) []ir.Instruction {
+	var lines []ir.Instruction
 
-	switch term.category() {
-	case constantTerm:
-		lines = append(lines, c.compileConstTerm(term.(ConstTerm))...)
-	case expressionTerm:
-		lines = append(lines, c.compileExpression(term.(expression))...)
-	case unaryTerm:
-		lines = append(lines, c.compileUnaryTerm(term.(UnaryTerm))...)
-	case referenceTerm:
-		lines = append(lines, c.compileReferenceTerm(term.(ReferenceTerm))...)
-	case subCallTerm:
-		lines = append(lines, c.compileSubCall(term.(subroutineCall))...)
+	switch term.Category() {
+	case ast.ConstantTc:
+		lines = append(lines, c.compileConstTerm(term.(ast.ConstTerm))...)
+	case ast.ExpressionTc:
+		lines = append(lines, c.compileExpression(term.(ast.Expression))...)
+	case ast.UnaryTc:
+		lines = append(lines, c.compileUnaryTerm(term.(ast.UnaryTerm))...)
+	case ast.ReferenceTc:
+		lines = append(lines, c.compileReferenceTerm(term.(ast.ReferenceTerm))...)
+	case ast.SubCallTc:
+		lines = append(lines, c.compileSubCall(term.(ast.SubroutineCall))...)
 	}
 
 	return lines
 }
 
-func (c *subRoutineCompiler) compileOperator(s string) string {
+//double multiplies the value on the stack by 2^k without calling Math.multiply, temp 1 holds the value being doubled.
+//There is no shift in the vm, so the divisions by powers of two are still calls of Math.divide
+func double(k int) []ir.Instruction {
+	var lines []ir.Instruction
+	for i := 0; i < k; i++ {
+		lines = append(lines, ir.Pop("temp", 1), ir.Push("temp", 1), ir.Push("temp", 1), ir.Arithmetic(ir.OpAdd))
+	}
+	return lines
+}
+
+func (c *subRoutineCompiler) compileOperator(s string) ir.Instruction {
 	return operations[s]
 }
 
-func (c *subRoutineCompiler) compileConstTerm(term ConstTerm) []string {
-	var lines []string
-	switch term.ttype {
-	case IntegerConstant:
-		lines = append(lines, fmt.Sprintf("push constant %d", term.val.(int)))
-	case StringConstant:
-		val := term.val.(string)
-		lines = append(lines, fmt.Sprintf("push constant %d", len(val)))
-		lines = append(lines, "call String.new 1")
+func (c *subRoutineCompiler) compileConstTerm(term ast.ConstTerm) []ir.Instruction {
+	var lines []ir.Instruction
+	switch term.Kind {
+	case ast.IntegerConst:
+		lines = append(lines, ir.Push("constant", term.Val.(int)))
+	case ast.StringConst:
+		val := term.Val.(string)
+		lines = append(lines, ir.Push("constant", len(val)))
+		lines = append(lines, ir.Call("String.new", 1))
 		for _, r := range val {
-			lines = append(lines, fmt.Sprintf("push constant %d", r))
-			lines = append(lines, "call String.appendChar 2") //operate on base address of str and current rune
+			lines = append(lines, ir.Push("constant", int(r)))
+			lines = append(lines, ir.Call("String.appendChar", 2)) //operate on base address of str and current rune
 		}
-	case Keyword:
-		val := term.val.(string)
+	case ast.KeywordConst:
+		val := term.Val.(string)
 		if val == "null" || val == "false" {
-			lines = append(lines, "push constant 0")
+			lines = append(lines, ir.Push("constant", 0))
 		} else if val == "true" { //true mapped to -1
-			lines = append(lines, "push constant 1")
-			lines = append(lines, "neg")
+			lines = append(lines, ir.Push("constant", 1))
+			lines = append(lines, ir.Arithmetic(ir.OpNeg))
 		} else if val == "this" {
-			lines = append(lines, "push pointer 0")
+			lines = append(lines, ir.Push("pointer", 0))
 		}
 	}
 	return lines
 }
 
-func (c *subRoutineCompiler) compileUnaryTerm(term UnaryTerm) []string {
-	var lines []string
+func (c *subRoutineCompiler) compileUnaryTerm(term ast.UnaryTerm) []ir.Instruction {
+	var lines []ir.Instruction
 
-	lines = append(lines, c.compileTerm(term.term)...)
-	if term.operator == "~" {
-		lines = append(lines, "not")
-	} else if term.operator == "-" {
-		lines = append(lines, "neg")
+	lines = append(lines, c.compileTerm(term.Term)...)
+	if term.Operator == "~" {
+		lines = append(lines, ir.Arithmetic(ir.OpNot))
+	} else if term.Operator == "-" {
+		lines = append(lines, ir.Arithmetic(ir.OpNeg))
 	}
 	return lines
 }
 
-func (c *subRoutineCompiler) compileArrayRef(arr variable, exp expression, forAssignment bool) []string {
-	var lines []string
-	lines = append(lines, fmt.Sprintf("push %s %d", arr.memSeg(), arr.offset))
+func (c *subRoutineCompiler) compileArrayRef(arr variable, exp ast.Expression, forAssignment bool) []ir.Instruction {
+	var lines []ir.Instruction
+	lines = append(lines, ir.Push(arr.memSeg(), arr.offset))
 	lines = append(lines, c.compileExpression(exp)...)
-	lines = append(lines, "add")
+	lines = append(lines, ir.Arithmetic(ir.OpAdd))
 	if forAssignment {
-		lines = append(lines, "pop pointer 1")
-		lines = append(lines, "pop that 0")
+		lines = append(lines, ir.Pop("pointer", 1))
+		lines = append(lines, ir.Pop("that", 0))
 	} else {
-		lines = append(lines, "pop pointer 1")
-		lines = append(lines, "push that 0")
+		lines = append(lines, ir.Pop("pointer", 1))
+		lines = append(lines, ir.Push("that", 0))
 	}
 	return lines
 }
 
-func (c *subRoutineCompiler) compileReferenceTerm(term ReferenceTerm) []string {
-	var lines []string
+func (c *subRoutineCompiler) compileReferenceTerm(term ast.ReferenceTerm) []ir.Instruction {
+	var lines []ir.Instruction
 
-	ref, ok := c.table.getRecursively(term.varName)
+	ref, ok := c.table.getRecursively(term.VarName)
 	if !ok {
-		panic(undeclaredVarErr(term.varName))
+		c.parent.diagnostics.AddError(undeclaredVarErr(term.VarName, term.Pos), CodeUndeclaredVar)
+		return lines
 	}
-	if term.isArrayRef() {
-		lines = append(lines, c.compileArrayRef(ref, term.index, false)...)
+	if term.IsArrayRef() {
+		lines = append(lines, c.compileArrayRef(ref, term.Index, false)...)
 	} else {
-		lines = append(lines, fmt.Sprintf("push %s %d", ref.memSeg(), ref.offset))
+		lines = append(lines, ir.Push(ref.memSeg(), ref.offset))
 	}
 
 	return lines
 }
 
-func (c *subRoutineCompiler) compileReturnStatement(statement retStatement) []string {
-	var lines []string
-	if statement.expression.isEmpty() {
-		lines = append(lines, "push constant 0")
+func (c *subRoutineCompiler) compileReturnStatement(statement ast.ReturnStatement) []ir.Instruction {
+	var lines []ir.Instruction
+	if statement.Expression.IsEmpty() {
+		lines = append(lines, ir.Push("constant", 0))
 	} else {
-		lines = append(lines, c.compileExpression(statement.expression)...)
+		lines = append(lines, c.compileExpression(statement.Expression)...)
+	}
+	if len(c.ret) > 0 {
+		lines = append(lines, ir.Goto(c.ret)) //the value returned is left on the stack
+		return lines
 	}
-	lines = append(lines, "return")
+	lines = append(lines, ir.Return())
 	return lines
 }
 
-func (c *subRoutineCompiler) compileLetStatement(statement letStatement) []string {
-	var lines []string
-	lines = append(lines, c.compileExpression(statement.expression)...)
-	target := statement.target
-	v, ok := c.table.getRecursively(target.varName)
+func (c *subRoutineCompiler) compileLetStatement(statement ast.LetStatement) []ir.Instruction {
+	var lines []ir.Instruction
+	lines = append(lines, c.compileExpression(statement.Expression)...)
+	target := statement.Target
+	v, ok := c.table.getRecursively(target.VarName)
 	if !ok {
-		panic(undeclaredVarErr(target.varName))
+		c.parent.diagnostics.AddError(undeclaredVarErr(target.VarName, target.Pos), CodeUndeclaredVar)
+		return lines
 	}
-	if target.isArrayRef() {
-		lines = append(lines, c.compileArrayRef(v, target.index, true)...)
+	if target.IsArrayRef() {
+		lines = append(lines, c.compileArrayRef(v, target.Index, true)...)
 	} else {
-		lines = append(lines, fmt.Sprintf("pop %s %d", v.memSeg(), v.offset))
+		lines = append(lines, ir.Pop(v.memSeg(), v.offset))
 	}
 	return lines
 }
 
-func (c *subRoutineCompiler) compileIfStatement(statement ifStatement) []string {
-	var lines []string
+func (c *subRoutineCompiler) compileIfStatement(statement ast.IfStatement) []ir.Instruction {
+	var lines []ir.Instruction
 	id := c.parent.labelCounter
 	c.parent.labelCounter++
 
-	lines = append(lines, c.compileExpression(statement.condition)...)
-	lines = append(lines, fmt.Sprintf("if-goto IF_%d", id))
-	lines = append(lines, c.compileStatements(statement.elseStatements)...)
-	lines = append(lines, fmt.Sprintf("goto ENDIF_%d", id))
-	lines = append(lines, fmt.Sprintf("label IF_%d", id))
-	lines = append(lines, c.compileStatements(statement.statements)...)
-	lines = append(lines, fmt.Sprintf("label ENDIF_%d", id))
+	lines = append(lines, c.compileExpression(statement.Condition)...)
+	lines = append(lines, ir.IfGoto(fmt.Sprintf("IF_%d", id)))
+	lines = append(lines, c.compileStatements(statement.ElseStatements)...)
+	lines = append(lines, ir.Goto(fmt.Sprintf("ENDIF_%d", id)))
+	lines = append(lines, ir.Label(fmt.Sprintf("IF_%d", id)))
+	lines = append(lines, c.compileStatements(statement.Statements)...)
+	lines = append(lines, ir.Label(fmt.Sprintf("ENDIF_%d", id)))
 
 	return lines
 }
 
-func (c *subRoutineCompiler) compileWhileStatement(statement whileStatement) []string {
-	var lines []string
+func (c *subRoutineCompiler) compileWhileStatement(statement ast.WhileStatement) []ir.Instruction {
+	var lines []ir.Instruction
 	id := c.parent.labelCounter
 	c.parent.labelCounter++
-	lines = append(lines, fmt.Sprintf("label WHILE_%d", id))
-	lines = append(lines, c.compileExpression(statement.condition)...)
-	lines = append(lines, "not")
-	lines = append(lines, fmt.Sprintf("if-goto END_WHILE_%d", id))
-	lines = append(lines, c.compileStatements(statement.statements)...)
-	lines = append(lines, fmt.Sprintf("goto WHILE_%d", id))
-	lines = append(lines, fmt.Sprintf("label END_WHILE_%d", id))
+	condition := c.compileExpression(statement.Condition)
+	if c.parent.optimize && len(condition) > 0 && isComparison(condition[len(condition)-1]) {
+		return c.compileBottomTestedLoop(statement, condition, id)
+	}
+	lines = append(lines, ir.Label(fmt.Sprintf("WHILE_%d", id)))
+	lines = append(lines, condition...)
+	lines = append(lines, ir.Arithmetic(ir.OpNot))
+	lines = append(lines, ir.IfGoto(fmt.Sprintf("END_WHILE_%d", id)))
+	lines = append(lines, c.compileStatements(statement.Statements)...)
+	lines = append(lines, ir.Goto(fmt.Sprintf("WHILE_%d", id)))
+	lines = append(lines, ir.Label(fmt.Sprintf("END_WHILE_%d", id)))
 	return lines
 }
 
-var emptyClass = jackClass{}
-
-//convert lexial tree to structed class
-func parseClass(ts Token) (jackClass, error) {
-	root := ts.(*NonTerminalToken)
-	name, err := resolveClassName(root)
-	if err != nil {
-		return emptyClass, nil
-	}
-
-	jc := jackClass{
-		name: name,
-	}
-
-	declarations, err := resolveClassVarDecs(root)
-	if err != nil {
-		return emptyClass, err
-	}
-	jc.declarations = append(jc.declarations, declarations...)
-
-	subroutines, err := resolveSubroutines(root)
-	if err != nil {
-		return emptyClass, err
-	}
-	jc.subroutines = append(jc.subroutines, subroutines...)
-
-	return jc, nil
-}
-
-func resolveSubroutines(root *NonTerminalToken) ([]subroutine, error) {
-	var subs []subroutine
-	for _, item := range root.subTokens {
-		if item.GetType() == SubroutineDec {
-			sdc, err := resolveSubroutine(item)
-			if err != nil {
-				return nil, err
-			}
-			subs = append(subs, sdc)
-		}
-	}
-	return subs, nil
-}
-
-var emptySubroutine = subroutine{}
-
-/*
- input:
-<subroutineDec>
-        <keyword>function</keyword>
-        <keyword>void</keyword>
-        <identifier>foo</identifier>
-        <symbol>(</symbol>
-        <parameterList>
-			...
-        </parameterList>
-        <symbol>)</symbol>
-        <subroutineBody>
-			...
-		</subroutineBody>
-</subroutineDec>
-*/
-func resolveSubroutine(token Token) (subroutine, error) {
-	sub := subroutine{}
-	sts := token.SubTokens()
-	sub.category = subroutineCategory(sts[0].GetVal())
-	sub.retType = sts[1].GetVal()
-	sub.name = sts[2].GetVal()
-	params := match(token, ParameterList)
-	if len(params) == 0 {
-		return emptySubroutine, newSyntaxError(token)
-	}
-	sub.declarations = append(sub.declarations, resolveParams(params[0])...)
-
-	body := match(token, SubroutineBody)[0]
-
-	for _, st := range match(body, VarDec) {
-		sub.declarations = append(sub.declarations, resolveVarDec(st)...)
-	}
-
-	for _, st := range match(body, Statements) {
-		statements, err := resolveStatements(st)
-		if err != nil {
-			return emptySubroutine, err
-		}
-		sub.statements = append(sub.statements, statements...)
-	}
-
-	return sub, nil
-}
-
-func resolveVarDec(st Token) []variable {
-	var vs []variable
-	kind := klocal
-	typ := vType(st.SubTokens()[1].GetVal())
-	it := NewTokenIterator(st.SubTokens()[2:])
-	for it.HasNext() {
-		n := it.Next()
-		if n.GetType() == Identifier {
-			vs = append(vs, variable{
-				name: n.GetVal(),
-				kind: kind,
-				typ:  typ,
-			})
-		}
-	}
-	return vs
-}
-
-func resolveStatements(st Token) ([]Statement, error) {
-	if err := assertToken(st, Statements, ""); err != nil {
-		return nil, err
-	}
-	var sts []Statement
-	for _, s := range st.SubTokens() {
-		statement, err := resolveStatement(s)
-		if err != nil {
-			return nil, err
-		}
-		sts = append(sts, statement)
-	}
-	return sts, nil
-}
-
-func resolveStatement(st Token) (Statement, error) {
-	switch st.GetType() {
-	case IfStatement:
-		return resolveIfStatement(st)
-	case LetStatement:
-		return resolveLetStatement(st)
-	case DoStatement:
-		return resolveDoStatement(st)
-	case ReturnStatement:
-		return resolveReturnStatement(st)
-	case WhileStatement:
-		return resolveWhileStatement(st)
-	default:
-		return nil, newSyntaxError(st)
-	}
-}
-
-func resolveWhileStatement(st Token) (Statement, error) {
-	if err := assertToken(st, WhileStatement, ""); err != nil {
-		return nil, err
-	}
-	stat := whileStatement{}
-	cond, err := resolveExpression(match(st, Expression)[0])
-	if err != nil {
-		return nil, err
-	}
-	stat.condition = cond
-	sts, err := resolveStatements(match(st, Statements)[0])
-	if err != nil {
-		return nil, err
-	}
-	stat.statements = sts
-	return stat, nil
-}
-
-func resolveReturnStatement(st Token) (Statement, error) {
-	if err := assertToken(st, ReturnStatement, ""); err != nil {
-		return nil, err
-	}
-	stat := retStatement{}
-	it := NewTokenIterator(st.SubTokens())
-	it.Next() //pop 'return'
-	next := it.Next()
-
-	if next.GetType() == Expression {
-		exp, err := resolveExpression(next)
-		if err != nil {
-			return nil, err
-		}
-		stat.expression = exp
-	}
-	return stat, nil
-}
-
-func resolveDoStatement(st Token) (Statement, error) {
-	if err := assertToken(st, DoStatement, ""); err != nil {
-		return nil, err
-	}
-	it := NewTokenIterator(st.SubTokens())
-	if err := assertToken(it.Next(), Keyword, "do"); err != nil {
-		return nil, err
-	}
-
-	target := it.Next()
-	if err := assertToken(target, Identifier, ""); err != nil {
-		return nil, err
-	}
-
-	var name string
-	next := it.Peek()
-	if next.GetType() == Symbol && next.GetVal() == "." {
-		it.Next() //pop '.'
-		callee := it.Next()
-		if err := assertToken(callee, Identifier, ""); err != nil {
-			return nil, err
-		}
-		name = callee.GetVal()
-	}
-	it.Next()           //pop (
-	params := it.Next() //expression list
-	if err := assertToken(params, ExpressionList, ""); err != nil {
-		return nil, err
-	}
-	subcall, err := resolveSubcall(st, target.GetVal(), name)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(subcall.name) == 0 {
-		subcall.target = ""
-		subcall.name = target.GetVal()
-	}
-	return doStatement{
-		action: subcall,
-	}, nil
-
-}
-
-func resolveLetStatement(st Token) (Statement, error) {
-	if err := assertToken(st, LetStatement, ""); err != nil {
-		return nil, err
-	}
-	stat := letStatement{}
-	it := NewTokenIterator(st.SubTokens())
-	it.Next() //let
-	varName := it.Next().GetVal()
-	if it.Peek().GetVal() == "[" { //ref to array
-		it.Next() //pop [
-		exp, err := resolveExpression(it.Next())
-		if err != nil {
-			return nil, err
-		}
-		stat.target = ReferenceTerm{varName: varName, index: exp}
-	} else {
-		stat.target = ReferenceTerm{varName: varName}
-	}
-	for it.HasNext() {
-		next := it.Next()
-		if next.GetVal() == "=" && next.GetType() == Symbol {
-			exp, err := resolveExpression(it.Next())
-			if err != nil {
-				return nil, err
-			}
-			stat.expression = exp
-			break
-		}
-	}
-	return stat, nil
-}
-
-func resolveIfStatement(st Token) (Statement, error) {
-	is := ifStatement{}
-
-	it := NewTokenIterator(st.SubTokens())
-	for it.HasNext() {
-		sub := it.Next()
-		if sub.GetType() == Keyword {
-			if sub.GetVal() == "if" {
-				for it.HasNext() {
-					if it.Peek().GetType() == Expression {
-						con, err := resolveExpression(it.Next())
-						if err != nil {
-							return nil, err
-						}
-						is.condition = con
-						continue
-					} else if it.Peek().GetType() == Statements {
-						statements, err := resolveStatements(it.Next())
-						if err != nil {
-							return nil, err
-						}
-						is.statements = statements
-						break
-					}
-					it.Next()
-				}
-			} else if sub.GetVal() == "else" {
-				it.Next() //pop {
-				elseStatements, err := resolveStatements(it.Next())
-				if err != nil {
-					return nil, err
-				}
-				is.elseStatements = elseStatements
-				break
-			}
-		}
-	}
-	return is, nil
-}
-
-var emptyExpression = expression{}
-
-func resolveExpression(token Token) (expression, error) {
-	exp := expression{}
-	if err := assertToken(token, Expression, ""); err != nil {
-		return emptyExpression, err
-	}
-	it := NewTokenIterator(token.SubTokens())
-
-	term, err := resolveTerm(it.Next())
-	if err != nil {
-		return emptyExpression, err
-	}
-	exp.terms = append(exp.terms, term)
-	for it.HasNext() {
-		st := it.Next()
-		if st.GetType() == Symbol && operations[st.GetVal()] != "" {
-			exp.operations = append(exp.operations, st.GetVal())
-			term, err := resolveTerm(it.Next())
-			if err != nil {
-				return emptyExpression, err
-			}
-			exp.terms = append(exp.terms, term)
-		}
-	}
-	return exp, nil
-}
-
-var emptyTerm = ConstTerm{}
-
-func resolveTerm(token Token) (term Term, err error) {
-	it := NewTokenIterator(token.SubTokens())
-	for it.HasNext() {
-		t := it.Next()
-		switch t.GetType() {
-		case IntegerConstant:
-			iv, err := strconv.Atoi(t.GetVal())
-			if err != nil {
-				return nil, newGrammarError(t, "int required")
-			}
-			return ConstTerm{ttype: IntegerConstant, val: iv}, nil
-		case StringConstant:
-			return ConstTerm{ttype: StringConstant, val: t.GetVal()}, nil
-		case Keyword:
-			if ContainsString(keywordConstants, t.GetVal()) {
-				return ConstTerm{ttype: Keyword, val: t.GetVal()}, nil
-			}
-		case Symbol:
-			op := t.GetVal()
-			if op == "-" || op == "~" {
-				next := it.Next()
-				if err = assertToken(next, TokenTerm, ""); err != nil {
-					return nil, err
-				}
-				term, err = resolveTerm(next)
-				if err == nil {
-					term = UnaryTerm{operator: op, term: term}
-				}
-				return term, nil
-			} else if op == "(" {
-				expression, err := resolveExpression(it.Next())
-				if err != nil {
-					return emptyExpression, err
-				}
-				return expression, nil
-			}
-		case Identifier:
-			target := t.GetVal()
-			if !it.HasNext() {
-				return ReferenceTerm{varName: target}, nil
-			}
-			next := it.Next()
-			if next.GetType() == Symbol {
-				if next.GetVal() == "." {
-					subcallee := it.Next()
-					if err := assertToken(subcallee, Identifier, ""); err != nil {
-						return emptySubCall, err
-					}
-					subcall, err := resolveSubcall(token, target, subcallee.GetVal())
-					if err != nil {
-						return emptyTerm, err
-					}
-					return subcall, nil
-				} else if next.GetVal() == "(" {
-					subcall, err := resolveSubcall(token, "", target)
-					if err != nil {
-						return emptyTerm, err
-					}
-					return subcall, nil
-				} else if next.GetVal() == "[" {
-					exp, err := resolveExpression(it.Next())
-					if err != nil {
-						return emptyTerm, err
-					}
-					return ReferenceTerm{varName: target, index: exp}, nil
-				}
-			}
-		}
-	}
-	return nil, newSyntaxError(token)
-}
-
-var emptySubCall = subroutineCall{}
-
-func resolveSubcall(parent Token, target string, name string) (subroutineCall, error) {
-	args, err := resolveExpressionList(match(parent, ExpressionList)[0])
-	if err != nil {
-		return emptySubCall, err
-	}
-	return subroutineCall{
-		target: target,
-		name:   name,
-		args:   args,
-	}, nil
-}
-
-func resolveExpressionList(ts Token) ([]expression, error) {
-	es := match(ts, Expression)
-	var exps []expression
-	for _, e := range es {
-		exp, err := resolveExpression(e)
-		if err != nil {
-			return nil, err
-		}
-		exps = append(exps, exp)
-	}
-	return exps, nil
-}
-
-/*
-	input:
-		<parameterList>
-            <identifier>string</identifier>
-            <identifier>x</identifier>
-            <symbol>,</symbol>
-            <keyword>int</keyword>
-            <identifier>y</identifier>
-        </parameterList>
-*/
-func resolveParams(params Token) []variable {
-	var vs []variable
-	it := NewTokenIterator(params.SubTokens())
-	for it.HasNext() {
-		if it.Peek().GetVal() == "," {
-			it.Next()
-		}
-		vs = append(vs, variable{
-			typ:  vType(it.Next().GetVal()),
-			name: it.Next().GetVal(),
-			kind: kargument,
-		})
-	}
-	return vs
-}
-
-func resolveClassVarDecs(root *NonTerminalToken) ([]variable, error) {
-	var vars []variable
-	for _, item := range root.subTokens {
-		if item.GetType() == ClassVarDec {
-			vars = append(vars, resolveClassVarDec(item)...)
-		}
-	}
-	return vars, nil
-}
-
-func resolveClassVarDec(item Token) []variable {
-	var vs []variable
-	kind := item.SubTokens()[0]
-	typ := item.SubTokens()[1]
-	it := NewTokenIterator(item.SubTokens()[2:])
-	for it.HasNext() {
-		n := it.Next()
-		if n.GetType() == Identifier {
-			vs = append(vs, variable{
-				name: n.GetVal(),
-				kind: vKind(kind.GetVal()),
-				typ:  vType(typ.GetVal()),
-			})
-		}
-	}
-	return vs
-}
-
-func resolveClassName(root *NonTerminalToken) (string, error) {
-	if err := assertToken(root, Class, ""); err != nil {
-		return "", err
-	}
-	subs := root.subTokens
-	if err := assertToken(subs[0], Keyword, "class"); err != nil {
-		return "", err
-	}
-	if err := assertToken(subs[1], Identifier, ""); err != nil {
-		return "", err
-	}
-	return subs[1].GetVal(), nil
+//compileBottomTestedLoop tests the condition after the body, the loop jumps back while it's true
+//without the `not` of the condition and the `goto` of each iteration.
+//The condition must be a comparison, the `not` of a loop tested first stops it for any value but -1(e.g. `while (x & 1)`)
+//while `if-goto` jumps back for any value but 0
+func (c *subRoutineCompiler) compileBottomTestedLoop(statement ast.WhileStatement, condition []ir.Instruction, id int) []ir.Instruction {
+	var lines []ir.Instruction
+	lines = append(lines, ir.Goto(fmt.Sprintf("WHILE_COND_%d", id)))
+	lines = append(lines, ir.Label(fmt.Sprintf("WHILE_%d", id)))
+	lines = append(lines, c.compileStatements(statement.Statements)...)
+	lines = append(lines, ir.Label(fmt.Sprintf("WHILE_COND_%d", id)))
+	lines = append(lines, condition...)
+	lines = append(lines, ir.IfGoto(fmt.Sprintf("WHILE_%d", id)))
+	return lines
 }
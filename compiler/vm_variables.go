@@ -1,68 +1,62 @@
 package compiler
 
 import (
-	"errors"
 	"fmt"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
 )
 
 type symbolTable struct {
 	table   map[string]variable
-	counter map[vKind]int
+	counter map[ast.VarKind]int
 	parent  *symbolTable
 }
 
 func NewClassSymbolTable() *symbolTable {
 	return &symbolTable{
 		table: map[string]variable{},
-		counter: map[vKind]int{
-			kfield: 0, kstatic: 0,
+		counter: map[ast.VarKind]int{
+			ast.Field: 0, ast.Static: 0,
 		},
 	}
 }
 
-var thisRef = variable{
-	name: "this",
-	typ:  vpointer,
-	kind: kargument,
+var thisRef = ast.Variable{
+	Name: "this",
+	Type: string(vpointer),
+	Kind: ast.Argument,
 }
 
 func NewSubroutineSymbolTable(parent *symbolTable) (st *symbolTable) {
 	return &symbolTable{
 		table: map[string]variable{},
-		counter: map[vKind]int{
-			klocal: 0, kargument: 0,
+		counter: map[ast.VarKind]int{
+			ast.Local: 0, ast.Argument: 0,
 		},
 		parent: parent,
 	}
 }
 
 type vType string
-type vKind string
 
 const (
 	vpointer vType = "pointer"
 	vinteger vType = "int"
 	vstring  vType = "string"
 	vboolean vType = "boolean"
-
-	kargument vKind = "argument" //arguments
-	klocal    vKind = "local"    //local var inside method or function
-	kfield    vKind = "field"    // field in class
-	kstatic   vKind = "static"   // static var
 )
 
+//variable is a declaration in the symbol table with its index in the memory segment
 type variable struct {
-	name   string
-	typ    vType
-	kind   vKind
+	ast.Variable
 	offset int
 }
 
 func (v variable) memSeg() string {
-	if v.kind == kfield {
+	if v.Kind == ast.Field {
 		return "this"
 	}
-	return string(v.kind)
+	return string(v.Kind)
 }
 
 var emptyVar = variable{}
@@ -89,39 +83,49 @@ func (t *symbolTable) getNumber(name string) (int, bool) {
 	return v.offset, ok
 }
 
-func redeclaredVarErr(dec variable) error {
-	return errors.New(fmt.Sprintf("redeclared var:%s", dec.name))
+func redeclaredVarErr(dec ast.Variable) error {
+	d := newDiagnostic(CodeRedeclaredVar, dec.Pos.Line, dec.Pos.Column, fmt.Sprintf("redeclared var:%s", dec.Name))
+	d.EndColumn = dec.Pos.Column + len(dec.Name)
+	return d
 }
 
-func undeclaredVarErr(name string) error {
-	return errors.New(fmt.Sprintf("undefined var %s", name))
+func undeclaredVarErr(name string, pos ast.Pos) error {
+	d := newDiagnostic(CodeUndeclaredVar, pos.Line, pos.Column, fmt.Sprintf("undefined var %s", name),
+		fmt.Sprintf("declare %s with 'var', 'field' or 'static' before using it", name))
+	d.EndColumn = pos.Column + len(name)
+	return d
 }
 
-func (t *symbolTable) add(v variable) error {
-	if _, ok := t.get(v.name); ok {
-		return redeclaredVarErr(v)
+func (t *symbolTable) add(dec ast.Variable) error {
+	if _, ok := t.get(dec.Name); ok {
+		return redeclaredVarErr(dec)
 	}
-	defer t.incCounter(v.kind)
-	offset, err := t.count(v.kind)
+	defer t.incCounter(dec.Kind)
+	offset, err := t.count(dec.Kind)
 	if err != nil {
 		return err
 	}
-	v.offset = offset
-	t.table[v.name] = v
+	t.table[dec.Name] = variable{Variable: dec, offset: offset}
 	return nil
 }
 
-func (t *symbolTable) incCounter(kind vKind) {
+//addAt declares a variable stored at an index of its segment, e.g. the variables of an inlined subroutine
+//moved to the local slots of the caller
+func (t *symbolTable) addAt(dec ast.Variable, offset int) {
+	t.table[dec.Name] = variable{Variable: dec, offset: offset}
+}
+
+func (t *symbolTable) incCounter(kind ast.VarKind) {
 	if _, ok := t.counter[kind]; ok {
 		t.counter[kind]++
 	}
 }
 
-func (t *symbolTable) count(kind vKind) (int, error) {
+func (t *symbolTable) count(kind ast.VarKind) (int, error) {
 	if c, ok := t.counter[kind]; ok {
 		return c, nil
 	}
-	return 0, fmt.Errorf("unsupported kind")
+	return 0, newDiagnostic(CodeUnsupportedKind, 0, 0, fmt.Sprintf("unsupported kind:%s", kind))
 }
 
 func (t *symbolTable) asMethod() *symbolTable {
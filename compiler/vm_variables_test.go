@@ -4,52 +4,53 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
 )
 
 func TestSymbolTable(t *testing.T) {
 	classSt := NewClassSymbolTable()
-	assert.Nil(t, classSt.add(variable{name: "x", typ: vinteger, kind: kfield}))
-	assert.Nil(t, classSt.add(variable{name: "y", typ: vstring, kind: kfield}))
-	assert.Nil(t, classSt.add(variable{name: "counter", typ: vinteger, kind: kstatic}))
-	assert.NotNil(t, classSt.add(variable{name: "counter", typ: vinteger, kind: kargument}))
+	assert.Nil(t, classSt.add(ast.Variable{Name: "x", Type: "int", Kind: ast.Field}))
+	assert.Nil(t, classSt.add(ast.Variable{Name: "y", Type: "string", Kind: ast.Field}))
+	assert.Nil(t, classSt.add(ast.Variable{Name: "counter", Type: "int", Kind: ast.Static}))
+	assert.NotNil(t, classSt.add(ast.Variable{Name: "counter", Type: "int", Kind: ast.Argument}))
 
 	v, ok := classSt.get("y")
 	assert.True(t, ok)
 	assert.Equal(t, v.offset, 1)
-	assert.Equal(t, v.kind, kfield)
+	assert.Equal(t, v.Kind, ast.Field)
 
 	v, ok = classSt.get("x")
 	assert.True(t, ok)
 	assert.Equal(t, v.offset, 0)
-	assert.Equal(t, v.kind, kfield)
-	assert.Equal(t, v.typ, vinteger)
+	assert.Equal(t, v.Kind, ast.Field)
+	assert.Equal(t, v.Type, "int")
 
 	v, ok = classSt.get("counter")
 	assert.True(t, ok)
 	assert.Equal(t, v.offset, 0)
-	assert.Equal(t, v.kind, kstatic)
+	assert.Equal(t, v.Kind, ast.Static)
 
 	subSt := NewSubroutineSymbolTable(nil).asMethod()
-	assert.Nil(t, subSt.add(variable{name: "other", typ: vpointer, kind: kargument}))
-	assert.Nil(t, subSt.add(variable{name: "dx", typ: vinteger, kind: klocal}))
-	assert.Nil(t, subSt.add(variable{name: "dy", typ: vboolean, kind: klocal}))
-	assert.NotNil(t, subSt.add(variable{name: "counter", typ: vinteger, kind: kstatic}))
+	assert.Nil(t, subSt.add(ast.Variable{Name: "other", Type: "pointer", Kind: ast.Argument}))
+	assert.Nil(t, subSt.add(ast.Variable{Name: "dx", Type: "int", Kind: ast.Local}))
+	assert.Nil(t, subSt.add(ast.Variable{Name: "dy", Type: "boolean", Kind: ast.Local}))
+	assert.NotNil(t, subSt.add(ast.Variable{Name: "counter", Type: "int", Kind: ast.Static}))
 
 	v, ok = subSt.get("this")
 	assert.True(t, ok)
 	assert.Equal(t, v.offset, 0)
-	assert.Equal(t, v.kind, kargument)
-	assert.Equal(t, v.typ, vpointer)
+	assert.Equal(t, v.Kind, ast.Argument)
+	assert.Equal(t, v.Type, "pointer")
 
 	v, ok = subSt.get("other")
 	assert.True(t, ok)
 	assert.Equal(t, v.offset, 1)
-	assert.Equal(t, v.kind, kargument)
-	assert.Equal(t, v.typ, vpointer)
+	assert.Equal(t, v.Kind, ast.Argument)
+	assert.Equal(t, v.Type, "pointer")
 
 	v, ok = subSt.get("dx")
 	assert.True(t, ok)
 	assert.Equal(t, v.offset, 0)
-	assert.Equal(t, v.kind, klocal)
+	assert.Equal(t, v.Kind, ast.Local)
 
 }
@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/zhangwuh/jack-compiler/compiler/ast"
+)
+
+//Workspace analyses the jack files of a program in memory for editor tooling, e.g. the language server.
+//A file which fails to parse keeps its last parsed class for navigation so that it keeps working while typing
+type Workspace struct {
+	opts     Options
+	contents map[string]string //content by file
+	parsed   map[string]ast.Class
+	results  map[string]DiagnosticList
+	symbols  *symbolIndex
+	dirty    bool
+}
+
+func NewWorkspace(opts Options) *Workspace {
+	return &Workspace{
+		opts:     opts,
+		contents: map[string]string{},
+		parsed:   map[string]ast.Class{},
+	}
+}
+
+//Update sets the content of a file
+func (w *Workspace) Update(file string, content string) {
+	w.contents[file] = content
+	w.dirty = true
+}
+
+func (w *Workspace) Remove(file string) {
+	delete(w.contents, file)
+	delete(w.parsed, file)
+	w.dirty = true
+}
+
+//Files returns the files of the workspace sorted
+func (w *Workspace) Files() []string {
+	var files []string
+	for file := range w.contents {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+//Content returns the content of a file
+func (w *Workspace) Content(file string) (string, bool) {
+	content, ok := w.contents[file]
+	return content, ok
+}
+
+//Diagnostics returns the problems found by the tokenizer, the parser and the semantic checks of each file,
+//files without problems have an empty list
+func (w *Workspace) Diagnostics() map[string]DiagnosticList {
+	w.analyze()
+	return w.results
+}
+
+//analyze parses and checks all the files again after a change, since a change of a class affects the files using it
+func (w *Workspace) analyze() {
+	if !w.dirty && w.results != nil {
+		return
+	}
+	var sources []*sourceFile
+	for _, file := range w.Files() {
+		src := parseContent(file, []byte(w.contents[file]))
+		if !src.diagnostics.HasErrors() && len(src.class.Name) > 0 {
+			w.parsed[file] = src.class
+		}
+		sources = append(sources, src)
+	}
+	checkSources(sources, w.opts)
+	w.results = map[string]DiagnosticList{}
+	for _, src := range sources {
+		w.results[src.file] = src.diagnostics.inFile(src.file)
+	}
+	w.symbols = newSymbolIndex(w.parsed)
+	w.dirty = false
+}
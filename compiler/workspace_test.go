@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const workspaceMain = `class Main {
+	function void main() {
+		var Point p;
+		let p = Point.new(1, 2);
+		do Output.printInt(p.getX() + Point.total());
+		return;
+	}
+}`
+
+func newTestWorkspace() *Workspace {
+	ws := NewWorkspace(Options{})
+	ws.Update("Main.jack", workspaceMain)
+	ws.Update("Point.jack", checkerPoint)
+	return ws
+}
+
+func TestWorkspace_Diagnostics(t *testing.T) {
+	ws := newTestWorkspace()
+	diagnostics := ws.Diagnostics()
+	assert.Empty(t, diagnostics["Main.jack"])
+	assert.Empty(t, diagnostics["Point.jack"])
+
+	//a change of Point affects Main
+	ws.Update("Point.jack", "class Point {\n\tfunction Point new(int ax, int ay) {\n\t\treturn null;\n\t}\n}")
+	diagnostics = ws.Diagnostics()
+	assert.Empty(t, diagnostics["Point.jack"])
+	assert.Len(t, diagnostics["Main.jack"], 2)
+	assert.Equal(t, CodeUnknownSubroutine, diagnostics["Main.jack"][0].Code)
+	assert.Equal(t, "Main.jack", diagnostics["Main.jack"][0].File)
+
+	ws.Update("Point.jack", "class Point {\n\tfield int x\n}")
+	diagnostics = ws.Diagnostics()
+	assert.Len(t, diagnostics["Point.jack"], 1)
+	assert.Equal(t, 3, diagnostics["Point.jack"][0].Line)
+	assert.Equal(t, CodeUnexpectedToken, diagnostics["Point.jack"][0].Code)
+	ws.Remove("Point.jack")
+	assert.Equal(t, []string{"Main.jack"}, ws.Files())
+}
+
+func TestWorkspace_Definition(t *testing.T) {
+	ws := newTestWorkspace()
+	cases := []struct {
+		line, column int
+		expected     Location
+	}{
+		{4, 7, Location{File: "Main.jack", Line: 3, Column: 13, EndColumn: 14}},    //p
+		{4, 12, Location{File: "Point.jack", Line: 2, Column: 7, EndColumn: 12}},   //Point
+		{4, 18, Location{File: "Point.jack", Line: 6, Column: 20, EndColumn: 23}},  //new
+		{5, 25, Location{File: "Point.jack", Line: 12, Column: 13, EndColumn: 17}}, //p.getX
+		{3, 7, Location{File: "Point.jack", Line: 2, Column: 7, EndColumn: 12}},    //var Point
+	}
+	for _, c := range cases {
+		loc, ok := ws.Definition("Main.jack", c.line, c.column)
+		assert.True(t, ok)
+		assert.Equal(t, c.expected, loc)
+	}
+	_, ok := ws.Definition("Main.jack", 5, 8) //Output is an OS class
+	assert.False(t, ok)
+	_, ok = ws.Definition("Main.jack", 1, 1) //keyword
+	assert.False(t, ok)
+
+	loc, ok := ws.Definition("Point.jack", 7, 7) //field x
+	assert.True(t, ok)
+	assert.Equal(t, Location{File: "Point.jack", Line: 3, Column: 12, EndColumn: 13}, loc)
+}
+
+func TestWorkspace_References(t *testing.T) {
+	ws := newTestWorkspace()
+	assert.Equal(t, []Location{
+		{File: "Main.jack", Line: 3, Column: 7, EndColumn: 12},
+		{File: "Main.jack", Line: 4, Column: 11, EndColumn: 16},
+		{File: "Main.jack", Line: 5, Column: 33, EndColumn: 38},
+		{File: "Point.jack", Line: 2, Column: 7, EndColumn: 12},
+		{File: "Point.jack", Line: 6, Column: 14, EndColumn: 19},
+	}, ws.References("Point.jack", 2, 8, true))
+	assert.Equal(t, []Location{
+		{File: "Point.jack", Line: 7, Column: 7, EndColumn: 8},
+		{File: "Point.jack", Line: 13, Column: 10, EndColumn: 11},
+	}, ws.References("Point.jack", 3, 12, false))
+	assert.Nil(t, ws.References("Main.jack", 1, 1, true))
+}
+
+func TestWorkspace_Hover(t *testing.T) {
+	ws := newTestWorkspace()
+	detail, loc, ok := ws.Hover("Main.jack", 5, 22)
+	assert.True(t, ok)
+	assert.Equal(t, "local Point p", detail)
+	assert.Equal(t, Location{File: "Main.jack", Line: 5, Column: 22, EndColumn: 23}, loc)
+	detail, _, _ = ws.Hover("Main.jack", 5, 13)
+	assert.Equal(t, "function void Output.printInt(int i)", detail)
+	detail, _, _ = ws.Hover("Point.jack", 6, 22)
+	assert.Equal(t, "constructor Point Point.new(int ax, int ay)", detail)
+	detail, _, _ = ws.Hover("Point.jack", 3, 12)
+	assert.Equal(t, "field int x", detail)
+}
+
+func TestWorkspace_Completions(t *testing.T) {
+	ws := newTestWorkspace()
+	ws.Diagnostics()
+	//the last parsed class is used while the file doesn't parse
+	ws.Update("Main.jack", `class Main {
+	function void main() {
+		var Point p;
+		let p = Point.
+		do p.
+		do Math.m
+	}
+}`)
+	assert.Equal(t, []Completion{
+		{Label: "new", Kind: "constructor", Detail: "constructor Point Point.new(int ax, int ay)"},
+		{Label: "total", Kind: "function", Detail: "function int Point.total()"},
+	}, ws.Completions("Main.jack", 4, 17))
+	assert.Equal(t, []Completion{
+		{Label: "getX", Kind: "method", Detail: "method int Point.getX()"},
+	}, ws.Completions("Main.jack", 5, 8))
+	assert.Equal(t, []Completion{
+		{Label: "max", Kind: "function", Detail: "function int Math.max(int x, int y)"},
+		{Label: "min", Kind: "function", Detail: "function int Math.min(int x, int y)"},
+		{Label: "multiply", Kind: "function", Detail: "function int Math.multiply(int x, int y)"},
+	}, ws.Completions("Main.jack", 6, 12))
+	assert.Nil(t, ws.Completions("Main.jack", 2, 5))
+	assert.Nil(t, ws.Completions("Main.jack", 6, 5))
+}
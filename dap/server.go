@@ -0,0 +1,466 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/zhangwuh/jack-compiler/debugger"
+	"github.com/zhangwuh/jack-compiler/internal/rpc"
+	"github.com/zhangwuh/jack-compiler/vmemulator"
+)
+
+//the program runs in a single thread
+const threadID = 1
+
+//scopes of a stack frame, the variables reference of a scope is (frame id)*len(scopes) + index of the scope
+var scopes = []struct{ name, kind string }{
+	{"Arguments", "argument"},
+	{"Locals", "local"},
+	{"Fields", "field"},
+	{"Statics", "static"},
+}
+
+var (
+	errNotLaunched = errors.New("the program is not launched")
+	errExecuting   = errors.New("the program is running, pause it first")
+)
+
+//Server is a debug adapter serving one debug session over a stream, e.g. stdio.
+//Requests are handled one by one, the program runs in a goroutine while the requests resuming it are served
+//so that it can be paused, the requests reading the machine fail until it stops
+type Server struct {
+	r           *bufio.Reader
+	w           *rpc.Writer
+	seq         int
+	d           *debugger.Debugger
+	os          *vmemulator.OS
+	printed     int //runes of the output sent
+	launch      launchArguments
+	breakpoints map[string][]string //jack file -> specs of the breakpoints
+	running     bool
+	executing   bool          //the program runs in the goroutine of resume
+	pause       chan struct{} //closed to interrupt the execution, nil once closed
+	stops       chan execution
+}
+
+//execution is where a run of the program stopped
+type execution struct {
+	reason string
+	stop   debugger.Stop
+	err    error
+}
+
+//input is a message read from the input, or the error reading it
+type input struct {
+	body []byte
+	err  error
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{r: bufio.NewReader(in), w: rpc.NewWriter(out), breakpoints: map[string][]string{}, stops: make(chan execution, 1)}
+}
+
+//Serve handles the requests until disconnect or the end of the input, and sends the events of the program
+//when it stops
+func (s *Server) Serve() error {
+	messages := make(chan input)
+	done := make(chan struct{})
+	defer close(done)
+	go s.read(messages, done)
+	defer s.halt()
+	for {
+		var msg input
+		select {
+		case e := <-s.stops:
+			s.executing = false
+			if err := s.stopped(e.reason, e.stop, e.err); err != nil {
+				return err
+			}
+			continue
+		case msg = <-messages:
+		}
+		if msg.err == io.EOF {
+			return nil
+		}
+		if msg.err != nil {
+			return msg.err
+		}
+		var req request
+		if err := json.Unmarshal(msg.body, &req); err != nil {
+			return fmt.Errorf("invalid message: %s", err.Error())
+		}
+		if req.Type != "request" {
+			continue
+		}
+		result, err := s.handle(req)
+		if err := s.respond(req, result, err); err != nil {
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		if err := s.after(req); err != nil {
+			return err
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+//read reads the messages until an error, e.g. the end of the input, or the server is done
+func (s *Server) read(messages chan<- input, done <-chan struct{}) {
+	for {
+		body, err := rpc.ReadMessage(s.r)
+		select {
+		case messages <- input{body, err}:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) send(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.w.WriteMessage(body)
+}
+
+func (s *Server) nextSeq() int {
+	s.seq++
+	return s.seq
+}
+
+func (s *Server) respond(req request, body interface{}, err error) error {
+	resp := response{Seq: s.nextSeq(), Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	return s.send(resp)
+}
+
+func (s *Server) sendEvent(name string, body interface{}) error {
+	return s.send(event{Seq: s.nextSeq(), Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) handle(req request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return capabilities{SupportsConfigurationDoneRequest: true, SupportsEvaluateForHovers: true}, nil
+	case "launch":
+		return nil, s.handleLaunch(req.Arguments)
+	case "setBreakpoints":
+		return s.handleSetBreakpoints(req.Arguments)
+	case "configurationDone", "disconnect", "terminate":
+		return nil, nil
+	case "threads":
+		return map[string][]thread{"threads": {{ID: threadID, Name: "main"}}}, nil
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.checkStopped()
+	case "next", "stepIn", "stepOut":
+		return nil, s.checkStopped()
+	case "pause":
+		return nil, s.handlePause()
+	case "stackTrace":
+		return s.handleStackTrace()
+	case "scopes":
+		return s.handleScopes(req.Arguments)
+	case "variables":
+		return s.handleVariables(req.Arguments)
+	case "evaluate":
+		return s.handleEvaluate(req.Arguments)
+	}
+	return nil, fmt.Errorf("unsupported request %s", req.Command)
+}
+
+//after resumes the program when a request resumes it, the response is sent before the events of the program
+func (s *Server) after(req request) error {
+	if s.d == nil {
+		return nil
+	}
+	switch req.Command {
+	case "launch":
+		return s.sendEvent("initialized", nil)
+	case "configurationDone":
+		s.running = true
+		if err := s.d.Machine().Boot(); err != nil {
+			return s.terminate(err)
+		}
+		if s.launch.StopOnEntry {
+			s.resume("entry", s.d.Start)
+		} else {
+			s.resume("", s.d.Continue)
+		}
+	case "continue":
+		s.resume("", s.d.Continue)
+	case "next":
+		s.resume("", s.d.StepOver)
+	case "stepIn":
+		s.resume("", s.d.StepInto)
+	case "stepOut":
+		s.resume("", s.d.StepOut)
+	case "disconnect":
+		s.halt()
+	case "terminate":
+		s.halt()
+		if s.running {
+			return s.terminate(nil)
+		}
+	}
+	return nil
+}
+
+//resume runs the program in a goroutine until it stops, the stop is handled by Serve
+func (s *Server) resume(reason string, run func() (debugger.Stop, error)) {
+	s.pause = make(chan struct{})
+	s.d.Interrupt(s.pause)
+	s.executing = true
+	go func() {
+		stop, err := run()
+		s.stops <- execution{reason, stop, err}
+	}()
+}
+
+//interrupt stops the execution at the next command
+func (s *Server) interrupt() {
+	if s.pause != nil {
+		close(s.pause)
+		s.pause = nil
+	}
+}
+
+//halt waits for the execution interrupted, its stop isn't reported
+func (s *Server) halt() {
+	if s.executing {
+		s.interrupt()
+		<-s.stops
+		s.executing = false
+	}
+}
+
+//handlePause interrupts the execution, the stopped event is sent when it stops. A program already stopped stays stopped
+func (s *Server) handlePause() error {
+	if !s.running {
+		return errNotLaunched
+	}
+	if s.executing {
+		s.interrupt()
+	}
+	return nil
+}
+
+func (s *Server) checkRunning() error {
+	if !s.running {
+		return errNotLaunched
+	}
+	return nil
+}
+
+//checkStopped checks that the program is launched and not executing, e.g. for reading the machine
+func (s *Server) checkStopped() error {
+	if err := s.checkRunning(); err != nil {
+		return err
+	}
+	if s.executing {
+		return errExecuting
+	}
+	return nil
+}
+
+func (s *Server) handleLaunch(arguments json.RawMessage) error {
+	if err := json.Unmarshal(arguments, &s.launch); err != nil {
+		return err
+	}
+	if s.launch.Program == "" {
+		return errors.New("program is required")
+	}
+	d, err := debugger.Load(s.launch.Program)
+	if err != nil {
+		return err
+	}
+	if s.launch.SourceDir == "" {
+		s.launch.SourceDir = s.launch.Program
+	} else {
+		d.LoadSources(s.launch.SourceDir)
+	}
+	if s.launch.NativeOS {
+		s.os = vmemulator.BindOS(d.Machine())
+	}
+	d.Machine().SetMaxSteps(s.launch.MaxSteps)
+	s.d = d
+	return nil
+}
+
+//handleSetBreakpoints replaces the breakpoints of a jack file
+func (s *Server) handleSetBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+	if s.executing {
+		return nil, errExecuting
+	}
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	file := args.Source.Name
+	if args.Source.Path != "" {
+		file = filepath.Base(args.Source.Path)
+	}
+	for _, spec := range s.breakpoints[file] {
+		s.d.Clear(spec)
+	}
+	s.breakpoints[file] = nil
+	bps := []breakpoint{}
+	for _, sbp := range args.Breakpoints {
+		spec := fmt.Sprintf("%s:%d", file, sbp.Line)
+		pos, err := s.d.Break(spec)
+		if err != nil {
+			bps = append(bps, breakpoint{Verified: false, Message: err.Error(), Line: sbp.Line})
+			continue
+		}
+		s.breakpoints[file] = append(s.breakpoints[file], spec)
+		bps = append(bps, breakpoint{Verified: true, Source: s.source(pos.File), Line: pos.Line})
+	}
+	return map[string][]breakpoint{"breakpoints": bps}, nil
+}
+
+func (s *Server) source(file string) *source {
+	return &source{Name: file, Path: filepath.Join(s.launch.SourceDir, file)}
+}
+
+func (s *Server) handleStackTrace() (interface{}, error) {
+	if err := s.checkStopped(); err != nil {
+		return nil, err
+	}
+	frames := []stackFrame{}
+	for i, frame := range s.d.Backtrace() {
+		sf := stackFrame{ID: i + 1, Name: frame.Function}
+		if frame.Position.Line > 0 {
+			sf.Source = s.source(frame.Position.File)
+			sf.Line, sf.Column = frame.Position.Line, frame.Position.Column
+		} else {
+			sf.Source = &source{Name: frame.Location.File + ".vm"}
+			sf.Line = frame.Location.Line
+		}
+		frames = append(frames, sf)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) handleScopes(arguments json.RawMessage) (interface{}, error) {
+	var args frameArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	var result []scope
+	for i, sc := range scopes {
+		result = append(result, scope{Name: sc.name, VariablesReference: args.FrameID*len(scopes) + i})
+	}
+	return map[string][]scope{"scopes": result}, nil
+}
+
+func (s *Server) frameVariables(frameID int) ([]debugger.Variable, error) {
+	if err := s.checkStopped(); err != nil {
+		return nil, err
+	}
+	return s.d.Variables(frameID - 1)
+}
+
+func (s *Server) handleVariables(arguments json.RawMessage) (interface{}, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	vars, err := s.frameVariables(args.VariablesReference / len(scopes))
+	if err != nil {
+		return nil, err
+	}
+	kind := scopes[args.VariablesReference%len(scopes)].kind
+	result := []variable{}
+	for _, v := range vars {
+		if v.Kind == kind {
+			result = append(result, variable{Name: v.Name, Value: v.FormatValue(), Type: v.Type})
+		}
+	}
+	return map[string][]variable{"variables": result}, nil
+}
+
+//handleEvaluate evaluates the name of a variable in a frame
+func (s *Server) handleEvaluate(arguments json.RawMessage) (interface{}, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if args.FrameID == 0 {
+		args.FrameID = 1
+	}
+	vars, err := s.frameVariables(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		if v.Name == args.Expression {
+			return map[string]interface{}{"result": v.FormatValue(), "type": v.Type, "variablesReference": 0}, nil
+		}
+	}
+	return nil, fmt.Errorf("undefined var %s", args.Expression)
+}
+
+//stopped sends the events of where the program stopped, reason overrides the reason of the stop
+func (s *Server) stopped(reason string, stop debugger.Stop, err error) error {
+	if err := s.flushOutput(); err != nil {
+		return err
+	}
+	if err != nil {
+		return s.terminate(err)
+	}
+	switch stop.Reason {
+	case debugger.StopExited, debugger.StopHalted:
+		return s.terminate(nil)
+	}
+	if reason == "" {
+		reason = string(stop.Reason)
+	}
+	return s.sendEvent("stopped", stoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+}
+
+//terminate ends the session, a runtime error is reported as output to the console
+func (s *Server) terminate(err error) error {
+	s.running = false
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		if e := s.sendEvent("output", outputEvent{Category: "stderr", Output: err.Error() + "\n"}); e != nil {
+			return e
+		}
+	}
+	if err := s.sendEvent("exited", map[string]int{"exitCode": exitCode}); err != nil {
+		return err
+	}
+	return s.sendEvent("terminated", nil)
+}
+
+//flushOutput sends the text printed by the native OS since the last stop
+func (s *Server) flushOutput() error {
+	if s.os == nil {
+		return nil
+	}
+	output := []rune(s.os.Output()) //the characters of the hack platform over 127 aren't ascii
+	if len(output) <= s.printed {
+		s.printed = len(output) //erased by backspaces
+		return nil
+	}
+	text := string(output[s.printed:])
+	s.printed = len(output)
+	return s.sendEvent("output", outputEvent{Category: "stdout", Output: text})
+}
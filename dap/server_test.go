@@ -0,0 +1,280 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/internal/rpc"
+	"github.com/zhangwuh/jack-compiler/vmemulator"
+)
+
+const mainJack = `class Main {
+	function void main() {
+		var int r;
+		let r = Main.twice(21);
+		do Output.printInt(r);
+		return;
+	}
+
+	function int twice(int n) {
+		var int m;
+		let m = n + n;
+		return m;
+	}
+}`
+
+//message is a response or an event received by the client
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+//client is a stub of the editor talking to the server through pipes
+type client struct {
+	t        *testing.T
+	w        *rpc.Writer
+	messages chan message
+	seq      int
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, w: rpc.NewWriter(clientOut), messages: make(chan message, 100)}
+	go func() {
+		assert.Nil(t, NewServer(serverIn, serverOut).Serve())
+		serverOut.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := rpc.ReadMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg message
+			assert.Nil(t, json.Unmarshal(body, &msg))
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) next() message {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout")
+	}
+	return message{}
+}
+
+//request sends a request and returns its response, body is decoded into result if it's not nil
+func (c *client) request(command string, args interface{}, result interface{}) message {
+	c.seq++
+	body, err := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	assert.Nil(c.t, err)
+	assert.Nil(c.t, c.w.WriteMessage(body))
+	msg := c.next()
+	assert.Equal(c.t, "response", msg.Type)
+	assert.Equal(c.t, c.seq, msg.RequestSeq)
+	assert.Equal(c.t, command, msg.Command)
+	if result != nil && msg.Success {
+		assert.Nil(c.t, json.Unmarshal(msg.Body, result))
+	}
+	return msg
+}
+
+func (c *client) event(name string, result interface{}) {
+	msg := c.next()
+	assert.Equal(c.t, "event", msg.Type)
+	assert.Equal(c.t, name, msg.Event)
+	if result != nil {
+		assert.Nil(c.t, json.Unmarshal(msg.Body, result))
+	}
+}
+
+//loopJack polls the keyboard forever as the games do
+const loopJack = `class Main {
+	function void main() {
+		var int key;
+		while (true) {
+			let key = Keyboard.keyPressed();
+		}
+		return;
+	}
+}`
+
+func compileProgram(t *testing.T, src string) string {
+	dir, err := ioutil.TempDir("", "dap")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Main.jack"), []byte(src), 0644))
+	assert.Nil(t, compiler.CompileDirWithOptions(dir, dir, compiler.Options{SourceMap: true}))
+	return dir
+}
+
+func TestServer_Session(t *testing.T) {
+	dir := compileProgram(t, mainJack)
+	c := newClient(t)
+	var caps capabilities
+	assert.True(t, c.request("initialize", map[string]string{"adapterID": "jack"}, &caps).Success)
+	assert.True(t, caps.SupportsConfigurationDoneRequest)
+
+	assert.True(t, c.request("launch", launchArguments{Program: dir, NativeOS: true}, nil).Success)
+	c.event("initialized", nil)
+
+	var bps struct{ Breakpoints []breakpoint }
+	c.request("setBreakpoints", setBreakpointsArguments{
+		Source:      source{Path: filepath.Join(dir, "Main.jack")},
+		Breakpoints: []sourceBreakpoint{{Line: 10}, {Line: 40}},
+	}, &bps)
+	assert.Equal(t, []breakpoint{
+		{Verified: true, Source: &source{Name: "Main.jack", Path: filepath.Join(dir, "Main.jack")}, Line: 11},
+		{Verified: false, Message: "no code at Main.jack:40", Line: 40},
+	}, bps.Breakpoints)
+
+	assert.True(t, c.request("configurationDone", nil, nil).Success)
+	var stopped stoppedEvent
+	c.event("stopped", &stopped)
+	assert.Equal(t, stoppedEvent{Reason: "breakpoint", ThreadID: threadID, AllThreadsStopped: true}, stopped)
+
+	var threads struct{ Threads []thread }
+	c.request("threads", nil, &threads)
+	assert.Equal(t, []thread{{ID: threadID, Name: "main"}}, threads.Threads)
+
+	var trace struct{ StackFrames []stackFrame }
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	assert.Equal(t, 2, len(trace.StackFrames))
+	assert.Equal(t, stackFrame{ID: 1, Name: "Main.twice", Source: &source{Name: "Main.jack", Path: filepath.Join(dir, "Main.jack")}, Line: 11, Column: 3}, trace.StackFrames[0])
+	assert.Equal(t, "Main.main", trace.StackFrames[1].Name)
+	assert.Equal(t, 4, trace.StackFrames[1].Line)
+
+	var scs struct{ Scopes []scope }
+	c.request("scopes", frameArguments{FrameID: 1}, &scs)
+	assert.Equal(t, []string{"Arguments", "Locals", "Fields", "Statics"}, []string{scs.Scopes[0].Name, scs.Scopes[1].Name, scs.Scopes[2].Name, scs.Scopes[3].Name})
+	var vars struct{ Variables []variable }
+	c.request("variables", variablesArguments{VariablesReference: scs.Scopes[0].VariablesReference}, &vars)
+	assert.Equal(t, []variable{{Name: "n", Value: "21", Type: "int"}}, vars.Variables)
+
+	assert.True(t, c.request("next", map[string]int{"threadId": threadID}, nil).Success)
+	c.event("stopped", &stopped)
+	assert.Equal(t, "step", stopped.Reason)
+	var result struct{ Result string }
+	c.request("evaluate", evaluateArguments{Expression: "m", FrameID: 1}, &result)
+	assert.Equal(t, "42", result.Result)
+	assert.Equal(t, "undefined var x", c.request("evaluate", evaluateArguments{Expression: "x"}, nil).Message)
+
+	assert.True(t, c.request("stepOut", map[string]int{"threadId": threadID}, nil).Success)
+	c.event("stopped", &stopped)
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	assert.Equal(t, "Main.main", trace.StackFrames[0].Name)
+
+	assert.True(t, c.request("continue", map[string]int{"threadId": threadID}, nil).Success)
+	var output outputEvent
+	c.event("output", &output)
+	assert.Equal(t, outputEvent{Category: "stdout", Output: "42"}, output)
+	c.event("exited", nil)
+	c.event("terminated", nil)
+
+	assert.Equal(t, "the program is not launched", c.request("next", nil, nil).Message)
+	assert.True(t, c.request("disconnect", nil, nil).Success)
+}
+
+func TestServer_Errors(t *testing.T) {
+	c := newClient(t)
+	assert.Equal(t, "program is required", c.request("launch", map[string]string{}, nil).Message)
+	assert.Equal(t, "the program is not launched", c.request("setBreakpoints", setBreakpointsArguments{}, nil).Message)
+	assert.Equal(t, "unsupported request foo", c.request("foo", nil, nil).Message)
+
+	dir := compileProgram(t, mainJack)
+	assert.True(t, c.request("launch", launchArguments{Program: dir, StopOnEntry: true}, nil).Success)
+	c.event("initialized", nil)
+	c.request("configurationDone", nil, nil)
+	var stopped stoppedEvent
+	c.event("stopped", &stopped)
+	assert.Equal(t, "entry", stopped.Reason)
+	//Output.printInt is undefined without the OS
+	c.request("continue", nil, nil)
+	var output outputEvent
+	c.event("output", &output)
+	assert.Equal(t, "Main.vm:6 call Output.printInt 1: undefined function Output.printInt\n", output.Output)
+	c.event("exited", nil)
+	c.event("terminated", nil)
+}
+
+//the requests are served while the program runs, it stops on pause
+func TestServer_Pause(t *testing.T) {
+	dir := compileProgram(t, loopJack)
+	c := newClient(t)
+	assert.True(t, c.request("launch", launchArguments{Program: dir, NativeOS: true}, nil).Success)
+	c.event("initialized", nil)
+	assert.True(t, c.request("configurationDone", nil, nil).Success)
+
+	var threads struct{ Threads []thread }
+	c.request("threads", nil, &threads)
+	assert.Equal(t, []thread{{ID: threadID, Name: "main"}}, threads.Threads)
+	assert.Equal(t, "the program is running, pause it first", c.request("stackTrace", nil, nil).Message)
+
+	assert.True(t, c.request("pause", map[string]int{"threadId": threadID}, nil).Success)
+	var stopped stoppedEvent
+	c.event("stopped", &stopped)
+	assert.Equal(t, stoppedEvent{Reason: "pause", ThreadID: threadID, AllThreadsStopped: true}, stopped)
+	var trace struct{ StackFrames []stackFrame }
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	assert.Equal(t, "Main.main", trace.StackFrames[0].Name)
+	//paused again without running
+	assert.True(t, c.request("pause", nil, nil).Success)
+
+	assert.True(t, c.request("continue", map[string]int{"threadId": threadID}, nil).Success)
+	assert.True(t, c.request("disconnect", nil, nil).Success)
+	_, ok := <-c.messages
+	assert.False(t, ok)
+}
+
+//the output is sent by characters, a character over 127 is more than a byte in utf-8
+func TestServer_FlushOutput(t *testing.T) {
+	m, err := vmemulator.Load(nil)
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	s := &Server{w: rpc.NewWriter(&out), os: vmemulator.BindOS(m)}
+	var outputs []string
+	flush := func(chars ...int16) {
+		for _, c := range chars {
+			_, err := m.Call("Output.printChar", c)
+			assert.Nil(t, err)
+		}
+		out.Reset()
+		assert.Nil(t, s.flushOutput())
+		if out.Len() > 0 {
+			body, err := rpc.ReadMessage(bufio.NewReader(&out))
+			assert.Nil(t, err)
+			var msg struct{ Body outputEvent }
+			assert.Nil(t, json.Unmarshal(body, &msg))
+			outputs = append(outputs, msg.Body.Output)
+		}
+	}
+	flush(233)
+	flush(129, 'x', 233) //backspace
+	assert.Equal(t, []string{"\u00e9", "\u00e9"}, outputs)
+}
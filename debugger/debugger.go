@@ -0,0 +1,396 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/vmemulator"
+)
+
+const sourceMapExt = ".vm.map"
+
+//Position is a position in a jack file
+type Position struct {
+	File   string //jack file name, e.g. Main.jack
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+//StopReason tells why the program stopped
+type StopReason string
+
+const (
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopExited     StopReason = "exited" //returned from the outermost function
+	StopHalted     StopReason = "halted" //Sys.halt is called
+	StopPaused     StopReason = "pause"  //interrupted, see Interrupt
+)
+
+//Stop is where the program stopped
+type Stop struct {
+	Reason   StopReason
+	Function string
+	Position Position //zero if the program is not running or the code is not mapped to jack
+}
+
+//StackFrame is a frame of the jack call stack, the innermost first
+type StackFrame struct {
+	Function string
+	Position Position
+	Location vmemulator.Location //vm location for the code without source map, e.g. the OS
+}
+
+//Variable is the value of a jack variable
+type Variable struct {
+	Name  string
+	Type  string
+	Kind  string //argument, local, field or static
+	Value int16
+}
+
+//FormatValue formats the value by the jack type
+func (v Variable) FormatValue() string {
+	switch v.Type {
+	case "boolean":
+		return strconv.FormatBool(v.Value != 0)
+	case "char":
+		if v.Value >= 32 && v.Value < 127 {
+			return strconv.Quote(string(rune(v.Value)))
+		}
+	}
+	return strconv.Itoa(int(v.Value))
+}
+
+func (v Variable) String() string {
+	return fmt.Sprintf("%s %s %s = %s", v.Kind, v.Type, v.Name, v.FormatValue())
+}
+
+//Debugger runs the compiled vm code and maps it back to the jack source with the source maps written by the compiler
+type Debugger struct {
+	m           *vmemulator.Machine
+	maps        map[string]*compiler.SourceMap //source maps by vm file name
+	sources     map[string][]string            //jack lines by jack file name
+	positions   map[int]Position               //pc -> jack position of the mapped commands
+	starts      map[int]bool                   //pcs where the code of jack statements starts
+	functions   map[string]compiler.SubroutineSymbols
+	breakpoints map[int]string //pc -> breakpoint
+	interrupt   <-chan struct{}
+}
+
+//Load loads the vm files and the source maps of a directory compiled with source maps,
+//the jack files are read from the same directory if they exist
+func Load(dir string) (*Debugger, error) {
+	m, err := vmemulator.LoadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+sourceMapExt))
+	if err != nil {
+		return nil, err
+	}
+	maps := map[string]*compiler.SourceMap{}
+	for _, file := range files {
+		sm, err := compiler.ReadSourceMap(file)
+		if err != nil {
+			return nil, err
+		}
+		maps[strings.TrimSuffix(filepath.Base(file), sourceMapExt)] = sm
+	}
+	d := New(m, maps)
+	d.LoadSources(dir)
+	return d, nil
+}
+
+//New creates a debugger of a loaded machine with the source maps of the vm files
+func New(m *vmemulator.Machine, maps map[string]*compiler.SourceMap) *Debugger {
+	d := &Debugger{
+		m:           m,
+		maps:        maps,
+		sources:     map[string][]string{},
+		positions:   map[int]Position{},
+		starts:      map[int]bool{},
+		functions:   map[string]compiler.SubroutineSymbols{},
+		breakpoints: map[int]string{},
+	}
+	lines := map[string]map[int]compiler.Mapping{}
+	for file, sm := range maps {
+		lines[file] = map[int]compiler.Mapping{}
+		for _, mapping := range sm.Mappings {
+			lines[file][mapping.VMLine] = mapping
+		}
+		for _, sub := range sm.Subroutines {
+			d.functions[sub.Name] = sub
+		}
+	}
+	seen := map[string]bool{} //functions and the positions in functions
+	for pc := 0; pc < m.ProgramSize(); pc++ {
+		loc, _ := m.Location(pc)
+		mapping, ok := lines[loc.File][loc.Line]
+		if !ok || mapping.Line == 0 {
+			continue
+		}
+		pos := Position{File: maps[loc.File].Source, Line: mapping.Line, Column: mapping.Column}
+		d.positions[pc] = pos
+		key := fmt.Sprintf("%s %d:%d", loc.Function, pos.Line, pos.Column)
+		//the first position of a function is the declaration rather than a statement
+		if !seen[key] && seen[loc.Function] {
+			d.starts[pc] = true
+		}
+		seen[key] = true
+		seen[loc.Function] = true
+	}
+	return d
+}
+
+//LoadSources reads the jack files of the source maps from dir for listing the code
+func (d *Debugger) LoadSources(dir string) {
+	for _, sm := range d.maps {
+		if content, err := ioutil.ReadFile(filepath.Join(dir, sm.Source)); err == nil {
+			d.sources[sm.Source] = strings.Split(string(content), "\n")
+		}
+	}
+}
+
+func (d *Debugger) Machine() *vmemulator.Machine {
+	return d.m
+}
+
+//SourceLine returns the jack code of a line, empty if the source is unknown
+func (d *Debugger) SourceLine(pos Position) string {
+	lines := d.sources[pos.File]
+	if pos.Line <= 0 || pos.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[pos.Line-1])
+}
+
+//Break sets a breakpoint by `File.jack:line` or `Class.subroutine`,
+//a line without code breaks at the next statement of the file. It returns where the breakpoint is
+func (d *Debugger) Break(spec string) (Position, error) {
+	pc, err := d.resolve(spec)
+	if err != nil {
+		return Position{}, err
+	}
+	d.breakpoints[pc] = spec
+	return d.positions[pc], nil
+}
+
+//Clear removes a breakpoint
+func (d *Debugger) Clear(spec string) error {
+	for pc, bp := range d.breakpoints {
+		if bp == spec {
+			delete(d.breakpoints, pc)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %s", spec)
+}
+
+func (d *Debugger) resolve(spec string) (int, error) {
+	if i := strings.LastIndex(spec, ":"); i > 0 {
+		file := spec[:i]
+		line, err := strconv.Atoi(spec[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid line of breakpoint:%s", spec)
+		}
+		found := -1
+		for pc := range d.starts {
+			pos := d.positions[pc]
+			if pos.File != file || pos.Line < line {
+				continue
+			}
+			if found < 0 || pos.Line < d.positions[found].Line || pos.Line == d.positions[found].Line && pc < found {
+				found = pc
+			}
+		}
+		if found < 0 {
+			return 0, fmt.Errorf("no code at %s", spec)
+		}
+		return found, nil
+	}
+	start, ok := d.m.FunctionPC(spec)
+	if !ok {
+		return 0, fmt.Errorf("undefined subroutine %s", spec)
+	}
+	//break at the first statement rather than the function declaration
+	for pc := start + 1; pc < d.m.ProgramSize(); pc++ {
+		if loc, _ := d.m.Location(pc); loc.Function != spec {
+			break
+		}
+		if d.starts[pc] {
+			return pc, nil
+		}
+	}
+	return start, nil
+}
+
+//Breakpoints returns the breakpoints sorted
+func (d *Debugger) Breakpoints() []string {
+	var bps []string
+	for _, bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Strings(bps)
+	return bps
+}
+
+//Start boots the program and stops at the first jack statement
+func (d *Debugger) Start() (Stop, error) {
+	if err := d.m.Boot(); err != nil {
+		return Stop{}, err
+	}
+	if d.starts[d.m.PC()] {
+		return d.stop(StopStep), nil
+	}
+	return d.StepInto()
+}
+
+//Continue runs until a breakpoint or the end of the program
+func (d *Debugger) Continue() (Stop, error) {
+	return d.run(func(pc, depth int) bool { return false })
+}
+
+//StepInto runs until the next jack statement, including the statements of the subroutines called
+func (d *Debugger) StepInto() (Stop, error) {
+	return d.run(func(pc, depth int) bool { return d.starts[pc] })
+}
+
+//StepOver runs until the next jack statement of the current subroutine or its callers
+func (d *Debugger) StepOver() (Stop, error) {
+	start := d.m.Depth()
+	return d.run(func(pc, depth int) bool { return depth <= start && d.starts[pc] })
+}
+
+//StepOut runs until the current subroutine returns
+func (d *Debugger) StepOut() (Stop, error) {
+	start := d.m.Depth()
+	return d.run(func(pc, depth int) bool { return depth < start })
+}
+
+//Interrupt stops the runs at the next command once done is closed, e.g. by another goroutine serving a pause request.
+//It must be set before the run starts, the runs of a closed done stop after one command
+func (d *Debugger) Interrupt(done <-chan struct{}) {
+	d.interrupt = done
+}
+
+//run executes at least one command, and stops when until is true, at a breakpoint, the end of the program or an interrupt
+func (d *Debugger) run(until func(pc, depth int) bool) (Stop, error) {
+	for {
+		if d.m.Halted() {
+			return Stop{Reason: StopHalted}, nil
+		}
+		if d.m.Done() {
+			return Stop{Reason: StopExited}, nil
+		}
+		if err := d.m.Step(); err != nil {
+			return d.stop(StopStep), err
+		}
+		if d.m.Done() {
+			continue
+		}
+		pc := d.m.PC()
+		if _, ok := d.breakpoints[pc]; ok {
+			return d.stop(StopBreakpoint), nil
+		}
+		if until(pc, d.m.Depth()) {
+			return d.stop(StopStep), nil
+		}
+		select {
+		case <-d.interrupt:
+			return d.stop(StopPaused), nil
+		default:
+		}
+	}
+}
+
+func (d *Debugger) stop(reason StopReason) Stop {
+	loc, _ := d.m.Location(d.m.PC())
+	return Stop{Reason: reason, Function: loc.Function, Position: d.positions[d.m.PC()]}
+}
+
+//Position returns the jack position of the next command to execute
+func (d *Debugger) Position() Position {
+	return d.positions[d.m.PC()]
+}
+
+//Backtrace returns the jack call stack, the innermost frame first
+func (d *Debugger) Backtrace() []StackFrame {
+	calls := d.m.CallStack()
+	var frames []StackFrame
+	for i := len(calls) - 1; i >= 0; i-- {
+		loc, _ := d.m.Location(calls[i].PC)
+		frames = append(frames, StackFrame{Function: calls[i].Function, Position: d.positions[calls[i].PC], Location: loc})
+	}
+	return frames
+}
+
+//Variables returns the arguments, locals, fields and statics visible in a frame of the backtrace,
+//fields are only visible in methods and constructors
+func (d *Debugger) Variables(frame int) ([]Variable, error) {
+	calls := d.m.CallStack()
+	if len(calls) == 0 {
+		return nil, errors.New("the program is not running")
+	}
+	if frame < 0 || frame >= len(calls) {
+		return nil, fmt.Errorf("invalid frame:%d", frame)
+	}
+	call := calls[len(calls)-1-frame]
+	sub, ok := d.functions[call.Function]
+	if !ok {
+		return nil, fmt.Errorf("no symbols of %s", call.Function)
+	}
+	loc, _ := d.m.Location(call.PC)
+	var vars []Variable
+	for _, sym := range sub.Variables {
+		base := call.LCL
+		if sym.Segment == "argument" {
+			base = call.ARG
+		}
+		vars = append(vars, Variable{Name: sym.Name, Type: sym.Type, Kind: sym.Kind, Value: d.peek(base + sym.Index)})
+	}
+	for _, sym := range d.maps[loc.File].Variables {
+		var value int16
+		if sym.Kind == "field" {
+			if sub.Category == "function" || call.THIS == 0 {
+				continue
+			}
+			value = d.peek(call.THIS + sym.Index)
+		} else if address, ok := d.m.StaticAddress(loc.File, sym.Index); ok {
+			value = d.peek(address)
+		}
+		vars = append(vars, Variable{Name: sym.Name, Type: sym.Type, Kind: sym.Kind, Value: value})
+	}
+	return vars, nil
+}
+
+func (d *Debugger) peek(address int) int16 {
+	if address < 0 || address >= vmemulator.RAMSize {
+		return 0
+	}
+	return d.m.RAM[address]
+}
+
+//Lookup finds a variable visible in the innermost frame by its jack name
+func (d *Debugger) Lookup(name string) (Variable, error) {
+	vars, err := d.Variables(0)
+	if err != nil {
+		return Variable{}, err
+	}
+	for _, v := range vars {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return Variable{}, fmt.Errorf("undefined var %s", name)
+}
@@ -0,0 +1,186 @@
+package debugger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/vmemulator"
+)
+
+var program = map[string]string{
+	"Main.jack": `class Main {
+	function void main() {
+		var int r;
+		var Point p;
+		let p = Point.new(3, 4);
+		let r = Main.fact(4);
+		let r = r + p.sum();
+		do Output.printInt(r);
+		return;
+	}
+
+	function int fact(int n) {
+		if (n < 2) {
+			return 1;
+		}
+		return n * Main.fact(n - 1);
+	}
+}`,
+	"Point.jack": `class Point {
+	field int x, y;
+	static int count;
+
+	constructor Point new(int ax, int ay) {
+		let x = ax;
+		let y = ay;
+		let count = count + 1;
+		return this;
+	}
+
+	method int sum() {
+		return x + y;
+	}
+}`,
+}
+
+//loadProgram compiles the program with source maps and runs it with the native OS
+func loadProgram(t *testing.T) (*Debugger, *vmemulator.OS) {
+	dir, err := ioutil.TempDir("", "debugger")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, src := range program {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644))
+	}
+	assert.Nil(t, compiler.CompileDirWithOptions(dir, dir, compiler.Options{SourceMap: true}))
+	d, err := Load(dir)
+	assert.Nil(t, err)
+	return d, vmemulator.BindOS(d.Machine())
+}
+
+func TestDebugger_Script(t *testing.T) {
+	d, os := loadProgram(t)
+	var out strings.Builder
+	assert.Nil(t, d.RunScript(strings.NewReader(`
+break Main.fact
+break Point.jack:13
+run
+print n
+c
+print n
+bt
+clear Main.fact
+finish
+finish
+next
+print r
+c
+vars
+next
+print r
+print x
+c
+`), &out))
+	assert.Equal(t, `breakpoint Main.fact at Main.jack:13
+breakpoint Point.jack:13 at Point.jack:13
+breakpoint: Main.fact at Main.jack:13  if (n < 2) {
+argument int n = 4
+breakpoint: Main.fact at Main.jack:13  if (n < 2) {
+argument int n = 3
+#0 Main.fact at Main.jack:13
+#1 Main.fact at Main.jack:16
+#2 Main.main at Main.jack:6
+step: Main.fact at Main.jack:16  return n * Main.fact(n - 1);
+step: Main.main at Main.jack:6  let r = Main.fact(4);
+step: Main.main at Main.jack:7  let r = r + p.sum();
+local int r = 24
+breakpoint: Point.sum at Point.jack:13  return x + y;
+argument Point this = 2048
+field int x = 3
+field int y = 4
+static int count = 1
+step: Main.main at Main.jack:8  do Output.printInt(r);
+local int r = 31
+error: undefined var x
+program exited
+`, out.String())
+	assert.Equal(t, "31", os.Output())
+}
+
+func TestDebugger_Step(t *testing.T) {
+	d, _ := loadProgram(t)
+	stop, err := d.Start()
+	assert.Nil(t, err)
+	assert.Equal(t, Stop{Reason: StopStep, Function: "Main.main", Position: Position{"Main.jack", 5, 3}}, stop)
+
+	stop, err = d.StepInto()
+	assert.Nil(t, err)
+	assert.Equal(t, Stop{Reason: StopStep, Function: "Point.new", Position: Position{"Point.jack", 6, 3}}, stop)
+	vars, err := d.Variables(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []Variable{
+		{"ax", "int", "argument", 3}, {"ay", "int", "argument", 4},
+		{"x", "int", "field", 0}, {"y", "int", "field", 0}, {"count", "int", "static", 0},
+	}, vars)
+
+	stop, err = d.StepOver()
+	assert.Nil(t, err)
+	assert.Equal(t, Position{"Point.jack", 7, 3}, stop.Position)
+	v, err := d.Lookup("x")
+	assert.Nil(t, err)
+	assert.Equal(t, int16(3), v.Value)
+
+	stop, err = d.StepOut()
+	assert.Nil(t, err)
+	assert.Equal(t, Stop{Reason: StopStep, Function: "Main.main", Position: Position{"Main.jack", 5, 3}}, stop)
+	vars, err = d.Variables(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []Variable{{"r", "int", "local", 0}, {"p", "Point", "local", 0}}, vars)
+
+	stop, err = d.StepOver()
+	assert.Nil(t, err)
+	assert.Equal(t, Position{"Main.jack", 6, 3}, stop.Position)
+	v, err = d.Lookup("p")
+	assert.Nil(t, err)
+	assert.Equal(t, int16(2048), v.Value)
+}
+
+func TestDebugger_Interrupt(t *testing.T) {
+	d, _ := loadProgram(t)
+	_, err := d.Start()
+	assert.Nil(t, err)
+	done := make(chan struct{})
+	d.Interrupt(done)
+	close(done)
+	stop, err := d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, StopPaused, stop.Reason)
+	assert.Equal(t, "Main.main", stop.Function)
+
+	d.Interrupt(nil)
+	stop, err = d.Continue()
+	assert.Nil(t, err)
+	assert.Equal(t, StopExited, stop.Reason)
+}
+
+func TestDebugger_Break(t *testing.T) {
+	d, _ := loadProgram(t)
+	pos, err := d.Break("Main.jack:11")
+	assert.Nil(t, err)
+	assert.Equal(t, Position{"Main.jack", 13, 3}, pos)
+	assert.Equal(t, []string{"Main.jack:11"}, d.Breakpoints())
+
+	_, err = d.Break("Main.jack:30")
+	assert.EqualError(t, err, "no code at Main.jack:30")
+	_, err = d.Break("Main.foo")
+	assert.EqualError(t, err, "undefined subroutine Main.foo")
+	_, err = d.Break("Main.jack:x")
+	assert.EqualError(t, err, "invalid line of breakpoint:Main.jack:x")
+	assert.EqualError(t, d.Clear("Main.fact"), "no breakpoint Main.fact")
+	_, err = d.Lookup("n")
+	assert.EqualError(t, err, "the program is not running")
+}
@@ -0,0 +1,160 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const scriptHelp = `commands:
+  break|b <File.jack:line|Class.subroutine>  set a breakpoint
+  clear <File.jack:line|Class.subroutine>    remove a breakpoint
+  run|r                                      start the program and run until a breakpoint
+  start                                      start the program and stop at the first statement
+  continue|c                                 run until a breakpoint
+  step|s                                     step into the next statement
+  next|n                                     step over the next statement
+  finish|out                                 run until the current subroutine returns
+  print|p <name>                             print a variable of the current subroutine
+  vars|info [frame]                          print the arguments, locals, fields and statics of a frame
+  backtrace|bt                               print the call stack
+  quit|q                                     quit the debugger`
+
+//Exec executes a command of the debugger and writes the result to w, it returns true for quit.
+//Errors of the command are written to w as well so that a script goes on
+func (d *Debugger) Exec(command string, w io.Writer) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	if err := d.exec(fields[0], fields[1:], w); err != nil {
+		if err == errQuit {
+			return true
+		}
+		fmt.Fprintf(w, "error: %s\n", err.Error())
+	}
+	return false
+}
+
+var errQuit = errors.New("quit")
+
+func (d *Debugger) exec(name string, args []string, w io.Writer) error {
+	arg := func() (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("%s requires one argument", name)
+		}
+		return args[0], nil
+	}
+	switch name {
+	case "break", "b":
+		spec, err := arg()
+		if err != nil {
+			return err
+		}
+		pos, err := d.Break(spec)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "breakpoint %s at %s\n", spec, pos)
+	case "clear":
+		spec, err := arg()
+		if err != nil {
+			return err
+		}
+		return d.Clear(spec)
+	case "run", "r", "start", "continue", "c", "step", "s", "next", "n", "finish", "out":
+		stop, err := d.control(name)
+		if err != nil {
+			return err
+		}
+		d.report(stop, w)
+	case "print", "p":
+		varName, err := arg()
+		if err != nil {
+			return err
+		}
+		v, err := d.Lookup(varName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, v)
+	case "vars", "info":
+		frame := 0
+		if len(args) > 0 {
+			f, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid frame:%s", args[0])
+			}
+			frame = f
+		}
+		vars, err := d.Variables(frame)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			fmt.Fprintln(w, v)
+		}
+	case "backtrace", "bt":
+		for i, frame := range d.Backtrace() {
+			if frame.Position.Line > 0 {
+				fmt.Fprintf(w, "#%d %s at %s\n", i, frame.Function, frame.Position)
+			} else {
+				fmt.Fprintf(w, "#%d %s at %s.vm:%d\n", i, frame.Function, frame.Location.File, frame.Location.Line)
+			}
+		}
+	case "help", "h":
+		fmt.Fprintln(w, scriptHelp)
+	case "quit", "q":
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command %s, try help", name)
+	}
+	return nil
+}
+
+func (d *Debugger) control(name string) (Stop, error) {
+	switch name {
+	case "run", "r":
+		if err := d.m.Boot(); err != nil {
+			return Stop{}, err
+		}
+		return d.Continue()
+	case "start":
+		return d.Start()
+	case "continue", "c":
+		return d.Continue()
+	case "step", "s":
+		return d.StepInto()
+	case "next", "n":
+		return d.StepOver()
+	}
+	return d.StepOut()
+}
+
+//report writes where the program stopped
+func (d *Debugger) report(stop Stop, w io.Writer) {
+	switch stop.Reason {
+	case StopExited, StopHalted:
+		fmt.Fprintf(w, "program %s\n", stop.Reason)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s at %s", stop.Reason, stop.Function, stop.Position)
+	if line := d.SourceLine(stop.Position); line != "" {
+		fmt.Fprintf(w, "  %s", line)
+	}
+	fmt.Fprintln(w)
+}
+
+//RunScript executes the commands of a script line by line until quit or the end of the script
+func (d *Debugger) RunScript(rd io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		if d.Exec(scanner.Text(), w) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
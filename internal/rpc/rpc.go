@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//the base protocol shared by the debug adapter and the language server:
+//messages are json bodies framed by a Content-Length header
+const contentLength = "Content-Length"
+
+//ReadMessage reads the body of the next message, io.EOF when the input is closed between messages
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("invalid header: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid header:%s", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(line[:i]), contentLength) {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid header:%s", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing header %s", contentLength)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+//Writer writes framed messages, it's safe for concurrent use
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) WriteMessage(body []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := fmt.Fprintf(w.w, "%s: %d\r\n\r\n", contentLength, len(body)); err != nil {
+		return err
+	}
+	_, err := w.w.Write(body)
+	return err
+}
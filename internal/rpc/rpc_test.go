@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessages(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.Nil(t, w.WriteMessage([]byte(`{"seq":1}`)))
+	assert.Nil(t, w.WriteMessage([]byte(`{}`)))
+	assert.Equal(t, "Content-Length: 9\r\n\r\n{\"seq\":1}Content-Length: 2\r\n\r\n{}", buf.String())
+
+	r := bufio.NewReader(strings.NewReader(buf.String() + "content-length: 4\r\nContent-Type: application/json\r\n\r\nnull"))
+	for _, expected := range []string{`{"seq":1}`, `{}`, `null`} {
+		body, err := ReadMessage(r)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(body))
+	}
+	_, err := ReadMessage(r)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessages_Errors(t *testing.T) {
+	tests := map[string]string{
+		"Content-Length: x\r\n\r\n":   "invalid header:Content-Length: x",
+		"Foo\r\n\r\n":                 "invalid header:Foo",
+		"Foo: 1\r\n\r\n":              "missing header Content-Length",
+		"Content-Length: 1\r\n":       "invalid header: EOF",
+		"Content-Length: 5\r\n\r\n{}": "unexpected EOF",
+	}
+	for input, msg := range tests {
+		_, err := ReadMessage(bufio.NewReader(strings.NewReader(input)))
+		assert.EqualError(t, err, msg, input)
+	}
+}
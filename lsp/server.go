@@ -0,0 +1,308 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/internal/rpc"
+)
+
+//requestError fails a request with the json rpc error code
+type requestError struct {
+	code    int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &requestError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+//Server is a language server of jack serving one editor over a stream, e.g. stdio.
+//All the jack files under the root of the workspace are analysed as one program,
+//the open files are analysed with the content in the editor
+type Server struct {
+	r        *bufio.Reader
+	w        *rpc.Writer
+	ws       *compiler.Workspace
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{r: bufio.NewReader(in), w: rpc.NewWriter(out), ws: compiler.NewWorkspace(compiler.Options{})}
+}
+
+//Serve handles the messages until exit or the end of the input
+func (s *Server) Serve() error {
+	for {
+		body, err := rpc.ReadMessage(s.r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return fmt.Errorf("invalid message: %s", err.Error())
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if msg.ID == nil {
+			if err := s.notified(msg); err != nil {
+				return err
+			}
+			continue
+		}
+		result, err := s.handle(msg)
+		if err := s.respond(msg, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) send(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.w.WriteMessage(body)
+}
+
+func (s *Server) respond(msg message, result interface{}, err error) error {
+	resp := response{JSONRPC: "2.0", ID: msg.ID, Result: result}
+	if err != nil {
+		e, ok := err.(*requestError)
+		if !ok {
+			e = &requestError{code: codeInvalidParams, message: err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = &responseError{Code: e.code, Message: e.message}
+	}
+	return s.send(resp)
+}
+
+func (s *Server) handle(msg message) (interface{}, error) {
+	if s.shutdown {
+		return nil, errorf(codeInvalidRequest, "the server is shut down")
+	}
+	switch msg.Method {
+	case "initialize":
+		return s.initialize(msg.Params)
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		return s.definition(msg.Params)
+	case "textDocument/references":
+		return s.references(msg.Params)
+	case "textDocument/hover":
+		return s.hover(msg.Params)
+	case "textDocument/completion":
+		return s.completion(msg.Params)
+	}
+	return nil, errorf(codeMethodNotFound, "unsupported method %s", msg.Method)
+}
+
+//notified handles a notification, the diagnostics are published again when a file changes
+func (s *Server) notified(msg message) error {
+	switch msg.Method {
+	case "initialized":
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		s.ws.Update(uriToPath(params.TextDocument.URI), params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		//the content is synchronized in full, the last change is the whole document
+		s.ws.Update(uriToPath(params.TextDocument.URI), params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		//the file on disk is a part of the program again
+		file := uriToPath(params.TextDocument.URI)
+		if content, err := ioutil.ReadFile(file); err == nil {
+			s.ws.Update(file, string(content))
+		} else {
+			s.ws.Remove(file)
+		}
+	default:
+		return nil
+	}
+	return s.publishDiagnostics()
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var args initializeParams
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	s.ws = compiler.NewWorkspace(compiler.Options{StrictTypes: args.InitializationOptions.StrictTypes})
+	if len(args.RootURI) > 0 {
+		if err := s.loadDir(uriToPath(args.RootURI)); err != nil {
+			return nil, err
+		}
+	}
+	return initializeResult{
+		Capabilities: serverCapabilities{
+			TextDocumentSync:   1,
+			DefinitionProvider: true,
+			ReferencesProvider: true,
+			HoverProvider:      true,
+			CompletionProvider: completionOptions{TriggerCharacters: []string{"."}},
+		},
+		ServerInfo: serverInfo{Name: "jackc"},
+	}, nil
+}
+
+//loadDir adds all the jack files under dir to the workspace
+func (s *Server) loadDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || filepath.Ext(path) != ".jack" {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		s.ws.Update(path, string(content))
+		return nil
+	})
+}
+
+//publishDiagnostics publishes the diagnostics of every file, an empty list clears the problems fixed
+func (s *Server) publishDiagnostics() error {
+	results := s.ws.Diagnostics()
+	for _, file := range s.ws.Files() {
+		diagnostics := []diagnostic{}
+		for _, d := range results[file] {
+			diagnostics = append(diagnostics, diagnostic{
+				Range:    toRange(d.Line, d.Column, d.EndColumn),
+				Severity: int(d.Severity) + 1,
+				Code:     string(d.Code),
+				Source:   "jackc",
+				Message:  d.Message,
+			})
+		}
+		params := publishDiagnosticsParams{URI: pathToURI(file), Diagnostics: diagnostics}
+		if err := s.send(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//toRange converts a 1 based span of a line to a range, a problem without position is at the beginning of the file
+func toRange(line, column, endColumn int) rangeOf {
+	if line <= 0 {
+		return rangeOf{}
+	}
+	if endColumn < column {
+		endColumn = column
+	}
+	return rangeOf{
+		Start: position{Line: line - 1, Character: column - 1},
+		End:   position{Line: line - 1, Character: endColumn - 1},
+	}
+}
+
+func toLocation(loc compiler.Location) location {
+	return location{URI: pathToURI(loc.File), Range: toRange(loc.Line, loc.Column, loc.EndColumn)}
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+//textPosition decodes the params of a position in a document, the position is converted to 1 based
+func textPosition(params json.RawMessage) (string, int, int, error) {
+	var args textDocumentPositionParams
+	if err := json.Unmarshal(params, &args); err != nil {
+		return "", 0, 0, err
+	}
+	return uriToPath(args.TextDocument.URI), args.Position.Line + 1, args.Position.Character + 1, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	file, line, column, err := textPosition(params)
+	if err != nil {
+		return nil, err
+	}
+	if loc, ok := s.ws.Definition(file, line, column); ok {
+		return toLocation(loc), nil
+	}
+	return nil, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var args referenceParams
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	file, line, column := uriToPath(args.TextDocument.URI), args.Position.Line+1, args.Position.Character+1
+	locations := []location{}
+	for _, loc := range s.ws.References(file, line, column, args.Context.IncludeDeclaration) {
+		locations = append(locations, toLocation(loc))
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	file, line, column, err := textPosition(params)
+	if err != nil {
+		return nil, err
+	}
+	detail, loc, ok := s.ws.Hover(file, line, column)
+	if !ok {
+		return nil, nil
+	}
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: "```jack\n" + detail + "\n```"},
+		Range:    toRange(loc.Line, loc.Column, loc.EndColumn),
+	}, nil
+}
+
+//kinds of completion items by subroutine category
+var completionKinds = map[string]int{"method": 2, "function": 3, "constructor": 4}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	file, line, column, err := textPosition(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.ws.Content(file); !ok {
+		return nil, errors.New("unknown document " + file)
+	}
+	items := []completionItem{}
+	for _, c := range s.ws.Completions(file, line, column) {
+		items = append(items, completionItem{Label: c.Label, Kind: completionKinds[c.Kind], Detail: c.Detail})
+	}
+	return items, nil
+}
@@ -0,0 +1,206 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/internal/rpc"
+)
+
+const pointJack = `class Point {
+	field int x;
+
+	constructor Point new(int ax) {
+		let x = ax;
+		return this;
+	}
+
+	method int getX() {
+		return x;
+	}
+}`
+
+const mainJack = `class Main {
+	function void main() {
+		var Point p;
+		let p = Point.new(1);
+		do Output.printInt(p.getX());
+		return;
+	}
+}`
+
+//client is a stub of the editor talking to the server through pipes
+type client struct {
+	t        *testing.T
+	w        *rpc.Writer
+	messages chan map[string]json.RawMessage
+	id       int
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, w: rpc.NewWriter(clientOut), messages: make(chan map[string]json.RawMessage, 100)}
+	go func() {
+		assert.Nil(t, NewServer(serverIn, serverOut).Serve())
+		serverOut.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := rpc.ReadMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var msg map[string]json.RawMessage
+			assert.Nil(t, json.Unmarshal(body, &msg))
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) next() map[string]json.RawMessage {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout")
+	}
+	return nil
+}
+
+func (c *client) write(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	assert.Nil(c.t, err)
+	assert.Nil(c.t, c.w.WriteMessage(body))
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.write(map[string]interface{}{"method": method, "params": params})
+}
+
+//request sends a request and decodes the result of its response, the error of the response is returned
+func (c *client) request(method string, params interface{}, result interface{}) *responseError {
+	c.id++
+	c.write(map[string]interface{}{"id": c.id, "method": method, "params": params})
+	msg := c.next()
+	assert.Equal(c.t, json.RawMessage(`"2.0"`), msg["jsonrpc"])
+	var id int
+	assert.Nil(c.t, json.Unmarshal(msg["id"], &id))
+	assert.Equal(c.t, c.id, id)
+	if msg["error"] != nil {
+		var e responseError
+		assert.Nil(c.t, json.Unmarshal(msg["error"], &e))
+		return &e
+	}
+	if result != nil {
+		assert.Nil(c.t, json.Unmarshal(msg["result"], result))
+	}
+	return nil
+}
+
+//diagnostics reads the diagnostics published for each file
+func (c *client) diagnostics(files int) map[string][]diagnostic {
+	published := map[string][]diagnostic{}
+	for i := 0; i < files; i++ {
+		msg := c.next()
+		assert.Equal(c.t, json.RawMessage(`"textDocument/publishDiagnostics"`), msg["method"])
+		var params publishDiagnosticsParams
+		assert.Nil(c.t, json.Unmarshal(msg["params"], &params))
+		published[params.URI] = params.Diagnostics
+	}
+	return published
+}
+
+func positionIn(uri string, line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: positionAt(line, character)}
+}
+
+func positionAt(line, character int) position {
+	return position{Line: line, Character: character}
+}
+
+func span(line, start, end int) rangeOf {
+	return rangeOf{Start: positionAt(line, start), End: positionAt(line, end)}
+}
+
+func TestServer_Session(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Point.jack"), []byte(pointJack), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "Main.jack"), []byte(mainJack), 0644))
+	mainURI, pointURI := pathToURI(filepath.Join(dir, "Main.jack")), pathToURI(filepath.Join(dir, "Point.jack"))
+
+	c := newClient(t)
+	var init initializeResult
+	assert.Nil(t, c.request("initialize", map[string]interface{}{"rootUri": pathToURI(dir)}, &init))
+	assert.True(t, init.Capabilities.DefinitionProvider)
+	assert.Equal(t, []string{"."}, init.Capabilities.CompletionProvider.TriggerCharacters)
+	//the files of the workspace are checked once initialized
+	c.notify("initialized", map[string]interface{}{})
+	published := c.diagnostics(2)
+	assert.Equal(t, []diagnostic{}, published[mainURI])
+	assert.Equal(t, []diagnostic{}, published[pointURI])
+
+	c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: mainURI, Text: mainJack}})
+	published = c.diagnostics(2)
+	assert.Equal(t, []diagnostic{}, published[mainURI])
+
+	var loc location
+	assert.Nil(t, c.request("textDocument/definition", positionIn(mainURI, 4, 24), &loc))
+	assert.Equal(t, location{URI: pointURI, Range: span(8, 12, 16)}, loc)
+
+	var refs []location
+	assert.Nil(t, c.request("textDocument/references", referenceParams{
+		textDocumentPositionParams: positionIn(pointURI, 1, 11),
+	}, &refs))
+	assert.Equal(t, []location{{URI: pointURI, Range: span(4, 6, 7)}, {URI: pointURI, Range: span(9, 9, 10)}}, refs)
+
+	var h hover
+	assert.Nil(t, c.request("textDocument/hover", positionIn(mainURI, 3, 17), &h))
+	assert.Equal(t, "```jack\nconstructor Point Point.new(int ax)\n```", h.Contents.Value)
+	assert.Equal(t, span(3, 16, 19), h.Range)
+	var none interface{}
+	assert.Nil(t, c.request("textDocument/hover", positionIn(mainURI, 0, 0), &none))
+	assert.Nil(t, none)
+
+	//the unsaved content in the editor is analysed
+	edited := "class Main {\n\tfunction void main() {\n\t\tvar Point p;\n\t\tdo p.\n\t}\n}"
+	c.notify("textDocument/didChange", didChangeParams{
+		TextDocument:   textDocumentIdentifier{URI: mainURI},
+		ContentChanges: []contentChange{{Text: edited}},
+	})
+	published = c.diagnostics(2)
+	assert.Equal(t, 1, len(published[mainURI]))
+	assert.Equal(t, diagnostic{Range: span(4, 1, 2), Severity: 1, Code: "JACK0012", Source: "jackc",
+		Message: "unexpected symbol '}', expected identifier"}, published[mainURI][0])
+	var items []completionItem
+	assert.Nil(t, c.request("textDocument/completion", positionIn(mainURI, 3, 7), &items))
+	assert.Equal(t, []completionItem{{Label: "getX", Kind: 2, Detail: "method int Point.getX()"}}, items)
+
+	//the file on disk is used after close
+	c.notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: mainURI}})
+	published = c.diagnostics(2)
+	assert.Equal(t, []diagnostic{}, published[mainURI])
+
+	assert.Equal(t, codeMethodNotFound, c.request("textDocument/rename", positionIn(mainURI, 0, 0), nil).Code)
+	assert.Nil(t, c.request("shutdown", nil, nil))
+	assert.Equal(t, codeInvalidRequest, c.request("textDocument/hover", positionIn(mainURI, 0, 0), nil).Code)
+	c.notify("exit", nil)
+	_, ok := <-c.messages
+	assert.False(t, ok)
+}
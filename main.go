@@ -1,25 +1,213 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
+	"github.com/zhangwuh/jack-compiler/assembler"
 	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/dap"
+	"github.com/zhangwuh/jack-compiler/debugger"
+	"github.com/zhangwuh/jack-compiler/lsp"
+	"github.com/zhangwuh/jack-compiler/vmemulator"
+	"github.com/zhangwuh/jack-compiler/vmtranslator"
 )
 
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+const (
+	translateUsage = "translate [vm file or dir] [output asm file](optional)"
+	asmUsage       = "asm [asm file] [output hack file](optional)"
+	runUsage       = "run [--max-steps n] [--native-os] [--screen png file] [--keys keys file] [vm dir]"
+	debugUsage     = "debug [--native-os] [--script commands file] [vm dir compiled with --source-map]"
+	dapUsage       = "dap"
+	lspUsage       = "lsp"
+)
+
+var commands = map[string]command{
+	"translate": {translateUsage, translate},
+	"asm":       {asmUsage, assemble},
+	"run":       {runUsage, run},
+	"debug":     {debugUsage, debug},
+	"dap":       {dapUsage, serveDAP},
+	"lsp":       {lspUsage, serveLSP},
+}
+
 func main() {
-	args := os.Args
-	if len(args) < 2 || len(args) > 3 {
-		fmt.Println("invalid params, usage go run main.go [source dir] [output dir](optional)")
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Println(os.Args[1] + " err:\n" + err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	compile(os.Args[1:])
+}
+
+func compile(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	strictTypes := flags.Bool("strict-types", false, "check the types of expressions with the declared types")
+	sourceComments := flags.Bool("source-comments", false, "comment the vm code of each statement with the jack line")
+	sourceMap := flags.Bool("source-map", false, "write a json source map from vm lines to jack lines for each class")
+	o1 := flags.Bool("O1", false, "remove dead code, fold constant expressions, inline small subroutines and rewrite redundant sequences of the vm code")
+	noInline := flags.Bool("no-inline", false, "don't inline small subroutines with -O1")
+	dumpIR := flags.Bool("dump-ir", false, "write the basic blocks of the vm functions to a .ir file and their control flow graphs to a graphviz .dot file for each class")
+	flags.Usage = usage(flags)
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("invalid params, usage go run main.go [options] [source dir] [output dir](optional)")
 		return
 	}
-	sourcePath := args[1]
+	sourcePath := args[0]
 	var outputPath string
-	if len(args) == 3 {
-		outputPath = args[2]
+	if len(args) == 2 {
+		outputPath = args[1]
 	}
-	if err := compiler.CompileDir(sourcePath, outputPath); err != nil {
-		fmt.Println("compile err:" + err.Error())
+	opts := compiler.Options{StrictTypes: *strictTypes, SourceComments: *sourceComments, SourceMap: *sourceMap, NoInline: *noInline, DumpIR: *dumpIR}
+	if *o1 {
+		opts.Optimize = 1
+	}
+	if err := compiler.CompileDirWithOptions(sourcePath, outputPath, opts); err != nil {
+		fmt.Println("compile err:\n" + err.Error())
+		os.Exit(1)
 	}
 	fmt.Println("compile done")
 }
+
+func usage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Println("usage: go run main.go [options] [source dir] [output dir](optional)")
+		flags.PrintDefaults()
+		for _, cmd := range commands {
+			fmt.Println("       go run main.go " + cmd.usage)
+		}
+	}
+}
+
+func translate(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("invalid params, usage go run main.go %s", translateUsage)
+	}
+	var output string
+	if len(args) == 2 {
+		output = args[1]
+	}
+	if err := vmtranslator.TranslatePath(args[0], output); err != nil {
+		return err
+	}
+	fmt.Println("translate done")
+	return nil
+}
+
+func assemble(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("invalid params, usage go run main.go %s", asmUsage)
+	}
+	var output string
+	if len(args) == 2 {
+		output = args[1]
+	}
+	if err := assembler.AssembleFile(args[0], output); err != nil {
+		return err
+	}
+	fmt.Println("assemble done")
+	return nil
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	maxSteps := flags.Int("max-steps", 0, "stop after executing n vm commands, 0 for unlimited")
+	nativeOS := flags.Bool("native-os", false, "run the OS classes natively and print the text output")
+	screen := flags.String("screen", "", "save the screen to the png file when the program exits")
+	keys := flags.String("keys", "", "feed the keyboard with a .keys script of \"step key\" lines, or type the text of other files")
+	keyInterval := flags.Int("key-interval", 10000, "steps to hold and release each key typed from a text file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("invalid params, usage go run main.go %s", runUsage)
+	}
+	m, err := vmemulator.LoadDir(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	m.SetMaxSteps(*maxSteps)
+	if *keys != "" {
+		events, err := vmemulator.LoadKeyboard(*keys, *keyInterval)
+		if err != nil {
+			return err
+		}
+		m.SetKeyboard(events)
+	}
+	var native *vmemulator.OS
+	if *nativeOS {
+		native = vmemulator.BindOS(m)
+	}
+	if err := m.Boot(); err != nil {
+		return err
+	}
+	err = m.Run()
+	if native != nil {
+		fmt.Println(native.Output())
+	}
+	if *screen != "" {
+		if err := m.SaveScreen(*screen); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("run done, %d steps\n", m.Steps())
+	return nil
+}
+
+func debug(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	nativeOS := flags.Bool("native-os", false, "run the OS classes natively")
+	script := flags.String("script", "", "read the debugger commands from the file instead of stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("invalid params, usage go run main.go %s", debugUsage)
+	}
+	d, err := debugger.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *nativeOS {
+		vmemulator.BindOS(d.Machine())
+	}
+	input := os.Stdin
+	if *script != "" {
+		if input, err = os.Open(*script); err != nil {
+			return err
+		}
+		defer input.Close()
+	}
+	return d.RunScript(input, os.Stdout)
+}
+
+//serveDAP serves a debug adapter protocol session over stdio for editors
+func serveDAP(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("invalid params, usage go run main.go %s", dapUsage)
+	}
+	return dap.NewServer(os.Stdin, os.Stdout).Serve()
+}
+
+//serveLSP serves the language server protocol over stdio for editors
+func serveLSP(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("invalid params, usage go run main.go %s", lspUsage)
+	}
+	return lsp.NewServer(os.Stdin, os.Stdout).Serve()
+}
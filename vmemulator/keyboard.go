@@ -0,0 +1,116 @@
+package vmemulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//KeyEvent sets the keyboard memory map to Key when Step commands have been executed, 0 for releasing the key
+type KeyEvent struct {
+	Step int
+	Key  int16
+}
+
+//keys of the hack character set
+var keyNames = map[string]int16{
+	"release": 0, "space": ' ', "newline": charNewLine, "backspace": charBackSpace,
+	"left": 130, "up": 131, "right": 132, "down": 133, "home": 134, "end": 135,
+	"pageup": 136, "pagedown": 137, "insert": 138, "delete": 139, "esc": 140,
+	"f1": 141, "f2": 142, "f3": 143, "f4": 144, "f5": 145, "f6": 146,
+	"f7": 147, "f8": 148, "f9": 149, "f10": 150, "f11": 151, "f12": 152,
+}
+
+//SetKeyboard feeds the events into RAM[24576] while the program runs, the events are replayed after Boot or Reset
+func (m *Machine) SetKeyboard(events []KeyEvent) {
+	m.keys = append([]KeyEvent(nil), events...)
+	sort.SliceStable(m.keys, func(i, j int) bool { return m.keys[i].Step < m.keys[j].Step })
+	m.nextKey = 0
+}
+
+func (m *Machine) updateKeyboard() {
+	for m.nextKey < len(m.keys) && m.keys[m.nextKey].Step <= m.steps {
+		m.RAM[KeyboardAddr] = m.keys[m.nextKey].Key
+		m.nextKey++
+	}
+}
+
+//ParseKeyScript parses a timeline of key events, one "step key" per line, e.g. "1000 right" or "2000 release".
+//A key is a name of keyNames, a single char or a key code, empty lines and lines starting with # are ignored
+func ParseKeyScript(rd io.Reader) ([]KeyEvent, error) {
+	var events []KeyEvent
+	scanner := bufio.NewScanner(rd)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: invalid key event:%s", line, text)
+		}
+		step, err := strconv.Atoi(fields[0])
+		if err != nil || step < 0 {
+			return nil, fmt.Errorf("line %d: invalid step:%s", line, fields[0])
+		}
+		key, err := parseKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		events = append(events, KeyEvent{step, key})
+	}
+	return events, scanner.Err()
+}
+
+func parseKey(s string) (int16, error) {
+	if key, ok := keyNames[strings.ToLower(s)]; ok {
+		return key, nil
+	}
+	if r := []rune(s); len(r) == 1 {
+		return int16(r[0]), nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 0 || code > 152 {
+		return 0, fmt.Errorf("invalid key:%s", s)
+	}
+	return int16(code), nil
+}
+
+//TypeText presses and releases the keys of the text one by one from the start step,
+//each key is held for interval steps and released for interval steps, '\n' is typed as the newline key
+func TypeText(text string, start, interval int) []KeyEvent {
+	var events []KeyEvent
+	step := start
+	for _, c := range text {
+		key := int16(c)
+		if c == '\n' {
+			key = charNewLine
+		}
+		events = append(events, KeyEvent{step, key}, KeyEvent{step + interval, 0})
+		step += 2 * interval
+	}
+	return events
+}
+
+//LoadKeyboard loads the key events of a file, a .keys file is parsed by ParseKeyScript,
+//other files are typed as text by TypeText
+func LoadKeyboard(path string, interval int) ([]KeyEvent, error) {
+	if strings.HasSuffix(path, ".keys") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseKeyScript(f)
+	}
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return TypeText(string(text), interval, interval), nil
+}
@@ -0,0 +1,82 @@
+package vmemulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyScript(t *testing.T) {
+	events, err := ParseKeyScript(strings.NewReader(`
+# move right then quit
+100 right
+200 release
+300 q
+400 0
+500 65
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []KeyEvent{{100, 132}, {200, 0}, {300, 'q'}, {400, '0'}, {500, 65}}, events)
+
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"100", "line 1: invalid key event:100"},
+		{"\nx up", "line 2: invalid step:x"},
+		{"-1 up", "line 1: invalid step:-1"},
+		{"1 upper", "line 1: invalid key:upper"},
+		{"1 153", "line 1: invalid key:153"},
+	}
+	for _, test := range tests {
+		_, err := ParseKeyScript(strings.NewReader(test.script))
+		assert.EqualError(t, err, test.err, test.script)
+	}
+}
+
+func TestTypeText(t *testing.T) {
+	assert.Equal(t, []KeyEvent{{10, 'a'}, {15, 0}, {20, charNewLine}, {25, 0}}, TypeText("a\n", 10, 5))
+}
+
+func TestKeyboard_Square(t *testing.T) {
+	m, err := LoadDir(compileProgram(t, "Square"))
+	assert.Nil(t, err)
+	BindOS(m)
+	m.SetKeyboard([]KeyEvent{{1000, 132}, {5000, 0}, {6000, 'Q'}, {7000, 0}})
+	m.SetMaxSteps(100000)
+	assert.Nil(t, m.Boot())
+	assert.Nil(t, m.Run())
+	assert.True(t, m.Halted())
+
+	img := m.ScreenImage()
+	left := 0
+	for img.ColorIndexAt(left, 0) == 0 {
+		left++
+	}
+	//the square of size 30 moves 2 pixels right each time
+	assert.True(t, left > 0)
+	assert.Equal(t, 0, left%2)
+	assert.Equal(t, uint8(1), img.ColorIndexAt(left+30, 30))
+	assert.Equal(t, uint8(0), img.ColorIndexAt(left+31, 0))
+}
+
+func TestKeyboard_ReadInt(t *testing.T) {
+	dir := compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		var int n;
+		let n = Keyboard.readInt("n? ");
+		do Output.printInt(n * 2);
+		return;
+	}
+}`})
+	m, err := LoadDir(dir)
+	assert.Nil(t, err)
+	os := BindOS(m)
+	m.SetKeyboard(append(TypeText("2x", 100, 50), TypeText(string([]rune{charBackSpace})+"1\n", 300, 50)...))
+	m.SetMaxSteps(100000)
+	assert.Nil(t, m.Boot())
+	assert.Nil(t, m.Run())
+	assert.Equal(t, "n? 21\n42", os.Output())
+}
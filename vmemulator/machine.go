@@ -0,0 +1,544 @@
+package vmemulator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zhangwuh/jack-compiler/vmtranslator"
+)
+
+//memory map of the hack platform
+const (
+	SP   = 0
+	LCL  = 1
+	ARG  = 2
+	THIS = 3
+	THAT = 4
+
+	TempBase     = 5
+	StaticBase   = 16
+	StackBase    = 256
+	HeapBase     = 2048
+	ScreenBase   = 16384
+	KeyboardAddr = 24576
+	RAMSize      = 32768
+)
+
+const (
+	initFunction = "Sys.init"
+	mainFunction = "Main.main"
+	haltFunction = "Sys.halt"
+)
+
+var ErrStepLimit = errors.New("step limit exceeded")
+
+//errWait is returned by a builtin waiting for an event, e.g. a key press, the call is executed again in the next step
+var errWait = errors.New("wait")
+
+//Builtin is a native implementation of a vm function, args are the arguments on the stack from the first to the last
+type Builtin func(m *Machine, args []int16) (int16, error)
+
+//instruction is a vm command with its jump target resolved
+type instruction struct {
+	vmtranslator.Command
+	file     string
+	function string //name of the function the command belongs to
+	target   int    //pc of the label of goto/if-goto, pc of the function of call, -1 if undefined
+	address  int    //address of static variables
+}
+
+//Frame is a subroutine being called
+type Frame struct {
+	Function       string
+	PC             int //pc of the command being executed in the frame
+	LCL, ARG, THIS int
+}
+
+//Location is where a command is in the vm files
+type Location struct {
+	File     string //name of the vm file without extension
+	Line     int
+	Function string
+}
+
+//Machine executes vm code on a simulated RAM, with the same memory layout as the translated hack program:
+//the stack, the segment pointers, the call frames and static variables are all in RAM
+type Machine struct {
+	RAM       [RAMSize]int16
+	program   []instruction
+	functions map[string]int
+	builtins  map[string]Builtin
+	pc        int
+	frames    []Frame
+	steps     int
+	maxSteps  int //0 for unlimited
+	halted    bool
+	keys      []KeyEvent
+	nextKey   int //index of the next key event
+}
+
+//Load resolves labels, functions and static variables of the sources
+func Load(sources []vmtranslator.Source) (*Machine, error) {
+	m := &Machine{functions: map[string]int{}, builtins: map[string]Builtin{}}
+	statics := map[string]int{}
+	labels := map[string]int{}
+	for _, src := range sources {
+		var function string
+		for _, cmd := range src.Commands {
+			inst := instruction{Command: cmd, file: src.Name, target: -1}
+			switch cmd.Type {
+			case vmtranslator.CFunction:
+				function = cmd.Arg1
+				if _, ok := m.functions[function]; ok {
+					return nil, fmt.Errorf("%s.vm:%d: duplicated function %s", src.Name, cmd.Line, function)
+				}
+				m.functions[function] = len(m.program)
+			case vmtranslator.CLabel:
+				labels[function+"$"+cmd.Arg1] = len(m.program)
+			case vmtranslator.CPush, vmtranslator.CPop:
+				if cmd.Arg1 == "static" {
+					name := fmt.Sprintf("%s.%d", src.Name, cmd.Arg2)
+					if _, ok := statics[name]; !ok {
+						statics[name] = StaticBase + len(statics)
+					}
+					inst.address = statics[name]
+				}
+			}
+			inst.function = function
+			m.program = append(m.program, inst)
+		}
+	}
+	if len(statics) > StackBase-StaticBase {
+		return nil, fmt.Errorf("too many static variables:%d", len(statics))
+	}
+
+	for i := range m.program {
+		inst := &m.program[i]
+		switch inst.Type {
+		case vmtranslator.CGoto, vmtranslator.CIf:
+			target, ok := labels[inst.function+"$"+inst.Arg1]
+			if !ok {
+				return nil, fmt.Errorf("%s.vm:%d: undefined label %s", inst.file, inst.Line, inst.Arg1)
+			}
+			inst.target = target
+		case vmtranslator.CCall:
+			if target, ok := m.functions[inst.Arg1]; ok {
+				inst.target = target
+			}
+		}
+	}
+	m.Reset()
+	return m, nil
+}
+
+//LoadDir loads all the vm files of a directory, e.g. the output of compiler.CompileDir with the OS vm files
+func LoadDir(path string) (*Machine, error) {
+	sources, err := vmtranslator.ParseDir(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(sources)
+}
+
+//Reset clears the RAM and the call stack
+func (m *Machine) Reset() {
+	m.RAM = [RAMSize]int16{}
+	m.RAM[SP] = StackBase
+	m.frames = nil
+	m.steps = 0
+	m.halted = false
+	m.nextKey = 0
+	m.pc = len(m.program)
+}
+
+//SetMaxSteps limits the number of commands executed by Run and Call, 0 for unlimited
+func (m *Machine) SetMaxSteps(n int) {
+	m.maxSteps = n
+}
+
+func (m *Machine) Steps() int {
+	return m.steps
+}
+
+func (m *Machine) Halted() bool {
+	return m.halted
+}
+
+func (m *Machine) HasFunction(name string) bool {
+	_, ok := m.functions[name]
+	return ok || m.builtins[name] != nil
+}
+
+//Bind replaces the vm function with a native implementation, the function doesn't need to be loaded
+func (m *Machine) Bind(name string, fn Builtin) {
+	m.builtins[name] = fn
+}
+
+//Boot calls Sys.init like the bootstrap code of the hack platform,
+//or Main.main if Sys.init is not defined, e.g. the OS is bound to builtins without loading the OS vm files
+func (m *Machine) Boot() error {
+	m.Reset()
+	if m.HasFunction(initFunction) {
+		return m.call(initFunction, 0, len(m.program))
+	}
+	return m.call(mainFunction, 0, len(m.program))
+}
+
+//Run executes until the program halts or returns from the outermost function
+func (m *Machine) Run() error {
+	for !m.Done() {
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Done reports whether there is nothing more to execute
+func (m *Machine) Done() bool {
+	return m.halted || len(m.frames) == 0
+}
+
+//Call runs a function with args on the current RAM and returns its return value
+func (m *Machine) Call(name string, args ...int16) (int16, error) {
+	m.frames = nil
+	m.halted = false
+	for _, arg := range args {
+		if err := m.push(arg); err != nil {
+			return 0, err
+		}
+	}
+	if err := m.call(name, len(args), len(m.program)); err != nil {
+		return 0, err
+	}
+	if err := m.Run(); err != nil {
+		return 0, err
+	}
+	if m.halted {
+		return 0, fmt.Errorf("%s halted", name)
+	}
+	return m.pop()
+}
+
+//Stack returns the values on the stack, from the bottom to the top
+func (m *Machine) Stack() []int16 {
+	sp := int(m.RAM[SP])
+	if sp < StackBase || sp > ScreenBase {
+		return nil
+	}
+	return append([]int16(nil), m.RAM[StackBase:sp]...)
+}
+
+//CallStack returns the frames being called, the innermost frame is the last one
+func (m *Machine) CallStack() []Frame {
+	frames := append([]Frame(nil), m.frames...)
+	if len(frames) > 0 {
+		frames[len(frames)-1].PC = m.pc
+	}
+	for i := range frames {
+		if i == len(frames)-1 {
+			frames[i].THIS = int(m.RAM[THIS])
+		} else {
+			frames[i].THIS = int(m.RAM[frames[i+1].LCL-2]) //saved by the callee
+		}
+	}
+	return frames
+}
+
+//Depth is the number of frames being called
+func (m *Machine) Depth() int {
+	return len(m.frames)
+}
+
+//PC is the index of the next command to execute
+func (m *Machine) PC() int {
+	return m.pc
+}
+
+//ProgramSize is the number of commands loaded
+func (m *Machine) ProgramSize() int {
+	return len(m.program)
+}
+
+//Location returns where the command at pc is
+func (m *Machine) Location(pc int) (Location, bool) {
+	if pc < 0 || pc >= len(m.program) {
+		return Location{}, false
+	}
+	inst := m.program[pc]
+	return Location{File: inst.file, Line: inst.Line, Function: inst.function}, true
+}
+
+//FunctionPC returns the pc of the function command of a loaded function
+func (m *Machine) FunctionPC(name string) (int, bool) {
+	pc, ok := m.functions[name]
+	return pc, ok
+}
+
+//StaticAddress returns the address of the static variable i of a vm file, false if it's never used
+func (m *Machine) StaticAddress(file string, i int) (int, bool) {
+	for _, inst := range m.program {
+		if inst.file == file && inst.Arg1 == "static" && inst.Arg2 == i &&
+			(inst.Type == vmtranslator.CPush || inst.Type == vmtranslator.CPop) {
+			return inst.address, true
+		}
+	}
+	return 0, false
+}
+
+//Segment reads the i'th element of a virtual memory segment of the current function
+func (m *Machine) Segment(segment string, i int) (int16, error) {
+	address, err := m.segmentAddress(segment, i)
+	if err != nil {
+		return 0, err
+	}
+	if segment == "constant" {
+		return int16(i), nil
+	}
+	return m.read(address)
+}
+
+func (m *Machine) segmentAddress(segment string, i int) (int, error) {
+	switch segment {
+	case "local":
+		return int(m.RAM[LCL]) + i, nil
+	case "argument":
+		return int(m.RAM[ARG]) + i, nil
+	case "this":
+		return int(m.RAM[THIS]) + i, nil
+	case "that":
+		return int(m.RAM[THAT]) + i, nil
+	case "temp":
+		return TempBase + i, nil
+	case "pointer":
+		return THIS + i, nil
+	case "constant":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unknown segment:%s", segment)
+}
+
+func (m *Machine) read(address int) (int16, error) {
+	if address < 0 || address >= RAMSize {
+		return 0, fmt.Errorf("invalid memory address:%d", address)
+	}
+	return m.RAM[address], nil
+}
+
+func (m *Machine) write(address int, v int16) error {
+	if address < 0 || address >= RAMSize {
+		return fmt.Errorf("invalid memory address:%d", address)
+	}
+	m.RAM[address] = v
+	return nil
+}
+
+func (m *Machine) push(v int16) error {
+	sp := int(m.RAM[SP])
+	if sp < StackBase {
+		return fmt.Errorf("invalid stack pointer:%d", sp)
+	}
+	if sp >= HeapBase {
+		return errors.New("stack overflow")
+	}
+	m.RAM[sp] = v
+	m.RAM[SP]++
+	return nil
+}
+
+func (m *Machine) pop() (int16, error) {
+	sp := int(m.RAM[SP])
+	if sp <= StackBase {
+		return 0, errors.New("stack underflow")
+	}
+	m.RAM[SP]--
+	return m.RAM[sp-1], nil
+}
+
+//call saves the frame of the caller on the stack and jumps to the function
+func (m *Machine) call(name string, args int, ret int) error {
+	if fn, ok := m.builtins[name]; ok {
+		return m.callBuiltin(fn, args, ret)
+	}
+	if name == haltFunction {
+		m.halted = true
+		return nil
+	}
+	target, ok := m.functions[name]
+	if !ok {
+		return fmt.Errorf("undefined function %s", name)
+	}
+	for _, v := range []int16{int16(ret), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+		if err := m.push(v); err != nil {
+			return err
+		}
+	}
+	m.RAM[ARG] = m.RAM[SP] - int16(args) - 5
+	m.RAM[LCL] = m.RAM[SP]
+	if len(m.frames) > 0 {
+		m.frames[len(m.frames)-1].PC = m.pc - 1
+	}
+	m.frames = append(m.frames, Frame{Function: name, PC: target, LCL: int(m.RAM[LCL]), ARG: int(m.RAM[ARG])})
+	m.pc = target
+	return nil
+}
+
+func (m *Machine) callBuiltin(fn Builtin, args int, ret int) error {
+	sp := int(m.RAM[SP])
+	if sp-args < StackBase {
+		return errors.New("stack underflow")
+	}
+	v, err := fn(m, append([]int16(nil), m.RAM[sp-args:sp]...))
+	if err == errWait {
+		if ret >= len(m.program) {
+			return errors.New("builtin can't wait outside of the program")
+		}
+		m.pc = ret - 1
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.RAM[SP] = int16(sp - args)
+	if m.halted {
+		return nil
+	}
+	return m.push(v)
+}
+
+func (m *Machine) ret() error {
+	frame := int(m.RAM[LCL])
+	if frame < StackBase+5 {
+		return errors.New("return without call")
+	}
+	ret := m.RAM[frame-5]
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+	if err := m.write(int(m.RAM[ARG]), v); err != nil {
+		return err
+	}
+	m.RAM[SP] = m.RAM[ARG] + 1
+	m.RAM[THAT] = m.RAM[frame-1]
+	m.RAM[THIS] = m.RAM[frame-2]
+	m.RAM[ARG] = m.RAM[frame-3]
+	m.RAM[LCL] = m.RAM[frame-4]
+	m.frames = m.frames[:len(m.frames)-1]
+	m.pc = int(ret)
+	return nil
+}
+
+//Step executes one command
+func (m *Machine) Step() error {
+	if m.Done() {
+		return errors.New("no function is running")
+	}
+	if m.maxSteps > 0 && m.steps >= m.maxSteps {
+		return ErrStepLimit
+	}
+	if m.pc < 0 || m.pc >= len(m.program) {
+		return fmt.Errorf("invalid pc:%d", m.pc)
+	}
+	m.updateKeyboard()
+	inst := m.program[m.pc]
+	m.pc++
+	m.steps++
+	if err := m.execute(inst); err != nil {
+		return fmt.Errorf("%s.vm:%d %s: %s", inst.file, inst.Line, inst.String(), err.Error())
+	}
+	return nil
+}
+
+func (m *Machine) execute(inst instruction) error {
+	switch inst.Type {
+	case vmtranslator.CArithmetic:
+		return m.arithmetic(inst.Op)
+	case vmtranslator.CPush:
+		v := int16(inst.Arg2)
+		if inst.Arg1 != "constant" {
+			address := inst.address
+			if inst.Arg1 != "static" {
+				address, _ = m.segmentAddress(inst.Arg1, inst.Arg2)
+			}
+			var err error
+			if v, err = m.read(address); err != nil {
+				return err
+			}
+		}
+		return m.push(v)
+	case vmtranslator.CPop:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		address := inst.address
+		if inst.Arg1 != "static" {
+			address, _ = m.segmentAddress(inst.Arg1, inst.Arg2)
+		}
+		return m.write(address, v)
+	case vmtranslator.CGoto:
+		m.pc = inst.target
+	case vmtranslator.CIf:
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			m.pc = inst.target
+		}
+	case vmtranslator.CFunction:
+		for i := 0; i < inst.Arg2; i++ {
+			if err := m.push(0); err != nil {
+				return err
+			}
+		}
+	case vmtranslator.CCall:
+		return m.call(inst.Arg1, inst.Arg2, m.pc)
+	case vmtranslator.CReturn:
+		return m.ret()
+	}
+	return nil
+}
+
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+func (m *Machine) arithmetic(op string) error {
+	y, err := m.pop()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "neg":
+		return m.push(-y)
+	case "not":
+		return m.push(^y)
+	}
+	x, err := m.pop()
+	if err != nil {
+		return err
+	}
+	var v int16
+	switch op {
+	case "add":
+		v = x + y
+	case "sub":
+		v = x - y
+	case "and":
+		v = x & y
+	case "or":
+		v = x | y
+	case "eq":
+		v = boolValue(x == y)
+	case "gt":
+		v = boolValue(x > y)
+	case "lt":
+		v = boolValue(x < y)
+	}
+	return m.push(v)
+}
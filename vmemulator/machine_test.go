@@ -0,0 +1,143 @@
+package vmemulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler"
+	"github.com/zhangwuh/jack-compiler/vmtranslator"
+)
+
+var osClasses = []string{"Array", "Keyboard", "Math", "Memory", "Output", "Screen", "String", "Sys"}
+
+//compileProgram compiles a sample program into a temp dir together with the OS vm files
+func compileProgram(t *testing.T, sample string) string {
+	dir, err := ioutil.TempDir("", "vm")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	assert.Nil(t, compiler.CompileDir(filepath.Join("../sample", sample), dir))
+	for _, class := range osClasses {
+		code, err := ioutil.ReadFile(filepath.Join("../output/vm/Pong", class+".vm"))
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, class+".vm"), code, 0644))
+	}
+	return dir
+}
+
+func loadVM(t *testing.T, sources map[string]string) *Machine {
+	var srcs []vmtranslator.Source
+	for _, name := range []string{"Main", "Sys"} {
+		if code, ok := sources[name]; ok {
+			src, err := vmtranslator.Parse(name, strings.NewReader(code))
+			assert.Nil(t, err)
+			srcs = append(srcs, src)
+		}
+	}
+	m, err := Load(srcs)
+	assert.Nil(t, err)
+	return m
+}
+
+func TestMachine_Fibonacci(t *testing.T) {
+	m, err := LoadDir(compileProgram(t, "fibonacci"))
+	assert.Nil(t, err)
+	v, err := m.Call("Main.fib", 20)
+	assert.Nil(t, err)
+	assert.Equal(t, int16(6765), v)
+	assert.Empty(t, m.Stack())
+
+	assert.Nil(t, m.Boot())
+	assert.Nil(t, m.Run())
+	assert.True(t, m.Halted())
+	assert.Equal(t, "Sys.init", m.CallStack()[0].Function)
+}
+
+func TestMachine_Frames(t *testing.T) {
+	m := loadVM(t, map[string]string{"Main": `
+function Main.sum 1
+push argument 0
+push argument 1
+add
+pop local 0
+push constant 5
+pop static 0
+push local 0
+push static 0
+call Main.double 1
+add
+return
+function Main.double 0
+push argument 0
+push argument 0
+add
+return`})
+	v, err := m.Call("Main.sum", 3, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, int16(17), v)
+	assert.Equal(t, int16(5), m.RAM[StaticBase])
+	assert.Equal(t, int16(StackBase), m.RAM[SP])
+}
+
+func TestMachine_Inspect(t *testing.T) {
+	m := loadVM(t, map[string]string{"Main": `
+function Main.main 2
+push constant 7
+pop local 1
+push constant 8
+call Main.f 1
+return
+function Main.f 0
+push constant 1
+push constant 2
+return`})
+	m.frames = nil
+	assert.Nil(t, m.call("Main.main", 0, len(m.program)))
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, m.Step())
+	}
+	frames := m.CallStack()
+	assert.Equal(t, 2, len(frames))
+	assert.Equal(t, "Main.main", frames[0].Function)
+	assert.Equal(t, "Main.f", frames[1].Function)
+	v, err := m.Segment("argument", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int16(8), v)
+	assert.Equal(t, []int16{10, 0, 0, 0, 0, 0, 7, 8, 5, 261, 256, 0, 0, 1}, m.Stack())
+}
+
+func TestMachine_StepLimit(t *testing.T) {
+	m := loadVM(t, map[string]string{"Main": `
+function Main.loop 0
+label L
+goto L`})
+	m.SetMaxSteps(1000)
+	_, err := m.Call("Main.loop")
+	assert.Equal(t, ErrStepLimit, err)
+	assert.Equal(t, 1000, m.Steps())
+}
+
+func TestMachine_Errors(t *testing.T) {
+	m := loadVM(t, map[string]string{"Main": `
+function Main.main 0
+call Main.missing 0
+return`})
+	_, err := m.Call("Main.main")
+	assert.EqualError(t, err, "Main.vm:3 call Main.missing 0: undefined function Main.missing")
+
+	m = loadVM(t, map[string]string{"Main": `
+function Main.main 0
+push constant 1
+neg
+pop pointer 1
+push that 0
+return`})
+	_, err = m.Call("Main.main")
+	assert.EqualError(t, err, "Main.vm:6 push that 0: invalid memory address:-1")
+
+	_, err = Load([]vmtranslator.Source{{Name: "Main", Commands: []vmtranslator.Command{{Type: vmtranslator.CGoto, Arg1: "X", Line: 1}}}})
+	assert.EqualError(t, err, "Main.vm:1: undefined label X")
+}
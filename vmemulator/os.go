@@ -0,0 +1,555 @@
+package vmemulator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//special characters of the hack character set
+const (
+	charNewLine     = 128
+	charBackSpace   = 129
+	charDoubleQuote = 34
+)
+
+const (
+	ScreenWidth  = 512
+	ScreenHeight = 256
+	screenWords  = ScreenWidth / 16
+)
+
+//OS is a native implementation of the Jack OS classes.
+//Objects(arrays and strings) are allocated on the heap of the RAM so that the vm code can access them,
+//a string is stored as [max length, length, chars...].
+//Output writes to a text buffer instead of the screen, Keyboard and Screen use the memory maps of the RAM
+type OS struct {
+	free      []block       //free blocks of the heap sorted by address
+	allocated map[int]int   //address -> size of the allocated blocks
+	output    []rune        //text printed by Output
+	color     bool          //color of Screen, true for black
+	reading   *readingState //state of the Keyboard.read* call waiting for keys
+}
+
+type block struct {
+	address, size int
+}
+
+type readingState struct {
+	key  int16 //the key pressed, waiting for release
+	line []rune
+}
+
+//BindOS binds the functions of the OS classes to native implementations, the OS vm files are not necessary to run a program.
+//Sys.init is not bound, Boot calls Main.main if it's not loaded
+func BindOS(m *Machine) *OS {
+	os := &OS{}
+	os.initHeap()
+	os.color = true
+	builtins := map[string]Builtin{
+		"Math.init":     noop,
+		"Math.abs":      unary(func(x int16) int16 { return abs(x) }),
+		"Math.multiply": binary(func(x, y int16) int16 { return x * y }),
+		"Math.divide":   mathDivide,
+		"Math.min": binary(func(x, y int16) int16 {
+			if x < y {
+				return x
+			}
+			return y
+		}),
+		"Math.max": binary(func(x, y int16) int16 {
+			if x > y {
+				return x
+			}
+			return y
+		}),
+		"Math.sqrt": mathSqrt,
+
+		"Memory.init":    func(m *Machine, args []int16) (int16, error) { os.initHeap(); return 0, nil },
+		"Memory.peek":    func(m *Machine, args []int16) (int16, error) { return m.read(int(args[0])) },
+		"Memory.poke":    func(m *Machine, args []int16) (int16, error) { return 0, m.write(int(args[0]), args[1]) },
+		"Memory.alloc":   func(m *Machine, args []int16) (int16, error) { return os.alloc(int(args[0])) },
+		"Memory.deAlloc": func(m *Machine, args []int16) (int16, error) { return 0, os.deAlloc(int(args[0])) },
+		"Array.new": func(m *Machine, args []int16) (int16, error) {
+			if args[0] <= 0 {
+				return 0, fmt.Errorf("invalid array size:%d", args[0])
+			}
+			return os.alloc(int(args[0]))
+		},
+		"Array.dispose": func(m *Machine, args []int16) (int16, error) { return 0, os.deAlloc(int(args[0])) },
+
+		"String.new":           os.stringNew,
+		"String.dispose":       func(m *Machine, args []int16) (int16, error) { return 0, os.deAlloc(int(args[0])) },
+		"String.length":        func(m *Machine, args []int16) (int16, error) { return m.read(int(args[0]) + 1) },
+		"String.charAt":        stringCharAt,
+		"String.setCharAt":     stringSetCharAt,
+		"String.appendChar":    stringAppendChar,
+		"String.eraseLastChar": stringEraseLastChar,
+		"String.intValue":      stringIntValue,
+		"String.setInt":        stringSetInt,
+		"String.newLine":       constant(charNewLine),
+		"String.backSpace":     constant(charBackSpace),
+		"String.doubleQuote":   constant(charDoubleQuote),
+
+		"Output.init":        func(m *Machine, args []int16) (int16, error) { os.output = nil; return 0, nil },
+		"Output.moveCursor":  noop,
+		"Output.printChar":   func(m *Machine, args []int16) (int16, error) { os.printChar(args[0]); return 0, nil },
+		"Output.printString": os.printString,
+		"Output.printInt": func(m *Machine, args []int16) (int16, error) {
+			os.print(strconv.Itoa(int(args[0])))
+			return 0, nil
+		},
+		"Output.println":   func(m *Machine, args []int16) (int16, error) { os.printChar(charNewLine); return 0, nil },
+		"Output.backSpace": func(m *Machine, args []int16) (int16, error) { os.printChar(charBackSpace); return 0, nil },
+
+		"Screen.init":          func(m *Machine, args []int16) (int16, error) { os.color = true; return 0, nil },
+		"Screen.clearScreen":   screenClear,
+		"Screen.setColor":      func(m *Machine, args []int16) (int16, error) { os.color = args[0] != 0; return 0, nil },
+		"Screen.drawPixel":     func(m *Machine, args []int16) (int16, error) { return 0, os.drawPixel(m, int(args[0]), int(args[1])) },
+		"Screen.drawLine":      os.drawLine,
+		"Screen.drawRectangle": os.drawRectangle,
+		"Screen.drawCircle":    os.drawCircle,
+
+		"Keyboard.init":       noop,
+		"Keyboard.keyPressed": func(m *Machine, args []int16) (int16, error) { return m.RAM[KeyboardAddr], nil },
+		"Keyboard.readChar":   os.readChar,
+		"Keyboard.readLine":   os.readLine,
+		"Keyboard.readInt":    os.readInt,
+
+		"Sys.wait": noop,
+		"Sys.error": func(m *Machine, args []int16) (int16, error) {
+			os.print(fmt.Sprintf("ERR%d", args[0]))
+			m.halted = true
+			return 0, nil
+		},
+	}
+	for name, fn := range builtins {
+		m.Bind(name, fn)
+	}
+	return os
+}
+
+//Output returns the text printed by the program
+func (os *OS) Output() string {
+	return string(os.output)
+}
+
+func noop(m *Machine, args []int16) (int16, error) {
+	return 0, nil
+}
+
+func constant(v int16) Builtin {
+	return func(m *Machine, args []int16) (int16, error) {
+		return v, nil
+	}
+}
+
+func unary(fn func(x int16) int16) Builtin {
+	return func(m *Machine, args []int16) (int16, error) {
+		return fn(args[0]), nil
+	}
+}
+
+func binary(fn func(x, y int16) int16) Builtin {
+	return func(m *Machine, args []int16) (int16, error) {
+		return fn(args[0], args[1]), nil
+	}
+}
+
+func abs(x int16) int16 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func mathDivide(m *Machine, args []int16) (int16, error) {
+	if args[1] == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return args[0] / args[1], nil
+}
+
+func mathSqrt(m *Machine, args []int16) (int16, error) {
+	x := int(args[0])
+	if x < 0 {
+		return 0, fmt.Errorf("sqrt of negative number:%d", x)
+	}
+	y := 0
+	for (y+1)*(y+1) <= x {
+		y++
+	}
+	return int16(y), nil
+}
+
+func (os *OS) initHeap() {
+	os.free = []block{{HeapBase, ScreenBase - HeapBase}}
+	os.allocated = map[int]int{}
+}
+
+//alloc finds the first free block fitting the size, an object without fields still gets a word
+//so that its address is distinct as with Memory.vm
+func (os *OS) alloc(size int) (int16, error) {
+	if size < 0 {
+		return 0, fmt.Errorf("invalid allocation size:%d", size)
+	}
+	if size == 0 {
+		size = 1
+	}
+	for i, b := range os.free {
+		if b.size < size {
+			continue
+		}
+		if b.size == size {
+			os.free = append(os.free[:i], os.free[i+1:]...)
+		} else {
+			os.free[i] = block{b.address + size, b.size - size}
+		}
+		os.allocated[b.address] = size
+		return int16(b.address), nil
+	}
+	return 0, errors.New("heap overflow")
+}
+
+//deAlloc returns the block to the free list and merges it with the adjacent free blocks
+func (os *OS) deAlloc(address int) error {
+	size, ok := os.allocated[address]
+	if !ok {
+		return fmt.Errorf("deAlloc of an unallocated address:%d", address)
+	}
+	delete(os.allocated, address)
+	i := sort.Search(len(os.free), func(i int) bool { return os.free[i].address > address })
+	os.free = append(os.free, block{})
+	copy(os.free[i+1:], os.free[i:])
+	os.free[i] = block{address, size}
+	if i+1 < len(os.free) && address+size == os.free[i+1].address {
+		os.free[i].size += os.free[i+1].size
+		os.free = append(os.free[:i+1], os.free[i+2:]...)
+	}
+	if i > 0 && os.free[i-1].address+os.free[i-1].size == address {
+		os.free[i-1].size += os.free[i].size
+		os.free = append(os.free[:i], os.free[i+1:]...)
+	}
+	return nil
+}
+
+func (os *OS) stringNew(m *Machine, args []int16) (int16, error) {
+	if args[0] < 0 {
+		return 0, fmt.Errorf("invalid string length:%d", args[0])
+	}
+	s, err := os.alloc(int(args[0]) + 2)
+	if err != nil {
+		return 0, err
+	}
+	m.RAM[s] = args[0]
+	m.RAM[s+1] = 0
+	return s, nil
+}
+
+//stringOf returns the address of the string and its max length and length
+func stringOf(m *Machine, s int16) (int, int, int, error) {
+	if _, err := m.read(int(s) + 1); err != nil {
+		return 0, 0, 0, err
+	}
+	return int(s), int(m.RAM[s]), int(m.RAM[s+1]), nil
+}
+
+//stringText reads the chars of a string
+func stringText(m *Machine, s int16) ([]int16, error) {
+	address, _, length, err := stringOf(m, s)
+	if err != nil {
+		return nil, err
+	}
+	if address+2+length > RAMSize {
+		return nil, fmt.Errorf("invalid string:%d", s)
+	}
+	return append([]int16(nil), m.RAM[address+2:address+2+length]...), nil
+}
+
+func stringCharAt(m *Machine, args []int16) (int16, error) {
+	address, _, length, err := stringOf(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	if args[1] < 0 || int(args[1]) >= length {
+		return 0, fmt.Errorf("string index out of bounds:%d", args[1])
+	}
+	return m.RAM[address+2+int(args[1])], nil
+}
+
+func stringSetCharAt(m *Machine, args []int16) (int16, error) {
+	address, _, length, err := stringOf(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	if args[1] < 0 || int(args[1]) >= length {
+		return 0, fmt.Errorf("string index out of bounds:%d", args[1])
+	}
+	m.RAM[address+2+int(args[1])] = args[2]
+	return 0, nil
+}
+
+func stringAppendChar(m *Machine, args []int16) (int16, error) {
+	address, max, length, err := stringOf(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	if length >= max {
+		return 0, errors.New("string is full")
+	}
+	m.RAM[address+2+length] = args[1]
+	m.RAM[address+1]++
+	return args[0], nil
+}
+
+func stringEraseLastChar(m *Machine, args []int16) (int16, error) {
+	address, _, length, err := stringOf(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	if length == 0 {
+		return 0, errors.New("string is empty")
+	}
+	m.RAM[address+1]--
+	return 0, nil
+}
+
+//stringIntValue parses the leading digits of the string, with an optional minus sign
+func stringIntValue(m *Machine, args []int16) (int16, error) {
+	chars, err := stringText(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	var v int16
+	neg := len(chars) > 0 && chars[0] == '-'
+	if neg {
+		chars = chars[1:]
+	}
+	for _, c := range chars {
+		if c < '0' || c > '9' {
+			break
+		}
+		v = v*10 + c - '0'
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func stringSetInt(m *Machine, args []int16) (int16, error) {
+	address, max, _, err := stringOf(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	text := strconv.Itoa(int(args[1]))
+	if len(text) > max {
+		return 0, errors.New("string is full")
+	}
+	for i, c := range text {
+		m.RAM[address+2+i] = int16(c)
+	}
+	m.RAM[address+1] = int16(len(text))
+	return 0, nil
+}
+
+func (os *OS) printChar(c int16) {
+	switch c {
+	case charNewLine:
+		os.output = append(os.output, '\n')
+	case charBackSpace:
+		if len(os.output) > 0 && os.output[len(os.output)-1] != '\n' {
+			os.output = os.output[:len(os.output)-1]
+		}
+	default:
+		os.output = append(os.output, rune(c))
+	}
+}
+
+func (os *OS) print(s string) {
+	for _, c := range s {
+		os.printChar(int16(c))
+	}
+}
+
+func (os *OS) printString(m *Machine, args []int16) (int16, error) {
+	chars, err := stringText(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range chars {
+		os.printChar(c)
+	}
+	return 0, nil
+}
+
+func screenClear(m *Machine, args []int16) (int16, error) {
+	for i := ScreenBase; i < KeyboardAddr; i++ {
+		m.RAM[i] = 0
+	}
+	return 0, nil
+}
+
+func (os *OS) drawPixel(m *Machine, x, y int) error {
+	if x < 0 || x >= ScreenWidth || y < 0 || y >= ScreenHeight {
+		return fmt.Errorf("illegal pixel coordinates:(%d,%d)", x, y)
+	}
+	address := ScreenBase + y*screenWords + x/16
+	mask := int16(1) << uint(x%16)
+	if os.color {
+		m.RAM[address] |= mask
+	} else {
+		m.RAM[address] &^= mask
+	}
+	return nil
+}
+
+func (os *OS) drawLine(m *Machine, args []int16) (int16, error) {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+	dx, dy := x2-x1, y2-y1
+	sx, sy := 1, 1
+	if dx < 0 {
+		sx, dx = -1, -dx
+	}
+	if dy < 0 {
+		sy, dy = -1, -dy
+	}
+	err := dx - dy
+	for {
+		if e := os.drawPixel(m, x1, y1); e != nil {
+			return 0, e
+		}
+		if x1 == x2 && y1 == y2 {
+			return 0, nil
+		}
+		if 2*err > -dy {
+			err -= dy
+			x1 += sx
+		}
+		if 2*err < dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+func (os *OS) drawRectangle(m *Machine, args []int16) (int16, error) {
+	x1, y1, x2, y2 := int(args[0]), int(args[1]), int(args[2]), int(args[3])
+	if x1 > x2 || y1 > y2 {
+		return 0, fmt.Errorf("illegal rectangle coordinates:(%d,%d,%d,%d)", x1, y1, x2, y2)
+	}
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			if err := os.drawPixel(m, x, y); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return 0, nil
+}
+
+//drawCircle fills the circle line by line like the OS implementation
+func (os *OS) drawCircle(m *Machine, args []int16) (int16, error) {
+	cx, cy, r := int(args[0]), int(args[1]), int(args[2])
+	if r < 0 || r > 181 {
+		return 0, fmt.Errorf("illegal circle radius:%d", r)
+	}
+	for dy := -r; dy <= r; dy++ {
+		dx, _ := mathSqrt(m, []int16{int16(r*r - dy*dy)})
+		for x := cx - int(dx); x <= cx+int(dx); x++ {
+			if err := os.drawPixel(m, x, cy+dy); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return 0, nil
+}
+
+//nextKey waits until a key is pressed and released, and returns the key
+func (os *OS) nextKey(m *Machine) (int16, error) {
+	key := m.RAM[KeyboardAddr]
+	if os.reading.key == 0 {
+		os.reading.key = key
+		return 0, errWait
+	}
+	if key != 0 {
+		return 0, errWait
+	}
+	key, os.reading.key = os.reading.key, 0
+	return key, nil
+}
+
+func (os *OS) readChar(m *Machine, args []int16) (int16, error) {
+	if os.reading == nil {
+		os.reading = &readingState{}
+	}
+	c, err := os.nextKey(m)
+	if err != nil {
+		return 0, err
+	}
+	os.reading = nil
+	os.printChar(c)
+	return c, nil
+}
+
+//readLine prints the message and reads chars until a newline, erasing a char for each backspace
+func (os *OS) readLine(m *Machine, args []int16) (int16, error) {
+	line, err := os.readText(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	s, err := os.stringNew(m, []int16{int16(len(line))})
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range line {
+		stringAppendChar(m, []int16{s, int16(c)})
+	}
+	return s, nil
+}
+
+func (os *OS) readInt(m *Machine, args []int16) (int16, error) {
+	line, err := os.readText(m, args[0])
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimSpace(line)
+	end := 0
+	for end < len(line) && (line[end] >= '0' && line[end] <= '9' || end == 0 && line[end] == '-') {
+		end++
+	}
+	v, _ := strconv.Atoi(line[:end])
+	return int16(v), nil
+}
+
+func (os *OS) readText(m *Machine, message int16) (string, error) {
+	if os.reading == nil {
+		if _, err := os.printString(m, []int16{message}); err != nil {
+			return "", err
+		}
+		os.reading = &readingState{}
+	}
+	for {
+		c, err := os.nextKey(m)
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case charNewLine:
+			line := string(os.reading.line)
+			os.reading = nil
+			os.printChar(charNewLine)
+			return line, nil
+		case charBackSpace:
+			if len(os.reading.line) > 0 {
+				os.reading.line = os.reading.line[:len(os.reading.line)-1]
+				os.printChar(charBackSpace)
+			}
+		default:
+			os.reading.line = append(os.reading.line, rune(c))
+			os.printChar(c)
+		}
+	}
+}
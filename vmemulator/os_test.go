@@ -0,0 +1,161 @@
+package vmemulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhangwuh/jack-compiler/compiler"
+)
+
+//compileJack compiles jack sources into a temp dir without the OS vm files
+func compileJack(t *testing.T, sources map[string]string) string {
+	dir, err := ioutil.TempDir("", "jack")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for class, code := range sources {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, class+".jack"), []byte(code), 0644))
+	}
+	assert.Nil(t, compiler.CompileDir(dir, dir))
+	return dir
+}
+
+func runNative(t *testing.T, dir string) (*Machine, *OS) {
+	m, err := LoadDir(dir)
+	assert.Nil(t, err)
+	os := BindOS(m)
+	m.SetMaxSteps(1000000)
+	assert.Nil(t, m.Boot())
+	assert.Nil(t, m.Run())
+	return m, os
+}
+
+func TestOS_Fibonacci(t *testing.T) {
+	dir := compileProgram(t, "fibonacci")
+	vm, err := LoadDir(dir)
+	assert.Nil(t, err)
+	assert.Nil(t, vm.Boot())
+	assert.Nil(t, vm.Run())
+
+	native, os := runNative(t, dir)
+	assert.True(t, native.Halted())
+	assert.Equal(t, "THE Fib result is: 6765", os.Output())
+	assert.Less(t, native.Steps()*10, vm.Steps())
+}
+
+func TestOS_WithoutOSFiles(t *testing.T) {
+	dir := compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		var Array a, b;
+		var String s;
+		let a = Array.new(3);
+		do a.dispose();
+		let b = Array.new(2);
+		do Output.printInt(b - a);
+		do Output.println();
+		let s = String.new(6);
+		let s = s.appendChar(65);
+		do s.setInt(-123);
+		do Output.printString(s);
+		do Output.printInt(s.intValue() * 2);
+		do s.eraseLastChar();
+		do Output.printString(s);
+		do Output.printChar(String.doubleQuote());
+		do Output.printString("x!");
+		do Output.backSpace();
+		do Output.printInt(Math.sqrt(99) + Math.max(2, 7) - Math.abs(-3) + (7 / -2));
+		return;
+	}
+}`})
+	m, os := runNative(t, dir)
+	assert.False(t, m.Halted())
+	assert.Equal(t, "0\n-123-246-12\"x10", os.Output())
+}
+
+//the constructor of a class without fields allocates 0 words
+func TestOS_AllocWithoutFields(t *testing.T) {
+	dir := compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		var Empty a, b;
+		let a = Empty.new();
+		let b = Empty.new();
+		do Output.printInt(b - a);
+		do a.dispose();
+		return;
+	}
+}`, "Empty": `
+class Empty {
+	constructor Empty new() {
+		return this;
+	}
+
+	method void dispose() {
+		do Memory.deAlloc(this);
+		return;
+	}
+}`})
+	_, os := runNative(t, dir)
+	assert.Equal(t, "1", os.Output())
+}
+
+func TestOS_Screen(t *testing.T) {
+	dir := compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		do Screen.drawRectangle(0, 0, 16, 1);
+		do Screen.setColor(false);
+		do Screen.drawPixel(1, 1);
+		do Screen.setColor(true);
+		do Screen.drawLine(511, 255, 500, 255);
+		return;
+	}
+}`})
+	m, _ := runNative(t, dir)
+	assert.Equal(t, []int16{-1, 1}, m.RAM[ScreenBase:ScreenBase+2])
+	assert.Equal(t, []int16{-3, 1}, m.RAM[ScreenBase+32:ScreenBase+34])
+	assert.Equal(t, []int16{0, -16}, m.RAM[KeyboardAddr-2:KeyboardAddr])
+}
+
+func TestOS_Errors(t *testing.T) {
+	dir := compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		do Output.printInt(1 / 0);
+		return;
+	}
+}`})
+	m, err := LoadDir(dir)
+	assert.Nil(t, err)
+	BindOS(m)
+	assert.Nil(t, m.Boot())
+	assert.EqualError(t, m.Run(), "Main.vm:4 call Math.divide 2: division by zero")
+
+	dir = compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		do Sys.error(5);
+		do Output.printInt(1);
+		return;
+	}
+}`})
+	m, os := runNative(t, dir)
+	assert.True(t, m.Halted())
+	assert.Equal(t, "ERR5", os.Output())
+
+	dir = compileJack(t, map[string]string{"Main": `
+class Main {
+	function void main() {
+		do Memory.alloc(-1);
+		return;
+	}
+}`})
+	m, err = LoadDir(dir)
+	assert.Nil(t, err)
+	BindOS(m)
+	assert.Nil(t, m.Boot())
+	assert.EqualError(t, m.Run(), "Main.vm:4 call Memory.alloc 1: invalid allocation size:-1")
+}
@@ -0,0 +1,36 @@
+package vmemulator
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+var screenPalette = color.Palette{color.White, color.Black}
+
+//ScreenImage renders the screen memory map, the pixel (x, y) is the bit x%16 of RAM[16384+32*y+x/16], 1 for black
+func (m *Machine) ScreenImage() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, ScreenWidth, ScreenHeight), screenPalette)
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			if m.RAM[ScreenBase+y*screenWords+x/16]&(1<<uint(x%16)) != 0 {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+//SaveScreen writes the screen to a png file
+func (m *Machine) SaveScreen(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, m.ScreenImage()); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,80 @@
+package vmemulator
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//assertScreen compares the screen with the golden png under testdata
+func assertScreen(t *testing.T, m *Machine, golden string) {
+	f, err := os.Open(filepath.Join("testdata", golden))
+	assert.Nil(t, err)
+	defer f.Close()
+	expected, err := png.Decode(f)
+	assert.Nil(t, err)
+	actual := m.ScreenImage()
+	assert.Equal(t, expected.Bounds(), actual.Bounds())
+	for y := 0; y < ScreenHeight; y++ {
+		for x := 0; x < ScreenWidth; x++ {
+			er, _, _, _ := expected.At(x, y).RGBA()
+			ar, _, _, _ := actual.At(x, y).RGBA()
+			if er != ar {
+				t.Fatalf("%s: pixel (%d,%d) differs", golden, x, y)
+			}
+		}
+	}
+}
+
+//runSteps runs the program until the step limit, e.g. a game waiting for keys
+func runSteps(t *testing.T, m *Machine, steps int) {
+	m.SetMaxSteps(steps)
+	assert.Nil(t, m.Boot())
+	assert.Equal(t, ErrStepLimit, m.Run())
+}
+
+func TestScreen_Image(t *testing.T) {
+	m := loadVM(t, map[string]string{})
+	m.RAM[ScreenBase] = 1
+	m.RAM[ScreenBase+31] = -32768
+	m.RAM[KeyboardAddr-1] = 2
+	img := m.ScreenImage()
+	assert.Equal(t, uint8(1), img.ColorIndexAt(0, 0))
+	assert.Equal(t, uint8(0), img.ColorIndexAt(1, 0))
+	assert.Equal(t, uint8(1), img.ColorIndexAt(511, 0))
+	assert.Equal(t, uint8(1), img.ColorIndexAt(497, 255))
+
+	path := filepath.Join(t.TempDir(), "screen.png")
+	assert.Nil(t, m.SaveScreen(path))
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	saved, err := png.Decode(f)
+	assert.Nil(t, err)
+	r, _, _, _ := saved.At(497, 255).RGBA()
+	assert.Equal(t, uint32(0), r)
+}
+
+func TestScreen_Square(t *testing.T) {
+	dir := compileProgram(t, "Square")
+	m, err := LoadDir(dir)
+	assert.Nil(t, err)
+	runSteps(t, m, 3000000)
+	assertScreen(t, m, "square.png")
+
+	m, err = LoadDir(dir)
+	assert.Nil(t, err)
+	BindOS(m)
+	runSteps(t, m, 10000)
+	assertScreen(t, m, "square.png")
+}
+
+func TestScreen_Pong(t *testing.T) {
+	m, err := LoadDir(compileProgram(t, "Pong"))
+	assert.Nil(t, err)
+	runSteps(t, m, 5000000)
+	assertScreen(t, m, "pong.png")
+}
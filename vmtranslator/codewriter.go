@@ -0,0 +1,239 @@
+package vmtranslator
+
+import (
+	"fmt"
+)
+
+var segmentPointers = map[string]string{
+	"local":    "LCL",
+	"argument": "ARG",
+	"this":     "THIS",
+	"that":     "THAT",
+}
+
+var binaryOperations = map[string]string{
+	"add": "M=D+M",
+	"sub": "M=M-D",
+	"and": "M=D&M",
+	"or":  "M=D|M",
+}
+
+var unaryOperations = map[string]string{
+	"neg": "M=-M",
+	"not": "M=!M",
+}
+
+var comparisons = map[string]string{
+	"eq": "JEQ",
+	"gt": "JGT",
+	"lt": "JLT",
+}
+
+//labels of the routines shared by all the call and return commands to keep the program small
+const (
+	callRoutine   = "$$CALL"
+	returnRoutine = "$$RETURN"
+	endLoop       = "$$END" //the program halts here if Sys.init returns
+)
+
+//routines of lt and gt, x-y overflows for operands of different signs(e.g. -20000 < 20000)
+//so they branch on the signs before subtracting. eq subtracts inline since x-y is 0 only if x == y
+var comparisonRoutines = map[string]string{
+	"gt": "$$GT",
+	"lt": "$$LT",
+}
+
+type codeWriter struct {
+	lines        []string
+	file         string //name of current vm file, for static variables
+	function     string //name of current function, labels are scoped in functions
+	labelCounter int
+}
+
+func (w *codeWriter) emit(lines ...string) {
+	w.lines = append(w.lines, lines...)
+}
+
+func (w *codeWriter) uniqueLabel(prefix string) string {
+	w.labelCounter++
+	return fmt.Sprintf("%s.%d", prefix, w.labelCounter)
+}
+
+// Translate translates vm sources to hack assembly, the program starts with Sys.init if it's defined,
+//otherwise the first command of the first source.
+func Translate(sources []Source) []string {
+	w := &codeWriter{}
+	if hasFunction(sources, "Sys.init") {
+		w.writeBootstrap()
+	}
+	for _, src := range sources {
+		w.file = src.Name
+		w.function = ""
+		for _, cmd := range src.Commands {
+			w.emit("// " + cmd.String())
+			w.writeCommand(cmd)
+		}
+	}
+	w.emit("("+endLoop+")", "@"+endLoop, "0;JMP")
+	w.writeCallRoutine()
+	w.writeReturnRoutine()
+	w.writeComparisonRoutine("gt")
+	w.writeComparisonRoutine("lt")
+	return w.lines
+}
+
+func hasFunction(sources []Source, name string) bool {
+	for _, src := range sources {
+		for _, cmd := range src.Commands {
+			if cmd.Type == CFunction && cmd.Arg1 == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w *codeWriter) writeBootstrap() {
+	w.emit("// bootstrap", "@256", "D=A", "@SP", "M=D")
+	w.writeCall("Sys.init", 0)
+	w.emit("@"+endLoop, "0;JMP")
+}
+
+func (w *codeWriter) writeCommand(cmd Command) {
+	switch cmd.Type {
+	case CArithmetic:
+		w.writeArithmetic(cmd.Op)
+	case CPush:
+		w.writePush(cmd.Arg1, cmd.Arg2)
+	case CPop:
+		w.writePop(cmd.Arg1, cmd.Arg2)
+	case CLabel:
+		w.emit(fmt.Sprintf("(%s)", w.scopedLabel(cmd.Arg1)))
+	case CGoto:
+		w.emit("@"+w.scopedLabel(cmd.Arg1), "0;JMP")
+	case CIf:
+		w.emit("@SP", "AM=M-1", "D=M", "@"+w.scopedLabel(cmd.Arg1), "D;JNE")
+	case CFunction:
+		w.writeFunction(cmd.Arg1, cmd.Arg2)
+	case CCall:
+		w.writeCall(cmd.Arg1, cmd.Arg2)
+	case CReturn:
+		w.emit("@"+returnRoutine, "0;JMP")
+	}
+}
+
+func (w *codeWriter) scopedLabel(label string) string {
+	return fmt.Sprintf("%s$%s", w.function, label)
+}
+
+func (w *codeWriter) writeArithmetic(op string) {
+	if asm, ok := binaryOperations[op]; ok {
+		w.emit("@SP", "AM=M-1", "D=M", "A=A-1", asm)
+	} else if asm, ok := unaryOperations[op]; ok {
+		w.emit("@SP", "A=M-1", asm)
+	} else if routine, ok := comparisonRoutines[op]; ok {
+		ret := w.uniqueLabel("$$" + op)
+		w.emit("@"+ret, "D=A", "@"+routine, "0;JMP", "("+ret+")")
+	} else if jump, ok := comparisons[op]; ok {
+		label := w.uniqueLabel("$$" + op)
+		w.emit("@SP", "AM=M-1", "D=M", "A=A-1", "D=M-D", "M=-1", "@"+label, "D;"+jump, "@SP", "A=M-1", "M=0", "("+label+")")
+	}
+}
+
+//pushD pushes the D register onto the stack
+func (w *codeWriter) pushD() {
+	w.emit("@SP", "M=M+1", "A=M-1", "M=D")
+}
+
+func (w *codeWriter) address(segment string, index int) string {
+	switch segment {
+	case "temp":
+		return fmt.Sprintf("@%d", 5+index)
+	case "pointer":
+		return fmt.Sprintf("@%d", 3+index)
+	case "static":
+		return fmt.Sprintf("@%s.%d", w.file, index)
+	}
+	return ""
+}
+
+func (w *codeWriter) writePush(segment string, index int) {
+	if segment == "constant" {
+		w.emit(fmt.Sprintf("@%d", index), "D=A")
+	} else if pointer, ok := segmentPointers[segment]; ok {
+		w.emit(fmt.Sprintf("@%d", index), "D=A", "@"+pointer, "A=D+M", "D=M")
+	} else {
+		w.emit(w.address(segment, index), "D=M")
+	}
+	w.pushD()
+}
+
+func (w *codeWriter) writePop(segment string, index int) {
+	if pointer, ok := segmentPointers[segment]; ok {
+		w.emit(fmt.Sprintf("@%d", index), "D=A", "@"+pointer, "D=D+M", "@R13", "M=D")
+		w.emit("@SP", "AM=M-1", "D=M", "@R13", "A=M", "M=D")
+		return
+	}
+	w.emit("@SP", "AM=M-1", "D=M", w.address(segment, index), "M=D")
+}
+
+func (w *codeWriter) writeFunction(name string, locals int) {
+	w.function = name
+	w.emit(fmt.Sprintf("(%s)", name))
+	if locals == 0 {
+		return
+	}
+	w.emit("@SP", "A=M")
+	for i := 0; i < locals; i++ {
+		w.emit("M=0", "A=A+1")
+	}
+	w.emit("D=A", "@SP", "M=D")
+}
+
+//the return address, the callee and the number of arguments are passed to the call routine by D, R13 and R14
+func (w *codeWriter) writeCall(name string, args int) {
+	ret := w.uniqueLabel(name + "$ret")
+	w.emit(fmt.Sprintf("@%d", args), "D=A", "@R14", "M=D")
+	w.emit("@"+name, "D=A", "@R13", "M=D")
+	w.emit("@"+ret, "D=A", "@"+callRoutine, "0;JMP")
+	w.emit("(" + ret + ")")
+}
+
+func (w *codeWriter) writeCallRoutine() {
+	w.emit("// call routine", "("+callRoutine+")")
+	w.pushD() //return address
+	for _, pointer := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		w.emit("@"+pointer, "D=M")
+		w.pushD()
+	}
+	w.emit("@SP", "D=M", "@LCL", "M=D")                   //LCL = SP
+	w.emit("@R14", "D=D-M", "@5", "D=D-A", "@ARG", "M=D") //ARG = SP - nArgs - 5
+	w.emit("@R13", "A=M", "0;JMP")
+}
+
+func (w *codeWriter) writeReturnRoutine() {
+	w.emit("// return routine", "("+returnRoutine+")")
+	w.emit("@LCL", "D=M", "@R13", "M=D")                 //frame = LCL
+	w.emit("@5", "A=D-A", "D=M", "@R14", "M=D")          //ret = *(frame - 5)
+	w.emit("@SP", "AM=M-1", "D=M", "@ARG", "A=M", "M=D") //*ARG = pop()
+	w.emit("@ARG", "D=M+1", "@SP", "M=D")                //SP = ARG + 1
+	for _, pointer := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		w.emit("@R13", "AM=M-1", "D=M", "@"+pointer, "M=D")
+	}
+	w.emit("@R14", "A=M", "0;JMP")
+}
+
+//the return address is passed to a comparison routine by D and kept in R15. D is set to a value of the sign of x-y
+//before the jump: x-y itself if x and y have the same sign, otherwise 1 or -1 by the sign of x
+func (w *codeWriter) writeComparisonRoutine(op string) {
+	routine := comparisonRoutines[op]
+	negative, sameSign, compare, end := routine+"$NEG", routine+"$SAME", routine+"$CMP", routine+"$END"
+	w.emit("// "+op+" routine", "("+routine+")", "@R15", "M=D")
+	w.emit("@SP", "AM=M-1", "D=M", "@R13", "M=D") //R13 = y
+	w.emit("@SP", "A=M-1", "D=M", "@"+negative, "D;JLT")
+	w.emit("@R13", "D=M", "@"+sameSign, "D;JGE", "D=1", "@"+compare, "0;JMP")                    //x >= 0 > y
+	w.emit("("+negative+")", "@R13", "D=M", "@"+sameSign, "D;JLT", "D=-1", "@"+compare, "0;JMP") //x < 0 <= y
+	w.emit("("+sameSign+")", "@R13", "D=M", "@SP", "A=M-1", "D=M-D")
+	w.emit("("+compare+")", "@SP", "A=M-1", "M=-1", "@"+end, "D;"+comparisons[op], "@SP", "A=M-1", "M=0")
+	w.emit("("+end+")", "@R15", "A=M", "0;JMP")
+}
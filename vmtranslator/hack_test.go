@@ -0,0 +1,171 @@
+package vmtranslator
+
+import (
+	"strconv"
+	"strings"
+)
+
+//hackCPU runs hack assembly for the tests
+type hackCPU struct {
+	rom     []string
+	labels  map[string]int
+	symbols map[string]int
+	ram     [32768]int16
+	a, d    int16
+	pc      int
+}
+
+var predefinedSymbols = map[string]int{
+	"SP": 0, "LCL": 1, "ARG": 2, "THIS": 3, "THAT": 4, "SCREEN": 16384, "KBD": 24576,
+}
+
+func newHackCPU(asm []string) *hackCPU {
+	cpu := &hackCPU{labels: map[string]int{}, symbols: map[string]int{}}
+	for _, line := range asm {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "(") {
+			cpu.labels[strings.Trim(line, "()")] = len(cpu.rom)
+			continue
+		}
+		cpu.rom = append(cpu.rom, line)
+	}
+	for k, v := range predefinedSymbols {
+		cpu.symbols[k] = v
+	}
+	for i := 0; i < 16; i++ {
+		cpu.symbols["R"+strconv.Itoa(i)] = i
+	}
+	return cpu
+}
+
+func (cpu *hackCPU) resolve(symbol string) int16 {
+	if n, err := strconv.Atoi(symbol); err == nil {
+		return int16(n)
+	}
+	if n, ok := cpu.labels[symbol]; ok {
+		return int16(n)
+	}
+	if n, ok := cpu.symbols[symbol]; ok {
+		return int16(n)
+	}
+	n := 16
+	for _, v := range cpu.symbols {
+		if v >= n && v < 16384 {
+			n = v + 1
+		}
+	}
+	cpu.symbols[symbol] = n
+	return int16(n)
+}
+
+func (cpu *hackCPU) comp(comp string) int16 {
+	y := cpu.a
+	if strings.Contains(comp, "M") {
+		y = cpu.ram[uint16(cpu.a)&0x7fff]
+		comp = strings.Replace(comp, "M", "A", -1)
+	}
+	x := cpu.d
+	switch comp {
+	case "0":
+		return 0
+	case "1":
+		return 1
+	case "-1":
+		return -1
+	case "D":
+		return x
+	case "A":
+		return y
+	case "!D":
+		return ^x
+	case "!A":
+		return ^y
+	case "-D":
+		return -x
+	case "-A":
+		return -y
+	case "D+1":
+		return x + 1
+	case "A+1":
+		return y + 1
+	case "D-1":
+		return x - 1
+	case "A-1":
+		return y - 1
+	case "D+A", "A+D":
+		return x + y
+	case "D-A":
+		return x - y
+	case "A-D":
+		return y - x
+	case "D&A", "A&D":
+		return x & y
+	case "D|A", "A|D":
+		return x | y
+	}
+	panic("invalid comp:" + comp)
+}
+
+func (cpu *hackCPU) step() {
+	inst := cpu.rom[cpu.pc]
+	cpu.pc++
+	if strings.HasPrefix(inst, "@") {
+		cpu.a = cpu.resolve(inst[1:])
+		return
+	}
+	dest, jump := "", ""
+	if i := strings.Index(inst, "="); i >= 0 {
+		dest, inst = inst[:i], inst[i+1:]
+	}
+	if i := strings.Index(inst, ";"); i >= 0 {
+		inst, jump = inst[:i], inst[i+1:]
+	}
+	v := cpu.comp(inst)
+	address := uint16(cpu.a) & 0x7fff
+	if strings.Contains(dest, "M") {
+		cpu.ram[address] = v
+	}
+	if strings.Contains(dest, "A") {
+		cpu.a = v
+	}
+	if strings.Contains(dest, "D") {
+		cpu.d = v
+	}
+	jumped := false
+	switch jump {
+	case "JMP":
+		jumped = true
+	case "JEQ":
+		jumped = v == 0
+	case "JNE":
+		jumped = v != 0
+	case "JGT":
+		jumped = v > 0
+	case "JLT":
+		jumped = v < 0
+	case "JGE":
+		jumped = v >= 0
+	case "JLE":
+		jumped = v <= 0
+	}
+	if jumped {
+		cpu.pc = int(address)
+	}
+}
+
+//run until the program gets into the endless loop at the end
+func (cpu *hackCPU) run(maxSteps int) bool {
+	for i := 0; i < maxSteps; i++ {
+		if cpu.pc == cpu.labels[endLoop] {
+			return true
+		}
+		cpu.step()
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package vmtranslator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type CommandType int
+
+const (
+	CArithmetic CommandType = iota
+	CPush
+	CPop
+	CLabel
+	CGoto
+	CIf
+	CFunction
+	CCall
+	CReturn
+)
+
+var commandTypes = map[string]CommandType{
+	"add": CArithmetic, "sub": CArithmetic, "neg": CArithmetic, "eq": CArithmetic, "gt": CArithmetic,
+	"lt": CArithmetic, "and": CArithmetic, "or": CArithmetic, "not": CArithmetic,
+	"push":     CPush,
+	"pop":      CPop,
+	"label":    CLabel,
+	"goto":     CGoto,
+	"if-goto":  CIf,
+	"function": CFunction,
+	"call":     CCall,
+	"return":   CReturn,
+}
+
+//segments and the max index allowed, -1 for unlimited
+var segments = map[string]int{
+	"argument": -1, "local": -1, "static": 239, "constant": 32767,
+	"this": -1, "that": -1, "pointer": 1, "temp": 7,
+}
+
+//Command is one line of vm code, e.g. `push local 2`:
+//Op is the command word, Arg1 is the segment, label or function name and Arg2 is the index,
+//number of locals or number of arguments
+type Command struct {
+	Type CommandType
+	Op   string
+	Arg1 string
+	Arg2 int
+	Line int //line number in the vm file
+}
+
+func (c Command) String() string {
+	switch c.Type {
+	case CArithmetic, CReturn:
+		return c.Op
+	case CLabel, CGoto, CIf:
+		return fmt.Sprintf("%s %s", c.Op, c.Arg1)
+	}
+	return fmt.Sprintf("%s %s %d", c.Op, c.Arg1, c.Arg2)
+}
+
+//Source is the parsed content of a vm file, Name is used to name the static variables
+type Source struct {
+	Name     string
+	Commands []Command
+}
+
+func Parse(name string, rd io.Reader) (Source, error) {
+	src := Source{Name: name}
+	scanner := bufio.NewScanner(rd)
+	var lineCount int
+	for scanner.Scan() {
+		lineCount++
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, err := parseCommand(fields)
+		if err != nil {
+			return src, fmt.Errorf("%s.vm:%d: %s", name, lineCount, err.Error())
+		}
+		cmd.Line = lineCount
+		src.Commands = append(src.Commands, cmd)
+	}
+	return src, scanner.Err()
+}
+
+func parseCommand(fields []string) (Command, error) {
+	typ, ok := commandTypes[fields[0]]
+	if !ok {
+		return Command{}, fmt.Errorf("unknown command:%s", fields[0])
+	}
+	cmd := Command{Type: typ, Op: fields[0]}
+	var argc int
+	switch typ {
+	case CLabel, CGoto, CIf:
+		argc = 1
+	case CPush, CPop, CFunction, CCall:
+		argc = 2
+	}
+	if len(fields) != argc+1 {
+		return cmd, fmt.Errorf("%s expects %d arguments, got %d", cmd.Op, argc, len(fields)-1)
+	}
+	if argc == 0 {
+		return cmd, nil
+	}
+	cmd.Arg1 = fields[1]
+	if argc == 1 {
+		return cmd, nil
+	}
+	n, err := strconv.Atoi(fields[2])
+	if err != nil || n < 0 {
+		return cmd, fmt.Errorf("invalid number:%s", fields[2])
+	}
+	cmd.Arg2 = n
+	if typ == CPush || typ == CPop {
+		max, ok := segments[cmd.Arg1]
+		if !ok {
+			return cmd, fmt.Errorf("unknown segment:%s", cmd.Arg1)
+		}
+		if max >= 0 && n > max {
+			return cmd, fmt.Errorf("index out of %s segment:%d", cmd.Arg1, n)
+		}
+		if typ == CPop && cmd.Arg1 == "constant" {
+			return cmd, fmt.Errorf("can't pop to constant segment")
+		}
+	}
+	return cmd, nil
+}
+
+func ParseFile(path string) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Source{}, err
+	}
+	defer f.Close()
+	return Parse(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), f)
+}
+
+//ParseDir parses all the vm files of dir in the order of file names, path can also be a single vm file
+func ParseDir(path string) ([]Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if info.IsDir() {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range infos {
+			if !fi.IsDir() && filepath.Ext(fi.Name()) == ".vm" {
+				files = append(files, filepath.Join(path, fi.Name()))
+			}
+		}
+		sort.Strings(files)
+	} else {
+		files = append(files, path)
+	}
+
+	var sources []Source
+	for _, file := range files {
+		src, err := ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
@@ -0,0 +1,33 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//TranslatePath translates a vm file or all the vm files of a directory into one asm file,
+//the output defaults to <dir>/<dir name>.asm for directories and <file>.asm for files
+func TranslatePath(path string, output string) error {
+	sources, err := ParseDir(path)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no vm files found in %s", path)
+	}
+	if len(output) == 0 {
+		output = defaultOutput(path)
+	}
+	asm := strings.Join(Translate(sources), "\n") + "\n"
+	return ioutil.WriteFile(output, []byte(asm), 0644)
+}
+
+func defaultOutput(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, filepath.Base(filepath.Clean(path))+".asm")
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".asm"
+}
@@ -0,0 +1,244 @@
+package vmtranslator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runVM(t *testing.T, sources map[string]string, setup func(cpu *hackCPU)) *hackCPU {
+	var srcs []Source
+	for _, name := range []string{"Main", "Sys"} {
+		code, ok := sources[name]
+		if !ok {
+			continue
+		}
+		src, err := Parse(name, strings.NewReader(code))
+		assert.Nil(t, err)
+		srcs = append(srcs, src)
+	}
+	cpu := newHackCPU(Translate(srcs))
+	if setup != nil {
+		setup(cpu)
+	}
+	assert.True(t, cpu.run(1000000))
+	return cpu
+}
+
+func setStack(cpu *hackCPU) {
+	cpu.ram[0] = 256
+}
+
+func TestTranslate_Arithmetic(t *testing.T) {
+	cpu := runVM(t, map[string]string{"Main": `
+push constant 7
+push constant 8
+add
+push constant 17
+push constant 17
+eq
+push constant 892
+push constant 891
+lt
+push constant 32767
+push constant 32766
+gt
+push constant 57
+push constant 31
+push constant 53
+add
+push constant 112
+sub
+neg
+and
+push constant 82
+or
+not
+push constant 20
+push constant 30
+sub`}, setStack)
+	assert.Equal(t, int16(262), cpu.ram[0])
+	assert.Equal(t, []int16{15, -1, 0, -1, -91, -10}, cpu.ram[256:262])
+}
+
+//x-y overflows for operands of different signs
+func TestTranslate_Comparisons(t *testing.T) {
+	cpu := runVM(t, map[string]string{"Main": `
+push constant 20000
+neg
+push constant 20000
+lt
+push constant 20000
+push constant 20000
+neg
+lt
+push constant 20000
+neg
+push constant 20000
+gt
+push constant 20000
+push constant 20000
+neg
+gt
+push constant 0
+push constant 32767
+not
+gt
+push constant 32767
+not
+push constant 0
+lt
+push constant 3
+neg
+push constant 2
+neg
+lt
+push constant 5
+push constant 5
+gt
+push constant 32767
+not
+push constant 32767
+eq`}, setStack)
+	assert.Equal(t, int16(265), cpu.ram[0])
+	assert.Equal(t, []int16{-1, 0, 0, -1, -1, -1, -1, 0, 0}, cpu.ram[256:265])
+}
+
+func TestTranslate_Segments(t *testing.T) {
+	cpu := runVM(t, map[string]string{"Main": `
+push constant 10
+pop local 0
+push constant 21
+push constant 22
+pop argument 2
+pop argument 1
+push constant 3030
+pop pointer 0
+push constant 3040
+pop pointer 1
+push constant 36
+pop this 6
+push constant 42
+push constant 45
+pop that 5
+pop that 2
+push constant 510
+pop temp 6
+push constant 888
+pop static 8
+push local 0
+push that 5
+add
+push argument 1
+sub
+push this 6
+push this 6
+add
+sub
+push temp 6
+add
+push pointer 0
+push pointer 1
+add
+push static 8
+add`}, func(cpu *hackCPU) {
+		cpu.ram[0], cpu.ram[1], cpu.ram[2] = 256, 300, 400
+	})
+	assert.Equal(t, int16(10), cpu.ram[300])
+	assert.Equal(t, int16(21), cpu.ram[401])
+	assert.Equal(t, int16(22), cpu.ram[402])
+	assert.Equal(t, int16(36), cpu.ram[3036])
+	assert.Equal(t, int16(42), cpu.ram[3042])
+	assert.Equal(t, int16(45), cpu.ram[3045])
+	assert.Equal(t, int16(510), cpu.ram[11])
+	assert.Equal(t, []int16{472, 6958}, cpu.ram[256:258])
+}
+
+func TestTranslate_FunctionCall(t *testing.T) {
+	cpu := runVM(t, map[string]string{
+		"Main": `
+// computes the n'th fibonacci number recursively
+function Main.fib 0
+push argument 0
+push constant 2
+lt
+if-goto BASE
+push argument 0
+push constant 2
+sub
+call Main.fib 1
+push argument 0
+push constant 1
+sub
+call Main.fib 1
+add
+return
+label BASE
+push argument 0
+return
+function Main.sum 2
+label LOOP
+push local 0
+push argument 0
+gt
+if-goto END
+push local 1
+push local 0
+add
+pop local 1
+push local 0
+push constant 1
+add
+pop local 0
+goto LOOP
+label END
+push local 1
+return`,
+		"Sys": `
+function Sys.init 0
+push constant 12
+call Main.fib 1
+pop static 0
+push constant 100
+call Main.sum 1
+pop static 1
+push constant 0
+return`}, nil)
+	assert.Equal(t, int16(144), cpu.ram[cpu.symbols["Sys.0"]])
+	assert.Equal(t, int16(5050), cpu.ram[cpu.symbols["Sys.1"]])
+	assert.Equal(t, int16(257), cpu.ram[0]) //return value of Sys.init
+}
+
+func TestParse_Errors(t *testing.T) {
+	for source, msg := range map[string]string{
+		"push constant":     "Main.vm:1: push expects 2 arguments, got 1",
+		"pop constant 1":    "Main.vm:1: can't pop to constant segment",
+		"push temp 8":       "Main.vm:1: index out of temp segment:8",
+		"push heap 1":       "Main.vm:1: unknown segment:heap",
+		"\n\nmul":           "Main.vm:3: unknown command:mul",
+		"call Main.foo x":   "Main.vm:1: invalid number:x",
+		"label A B // note": "Main.vm:1: label expects 1 arguments, got 2",
+	} {
+		_, err := Parse("Main", strings.NewReader(source))
+		if assert.NotNil(t, err, source) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+}
+
+func TestTranslatePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vm")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "Pong.asm")
+	assert.Nil(t, TranslatePath("../output/vm/Pong", output))
+	asm, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(asm), "// bootstrap\n@256\n"))
+	assert.Contains(t, string(asm), "(PongGame.run)")
+	assert.Contains(t, string(asm), "(Sys.init)")
+}